@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 
+	"github.com/KaramelBytes/docloom-cli/internal/ingest"
+	"github.com/KaramelBytes/docloom-cli/internal/parser"
 	"github.com/KaramelBytes/docloom-cli/internal/project"
 	"github.com/spf13/cobra"
 )
@@ -11,38 +16,278 @@ import (
 var (
 	addProjectName string
 	addDocDesc     string
+	addInclude     []string
+	addExclude     []string
+	addWorkers     int
+	addQuiet       bool
+	addPriority    string
+	addPin         bool
+	addTruncate    string
+	addTags        []string
+	addOnSimilar   string
+	addSimilarity  float64
+	addForce       bool
 )
 
 var addCmd = &cobra.Command{
-	Use:   "add <file>",
-	Short: "Add a document to a project",
-	Args:  cobra.ExactArgs(1),
+	Use:   "add <file|dir|glob>...",
+	Short: "Add documents to a project",
+	Example: `  docloom add -p myproj ./docs/spec.md --desc "Spec"
+  docloom add -p myproj ./docs --include '*.md' --exclude 'drafts/'
+  docloom add -p myproj "notes/*.txt" ./specs
+  docloom add -p myproj ./spec-v3-final-2.md --on-similar replace`,
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		file := args[0]
-		if addProjectName == "" {
-			return fmt.Errorf("--project is required")
-		}
-		projDir, err := resolveProjectDirByName(addProjectName)
+		projDir, err := projectDirFromFlag(addProjectName)
 		if err != nil {
 			return err
 		}
-		p, err := project.LoadProject(projDir)
+		priority, err := project.ParsePriority(addPriority)
 		if err != nil {
 			return err
 		}
-		if err := p.AddDocument(file, addDocDesc); err != nil {
-			return err
+		if !project.ValidTruncation(addTruncate) {
+			return fmt.Errorf("unsupported --truncate: %s (use head|head-tail|sections)", addTruncate)
+		}
+		for _, t := range addTags {
+			if _, err := project.NormalizeTag(t); err != nil {
+				return err
+			}
+		}
+		switch addOnSimilar {
+		case similarKeepBoth, similarSkip, similarReplace:
+		default:
+			return fmt.Errorf("unsupported --on-similar: %s (use keep-both|skip|replace)", addOnSimilar)
 		}
-		if err := p.Save(); err != nil {
+		if addSimilarity < 0 || addSimilarity > 1 {
+			return fmt.Errorf("--similarity must be between 0 and 1")
+		}
+		p, err := openProjectForUpdate(projDir)
+		if err != nil {
 			return err
 		}
-		fmt.Printf("✓ Document added: %s\n", filepath.Base(file))
+		defer p.Close()
+		p.SetSizeLimits(projectSizeLimits(p, cfg, addForce))
+
+		// Single literal file keeps the original, strict behaviour.
+		if len(args) == 1 {
+			if info, err := os.Stat(args[0]); err == nil && !info.IsDir() {
+				parsed, err := parser.ParseFile(args[0])
+				if err != nil {
+					return fmt.Errorf("parse document: %w", err)
+				}
+				outcome, err := registerDocument(p, args[0], parsed, addOptions{
+					Description: addDocDesc,
+					Priority:    priority,
+					Pinned:      addPin,
+					Truncation:  addTruncate,
+					Tags:        addTags,
+					OnSimilar:   addOnSimilar,
+					Similarity:  addSimilarity,
+				})
+				if err != nil {
+					return err
+				}
+				if outcome == outcomeSkipped {
+					fmt.Printf("- Skipped near-duplicate: %s\n", filepath.Base(args[0]))
+					printHeadroom(p)
+					return nil
+				}
+				if err := p.Save(); err != nil {
+					return err
+				}
+				if outcome == outcomeReplaced {
+					fmt.Printf("✓ Document replaced: %s\n", filepath.Base(args[0]))
+				} else {
+					fmt.Printf("✓ Document added: %s\n", filepath.Base(args[0]))
+				}
+				printHeadroom(p)
+				return nil
+			}
+		}
+
+		sum := addPaths(cmd.Context(), p, args, addOptions{
+			Description: addDocDesc,
+			Include:     addInclude,
+			Exclude:     addExclude,
+			Workers:     addWorkers,
+			Quiet:       addQuiet,
+			Priority:    priority,
+			Pinned:      addPin,
+			Truncation:  addTruncate,
+			Tags:        addTags,
+			OnSimilar:   addOnSimilar,
+			Similarity:  addSimilarity,
+		})
+		if sum.Added > 0 || sum.Replaced > 0 {
+			if err := p.Save(); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Summary: added %d, replaced %d, skipped unsupported %d, skipped ignored %d, skipped duplicate %d, skipped near-duplicate %d, failed %d\n",
+			sum.Added, sum.Replaced, sum.Unsupported, sum.Ignored, sum.Duplicates, sum.Similar, sum.Failed)
+		printHeadroom(p)
+		if sum.Failed > 0 {
+			return fmt.Errorf("%d file(s) failed to add", sum.Failed)
+		}
 		return nil
 	},
 }
 
+type addOptions struct {
+	Description string
+	Include     []string
+	Exclude     []string
+	Workers     int
+	Quiet       bool
+	Priority    int
+	Pinned      bool
+	Truncation  string
+	Tags        []string
+	// OnSimilar decides what happens to near-duplicates: keep-both|skip|replace.
+	OnSimilar string
+	// Similarity is the near-duplicate threshold (0..1); 0 disables the check.
+	Similarity float64
+}
+
+// --on-similar policies for near-duplicate documents.
+const (
+	similarKeepBoth = "keep-both"
+	similarSkip     = "skip"
+	similarReplace  = "replace"
+)
+
+// registerDocument outcomes.
+const (
+	outcomeAdded    = "added"
+	outcomeReplaced = "replaced"
+	outcomeSkipped  = "skipped"
+)
+
+// registerDocument adds parsed content from path to p after checking it
+// against existing documents for near-duplicates. The most similar match is
+// reported and opts.OnSimilar decides whether the new file is skipped,
+// replaces the match in place, or is added alongside it.
+func registerDocument(p *project.Project, path, parsed string, opts addOptions) (string, error) {
+	if opts.Similarity > 0 {
+		match, found, err := p.MostSimilar(parsed, opts.Similarity)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			fmt.Printf("⚠ %s is %.0f%% similar to %s (ID %s)\n", path, match.Similarity*100, match.Document.Name, match.Document.ID)
+			switch opts.OnSimilar {
+			case similarSkip:
+				return outcomeSkipped, nil
+			case similarReplace:
+				d, err := p.ReplaceParsed(match.Document, path, opts.Description, parsed)
+				if err != nil {
+					return "", err
+				}
+				printScreening(d)
+				return outcomeReplaced, nil
+			default:
+				fmt.Println("  keeping both (use --on-similar skip|replace to change)")
+			}
+		}
+	}
+	d, err := p.AddParsed(path, opts.Description, parsed)
+	if err != nil {
+		return "", err
+	}
+	d.Priority = opts.Priority
+	d.Pinned = opts.Pinned
+	d.Truncation = opts.Truncation
+	_, _ = d.AddTags(opts.Tags...) // validated by the caller
+	printScreening(d)
+	return outcomeAdded, nil
+}
+
+type addSummary struct {
+	Added       int
+	Replaced    int
+	Similar     int
+	Unsupported int
+	Ignored     int
+	Duplicates  int
+	Failed      int
+}
+
+// addPaths expands args, parses the files concurrently, and registers them on p
+// sequentially. Per-file problems are reported and counted rather than returned.
+func addPaths(ctx context.Context, p *project.Project, args []string, opts addOptions) addSummary {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cands := ingest.Collect(args, ingest.Options{Include: opts.Include, Exclude: opts.Exclude})
+	sum := addSummary{
+		Unsupported: len(cands.Unsupported),
+		Ignored:     len(cands.Ignored),
+		Failed:      len(cands.Failed),
+	}
+	for _, f := range cands.Failed {
+		fmt.Printf("✗ %s: %v\n", f.Path, f.Err)
+	}
+	if !opts.Quiet {
+		for _, u := range cands.Unsupported {
+			fmt.Printf("- Skipped unsupported: %s\n", u)
+		}
+	}
+
+	results := ingest.ParseAll(ctx, cands.Files, opts.Workers, parser.ParseFile)
+	for _, r := range results {
+		if r.Err != nil {
+			sum.Failed++
+			fmt.Printf("✗ %s: parse document: %v\n", r.Path, r.Err)
+			continue
+		}
+		outcome, err := registerDocument(p, r.Path, r.Content, opts)
+		if err != nil {
+			if errors.Is(err, project.ErrDuplicateDocument) {
+				sum.Duplicates++
+				if !opts.Quiet {
+					fmt.Printf("- Skipped duplicate: %s\n", r.Path)
+				}
+				continue
+			}
+			sum.Failed++
+			fmt.Printf("✗ %s: %v\n", r.Path, err)
+			continue
+		}
+		switch outcome {
+		case outcomeSkipped:
+			sum.Similar++
+			if !opts.Quiet {
+				fmt.Printf("- Skipped near-duplicate: %s\n", r.Path)
+			}
+		case outcomeReplaced:
+			sum.Replaced++
+			if !opts.Quiet {
+				fmt.Printf("✓ Document replaced: %s\n", r.Path)
+			}
+		default:
+			sum.Added++
+			if !opts.Quiet {
+				fmt.Printf("✓ Document added: %s\n", r.Path)
+			}
+		}
+	}
+	return sum
+}
+
 func init() {
 	rootCmd.AddCommand(addCmd)
 	addCmd.Flags().StringVarP(&addProjectName, "project", "p", "", "project name")
 	addCmd.Flags().StringVar(&addDocDesc, "desc", "", "document description")
+	addCmd.Flags().StringSliceVar(&addInclude, "include", nil, "gitignore-style patterns to include when walking directories (repeatable)")
+	addCmd.Flags().StringSliceVar(&addExclude, "exclude", nil, "gitignore-style patterns to exclude when walking directories (repeatable)")
+	addCmd.Flags().IntVar(&addWorkers, "workers", 0, "parallel parse workers (default: number of CPUs, max 8)")
+	addCmd.Flags().BoolVar(&addQuiet, "quiet", false, "only print failures and the final summary")
+	addCmd.Flags().StringVar(&addPriority, "priority", "normal", "document priority when trimming to --prompt-limit: low|normal|high or an integer")
+	addCmd.Flags().BoolVar(&addPin, "pin", false, "pin the document so it is always included in prompts")
+	addCmd.Flags().StringSliceVar(&addTags, "tag", nil, "tag the added documents (comma-separated, repeatable)")
+	addCmd.Flags().StringVar(&addOnSimilar, "on-similar", similarKeepBoth, "what to do when a document is a near-duplicate of an existing one: keep-both|skip|replace")
+	addCmd.Flags().Float64Var(&addSimilarity, "similarity", project.DefaultSimilarityThreshold, "near-duplicate threshold between 0 and 1 (0 disables the check)")
+	addCmd.Flags().BoolVar(&addForce, "force", false, "add even if the project would exceed its token limit")
+	addCmd.Flags().StringVar(&addTruncate, "truncate", "", "truncation strategy under --prompt-limit: head|head-tail|sections (default head)")
 }
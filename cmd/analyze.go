@@ -7,7 +7,8 @@ import (
 	"strings"
 
 	"github.com/KaramelBytes/docloom-cli/internal/analysis"
-	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/KaramelBytes/docloom-cli/internal/parser"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
 	"github.com/spf13/cobra"
 )
 
@@ -126,10 +127,12 @@ var analyzeCmd = &cobra.Command{
 			if err != nil {
 				return err
 			}
-			p, err := project.LoadProject(projDir)
+			p, err := openProjectForUpdate(projDir)
 			if err != nil {
 				return err
 			}
+			defer p.Close()
+			p.SetSizeLimits(projectSizeLimits(p, cfg, false))
 
 			// Count existing dataset summaries
 			datasetCount := 0
@@ -200,14 +203,14 @@ var analyzeCmd = &cobra.Command{
 					idx++
 				}
 			}
-			if err := os.WriteFile(outFile, []byte(md), 0o644); err != nil {
+			if err := vault.WriteFile(outFile, []byte(md)); err != nil {
 				return fmt.Errorf("write project summary: %w", err)
 			}
 			desc := anaDescription
 			if desc == "" {
 				desc = "Auto-generated dataset summary"
 			}
-			if err := p.AddDocument(outFile, desc); err != nil {
+			if _, err := p.AddDerived(outFile, desc, path, parser.DatasetOptions(path, anaSheetName, anaSheetIndex, opt)); err != nil {
 				return err
 			}
 			if err := p.Save(); err != nil {
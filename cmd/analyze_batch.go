@@ -8,7 +8,9 @@ import (
 	"strings"
 
 	"github.com/KaramelBytes/docloom-cli/internal/analysis"
+	"github.com/KaramelBytes/docloom-cli/internal/parser"
 	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
 	"github.com/spf13/cobra"
 )
 
@@ -116,11 +118,13 @@ var analyzeBatchCmd = &cobra.Command{
 			if err != nil {
 				return err
 			}
-			pp, err := project.LoadProject(projDir)
+			pp, err := openProjectForUpdate(projDir)
 			if err != nil {
 				return err
 			}
+			defer pp.Close()
 			p = pp
+			p.SetSizeLimits(projectSizeLimits(p, cfg, false))
 			if abSampleRowsProject >= 0 {
 				opt.SampleRows = abSampleRowsProject
 			}
@@ -249,14 +253,14 @@ var analyzeBatchCmd = &cobra.Command{
 						idx++
 					}
 				}
-				if err := os.WriteFile(outFile, []byte(md), 0o644); err != nil {
+				if err := vault.WriteFile(outFile, []byte(md)); err != nil {
 					return fmt.Errorf("write project summary: %w", err)
 				}
 				desc := abDescription
 				if desc == "" {
 					desc = "Auto-generated dataset summary"
 				}
-				if err := p.AddDocument(outFile, desc); err != nil {
+				if _, err := p.AddDerived(outFile, desc, path, parser.DatasetOptions(path, abSheetName, abSheetIndex, opt)); err != nil {
 					return err
 				}
 				if err := p.Save(); err != nil {
@@ -2,9 +2,13 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	cfgpkg "github.com/KaramelBytes/docloom-cli/internal/config"
+	"github.com/KaramelBytes/docloom-cli/internal/redact"
+	"github.com/KaramelBytes/docloom-cli/internal/retrieval"
 	"github.com/spf13/cobra"
 )
 
@@ -38,9 +42,53 @@ var configShowCmd = &cobra.Command{
 		if cfg.RetrievalMinScore >= 0 {
 			fmt.Printf("retrieval_min_score: %.3f\n", cfg.RetrievalMinScore)
 		}
+		if cfg.RetrievalMode != "" {
+			fmt.Printf("retrieval_mode: %s\n", cfg.RetrievalMode)
+		}
+		if cfg.IndexFormat != "" {
+			fmt.Printf("index_format: %s\n", cfg.IndexFormat)
+		}
+		if cfg.IndexQuantization != "" {
+			fmt.Printf("index_quantization: %s\n", cfg.IndexQuantization)
+		}
 		fmt.Printf("max_tokens: %d\n", cfg.MaxTokens)
 		fmt.Printf("temperature: %.3f\n", cfg.Temperature)
 		fmt.Printf("projects_dir: %s\n", cfg.ProjectsDir)
+		if cfg.ProjectTokenLimit > 0 {
+			fmt.Printf("project_token_limit: %d\n", cfg.ProjectTokenLimit)
+		}
+		if cfg.ProjectWarnRatio > 0 {
+			fmt.Printf("project_warn_ratio: %.2f\n", cfg.ProjectWarnRatio)
+		}
+		if cfg.Redact || cfg.RedactLocal {
+			fmt.Printf("redact: %t\n", cfg.Redact)
+			fmt.Printf("redact_local: %t\n", cfg.RedactLocal)
+		}
+		if len(cfg.RedactDetectors) > 0 {
+			fmt.Printf("redact_detectors: %s\n", strings.Join(cfg.RedactDetectors, ", "))
+		}
+		if len(cfg.RedactRules) > 0 {
+			names := make([]string, 0, len(cfg.RedactRules))
+			for n := range cfg.RedactRules {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			fmt.Println("redact_rules:")
+			for _, n := range names {
+				fmt.Printf("  %s: %s\n", n, cfg.RedactRules[n])
+			}
+		}
+		if len(cfg.Workspaces) > 0 {
+			names := make([]string, 0, len(cfg.Workspaces))
+			for n := range cfg.Workspaces {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			fmt.Println("workspaces:")
+			for _, n := range names {
+				fmt.Printf("  %s: %s\n", n, strings.Join(cfg.Workspaces[n], ", "))
+			}
+		}
 		return nil
 	},
 }
@@ -95,6 +143,24 @@ var configSetCmd = &cobra.Command{
 				return fmt.Errorf("invalid float for retrieval_min_score: %v", val)
 			}
 			cfg.RetrievalMinScore = f
+		case "retrieval_mode":
+			mode, err := retrieval.ParseMode(val)
+			if err != nil {
+				return err
+			}
+			cfg.RetrievalMode = mode
+		case "index_format":
+			format, err := retrieval.ParseFormat(val)
+			if err != nil {
+				return err
+			}
+			cfg.IndexFormat = format
+		case "index_quantization":
+			quant, err := retrieval.ParseQuantization(val)
+			if err != nil {
+				return err
+			}
+			cfg.IndexQuantization = quant
 		case "max_tokens":
 			i, err := strconv.Atoi(val)
 			if err != nil {
@@ -109,7 +175,73 @@ var configSetCmd = &cobra.Command{
 			cfg.Temperature = f
 		case "projects_dir":
 			cfg.ProjectsDir = val
+		case "project_token_limit":
+			i, err := strconv.Atoi(val)
+			if err != nil || i < 0 {
+				return fmt.Errorf("invalid int for project_token_limit: %v", val)
+			}
+			cfg.ProjectTokenLimit = i
+		case "project_warn_ratio":
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil || f <= 0 || f > 1 {
+				return fmt.Errorf("invalid float for project_warn_ratio (use 0 < ratio <= 1): %v", val)
+			}
+			cfg.ProjectWarnRatio = f
+		case "redact", "redact_local":
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("invalid bool for %s: %v", key, val)
+			}
+			if key == "redact" {
+				cfg.Redact = b
+			} else {
+				cfg.RedactLocal = b
+			}
+		case "redact_detectors":
+			var names []string
+			for _, n := range strings.Split(val, ",") {
+				if n = strings.ToLower(strings.TrimSpace(n)); n != "" {
+					names = append(names, n)
+				}
+			}
+			if _, err := redact.New(redact.Options{Detectors: names}); err != nil {
+				return err
+			}
+			cfg.RedactDetectors = names
 		default:
+			// workspaces.<name> takes comma-separated projects; an empty value removes it.
+			if name, ok := strings.CutPrefix(key, "workspaces."); ok && name != "" {
+				var members []string
+				for _, m := range strings.Split(val, ",") {
+					if m = strings.TrimSpace(m); m != "" {
+						members = append(members, m)
+					}
+				}
+				if len(members) == 0 {
+					delete(cfg.Workspaces, name)
+				} else {
+					if cfg.Workspaces == nil {
+						cfg.Workspaces = map[string][]string{}
+					}
+					cfg.Workspaces[name] = members
+				}
+				break
+			}
+			// redact_rules.<name> takes a regular expression; an empty value removes it.
+			if name, ok := strings.CutPrefix(key, "redact_rules."); ok && name != "" {
+				if val == "" {
+					delete(cfg.RedactRules, name)
+					break
+				}
+				if _, err := redact.New(redact.Options{Rules: map[string]string{name: val}}); err != nil {
+					return err
+				}
+				if cfg.RedactRules == nil {
+					cfg.RedactRules = map[string]string{}
+				}
+				cfg.RedactRules[name] = val
+				break
+			}
 			return fmt.Errorf("unknown key: %s", key)
 		}
 		if err := cfgpkg.Save(cfg, cfgFile); err != nil {
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dedupeProjectName string
+	dedupeSimilarity  float64
+)
+
+var dedupeCmd = &cobra.Command{
+	Use:   "dedupe",
+	Short: "Report clusters of near-duplicate documents and their token cost",
+	Example: `  docloom dedupe -p myproj
+  docloom dedupe -p myproj --similarity 0.8`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if dedupeSimilarity <= 0 || dedupeSimilarity > 1 {
+			return fmt.Errorf("--similarity must be between 0 and 1")
+		}
+		projDir, err := projectDirFromFlag(dedupeProjectName)
+		if err != nil {
+			return err
+		}
+		p, err := project.LoadProject(projDir)
+		if err != nil {
+			return err
+		}
+		clusters, err := p.DuplicateClusters(dedupeSimilarity)
+		if err != nil {
+			return err
+		}
+		if len(clusters) == 0 {
+			fmt.Printf("✓ No near-duplicates found (similarity ≥ %.0f%%)\n", dedupeSimilarity*100)
+			return nil
+		}
+		total := 0
+		for i, c := range clusters {
+			fmt.Printf("Cluster %d: %d documents, ≈%d tokens (≈%d reclaimable by keeping only the first)\n",
+				i+1, len(c.Documents), c.Tokens(), c.Reclaimable())
+			for j, d := range c.Documents {
+				if j == 0 {
+					fmt.Printf("  - %s: %s (%d tokens)\n", d.ID, d.Name, d.Tokens)
+					continue
+				}
+				fmt.Printf("  - %s: %s (%d tokens, %.0f%% similar)\n", d.ID, d.Name, d.Tokens, c.Similarity[j]*100)
+			}
+			total += c.Reclaimable()
+		}
+		fmt.Printf("⚠ %d cluster(s) of near-duplicates; removing the extra copies would save ≈%d tokens\n", len(clusters), total)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dedupeCmd)
+	dedupeCmd.Flags().StringVarP(&dedupeProjectName, "project", "p", "", "project name")
+	dedupeCmd.Flags().Float64Var(&dedupeSimilarity, "similarity", project.DefaultSimilarityThreshold, "near-duplicate threshold between 0 and 1")
+}
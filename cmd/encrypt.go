@@ -0,0 +1,326 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/KaramelBytes/docloom-cli/internal/retrieval"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// Environment variables that supply the project secret non-interactively.
+const (
+	envPassphrase    = "DOCLOOM_PASSPHRASE"
+	envKeyFile       = "DOCLOOM_KEY_FILE"
+	envNewPassphrase = "DOCLOOM_NEW_PASSPHRASE"
+	envNewKeyFile    = "DOCLOOM_NEW_KEY_FILE"
+)
+
+var (
+	// Global key source flags
+	flagKeyFile      string
+	flagPassphraseFD int
+
+	pmNewKeyFile      string
+	pmNewPassphraseFD int
+	pmRotate          bool
+)
+
+// encryptedPaths are the project files sealed by 'project encrypt',
+// relative to the project directory.
+var encryptedPaths = []string{
+	"project.json",
+	project.BlobDirName,
+	project.HistoryDirName,
+	"dataset_summaries",
+	filepath.Base(retrieval.IndexPath("")),
+	filepath.Base(retrieval.BinaryIndexPath("")),
+	filepath.Base(retrieval.LexicalPath("")),
+}
+
+var projectEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt the project's documents, summaries, history and index at rest",
+	Long: `Encrypts project.json, the blob store, history snapshots, dataset_summaries/ and the retrieval index with AES-256-GCM.
+The key is protected by a passphrase (stretched with scrypt) or a key file. Supply it with --key-file or
+DOCLOOM_KEY_FILE, --passphrase-fd or DOCLOOM_PASSPHRASE, or type a passphrase when prompted. Every later
+command reads and writes the project transparently using the same sources.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireWritable(); err != nil {
+			return err
+		}
+		dir, err := projectDirFromFlag(pmProject)
+		if err != nil {
+			return err
+		}
+		var secret vault.Secret
+		if vault.IsEncrypted(dir) {
+			// Finish an interrupted run with the existing secret.
+			h, err := vault.ReadHeader(dir)
+			if err != nil {
+				return err
+			}
+			if secret, err = projectSecret(dir, h); err != nil {
+				return err
+			}
+		} else if secret, err = newSecret(flagKeyFile, flagPassphraseFD, envKeyFile, envPassphrase); err != nil {
+			return err
+		}
+		p, err := openConverting(dir)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		if err := vault.Encrypt(dir, secret, encryptedPaths); err != nil {
+			return err
+		}
+		fmt.Printf("🔒 Encrypted %s (%s)\n", p.Name, secretKind(secret))
+		return nil
+	},
+}
+
+var projectDecryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Decrypt an encrypted project back to plain files",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, secret, err := openEncryptedProject()
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		if err := vault.Decrypt(p.RootDir(), secret, encryptedPaths); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Decrypted %s\n", p.Name)
+		return nil
+	},
+}
+
+var projectRekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Change the passphrase or key file protecting an encrypted project",
+	Long: `Re-protects the project's data key with a new secret given by --new-key-file or DOCLOOM_NEW_KEY_FILE,
+--new-passphrase-fd or DOCLOOM_NEW_PASSPHRASE, or a prompt. Only the header changes unless --rotate is set,
+which also re-encrypts every file under a fresh data key. An interrupted rotation is finished by running
+rekey --rotate again with the new secret as the current one.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, current, err := openEncryptedProject()
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		next, err := newSecret(pmNewKeyFile, pmNewPassphraseFD, envNewKeyFile, envNewPassphrase)
+		if err != nil {
+			return err
+		}
+		if err := vault.Rekey(p.RootDir(), current, next, encryptedPaths, pmRotate); err != nil {
+			return err
+		}
+		msg := "new secret"
+		if pmRotate {
+			msg = "new secret and data key"
+		}
+		fmt.Printf("🔒 Rekeyed %s (%s, %s)\n", p.Name, msg, secretKind(next))
+		return nil
+	},
+}
+
+// openEncryptedProject resolves the current secret for the -p project and
+// opens it for update; callers must Close.
+func openEncryptedProject() (*project.Project, vault.Secret, error) {
+	if err := requireWritable(); err != nil {
+		return nil, vault.Secret{}, err
+	}
+	dir, err := projectDirFromFlag(pmProject)
+	if err != nil {
+		return nil, vault.Secret{}, err
+	}
+	h, err := vault.ReadHeader(dir)
+	if err != nil {
+		return nil, vault.Secret{}, err
+	}
+	secret, err := projectSecret(dir, h)
+	if err != nil {
+		return nil, vault.Secret{}, err
+	}
+	if err := vault.Unlock(dir, secret); err != nil {
+		return nil, vault.Secret{}, err
+	}
+	p, err := openConverting(dir)
+	if err != nil {
+		return nil, vault.Secret{}, err
+	}
+	return p, secret, nil
+}
+
+// openConverting opens the project at dir for update while plain files are
+// still accepted: encrypt, decrypt and rekey rewrite every file, so they must
+// be able to finish a run that was interrupted halfway.
+func openConverting(dir string) (*project.Project, error) {
+	defer vault.AllowPlain(dir)()
+	return openProjectForUpdate(dir)
+}
+
+var (
+	secretMu     sync.Mutex
+	fdPassphrase = map[int]string{}
+	// projectPassphrases remembers the passphrase that opened each project,
+	// by absolute directory, so watch can hand it to its child runs.
+	projectPassphrases = map[string]string{}
+)
+
+func projectPassphrase(dir string) (string, bool) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	pass, ok := projectPassphrases[absDir(dir)]
+	return pass, ok
+}
+
+func absDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
+
+// projectSecret is the vault secret source: the key file from --key-file or
+// DOCLOOM_KEY_FILE for key-file projects, otherwise a passphrase from
+// --passphrase-fd, DOCLOOM_PASSPHRASE or a terminal prompt.
+func projectSecret(dir string, h *vault.Header) (vault.Secret, error) {
+	if h.KDF == vault.KDFKeyFile {
+		path := keySourcePath(flagKeyFile, envKeyFile)
+		if path == "" {
+			return vault.Secret{}, fmt.Errorf("%s is encrypted with a key file; pass --key-file or set %s", dir, envKeyFile)
+		}
+		return readKeyFile(path)
+	}
+	pass, err := passphrase(flagPassphraseFD, envPassphrase, "Passphrase for "+dir+": ", false)
+	if err != nil {
+		return vault.Secret{}, err
+	}
+	secretMu.Lock()
+	projectPassphrases[absDir(dir)] = pass
+	secretMu.Unlock()
+	return vault.Secret{Passphrase: pass}, nil
+}
+
+// newSecret reads a secret for encrypt or rekey: a key file wins over a
+// passphrase, and a prompted passphrase must be typed twice.
+func newSecret(keyFile string, fd int, keyEnv, passEnv string) (vault.Secret, error) {
+	if path := keySourcePath(keyFile, keyEnv); path != "" {
+		return readKeyFile(path)
+	}
+	pass, err := passphrase(fd, passEnv, "New passphrase: ", true)
+	if err != nil {
+		return vault.Secret{}, err
+	}
+	return vault.Secret{Passphrase: pass}, nil
+}
+
+func keySourcePath(flag, env string) string {
+	if flag != "" {
+		return flag
+	}
+	return os.Getenv(env)
+}
+
+func readKeyFile(path string) (vault.Secret, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return vault.Secret{}, fmt.Errorf("read key file: %w", err)
+	}
+	if len(b) == 0 {
+		return vault.Secret{}, fmt.Errorf("key file %s is empty", path)
+	}
+	return vault.Secret{KeyFile: b}, nil
+}
+
+// passphrase reads from file descriptor fd (when > 0), then env, then the
+// terminal. A descriptor can only be read once, so its value is cached.
+func passphrase(fd int, env, prompt string, confirm bool) (string, error) {
+	if fd > 0 {
+		secretMu.Lock()
+		defer secretMu.Unlock()
+		if pass, ok := fdPassphrase[fd]; ok {
+			return pass, nil
+		}
+		b, err := io.ReadAll(os.NewFile(uintptr(fd), "passphrase-fd"))
+		if err != nil {
+			return "", fmt.Errorf("read passphrase from fd %d: %w", fd, err)
+		}
+		pass := strings.TrimRight(string(b), "\r\n")
+		if pass == "" {
+			return "", fmt.Errorf("empty passphrase on fd %d", fd)
+		}
+		fdPassphrase[fd] = pass
+		return pass, nil
+	}
+	if pass := os.Getenv(env); pass != "" {
+		return pass, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("a passphrase is required: set %s or use a passphrase fd or key file", env)
+	}
+	pass, err := readPassword(prompt)
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		again, err := readPassword("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != pass {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return pass, nil
+}
+
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read passphrase: %w", err)
+	}
+	if len(b) == 0 {
+		return "", errors.New("empty passphrase")
+	}
+	return string(b), nil
+}
+
+func secretKind(s vault.Secret) string {
+	if len(s.KeyFile) > 0 {
+		return "key file"
+	}
+	return "passphrase"
+}
+
+func init() {
+	vault.SetSecretSource(projectSecret)
+
+	rootCmd.PersistentFlags().StringVar(&flagKeyFile, "key-file", "", "key file for encrypted projects (or set "+envKeyFile+")")
+	rootCmd.PersistentFlags().IntVar(&flagPassphraseFD, "passphrase-fd", 0, "read the passphrase for encrypted projects from this file descriptor (or set "+envPassphrase+")")
+
+	projectCmd.AddCommand(projectEncryptCmd)
+	projectCmd.AddCommand(projectDecryptCmd)
+	projectCmd.AddCommand(projectRekeyCmd)
+	for _, c := range []*cobra.Command{projectEncryptCmd, projectDecryptCmd, projectRekeyCmd} {
+		c.Flags().StringVarP(&pmProject, "project", "p", "", "project name")
+	}
+	projectRekeyCmd.Flags().StringVar(&pmNewKeyFile, "new-key-file", "", "key file to protect the project with (or set "+envNewKeyFile+")")
+	projectRekeyCmd.Flags().IntVar(&pmNewPassphraseFD, "new-passphrase-fd", 0, "read the new passphrase from this file descriptor (or set "+envNewPassphrase+")")
+	projectRekeyCmd.Flags().BoolVar(&pmRotate, "rotate", false, "also re-encrypt every file under a fresh data key")
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/KaramelBytes/docloom-cli/internal/bundle"
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/spf13/cobra"
+)
+
+var (
+	expProjectName  string
+	expOutput       string
+	expStripIndex   bool
+	expStripContent bool
+	expDecrypt      bool
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export a project as a portable .docloom.tgz bundle",
+	Long: `Packs project.json, dataset summaries, prompt templates and the retrieval index into a
+gzipped tar with a manifest (format version and SHA-256 checksums). Absolute document paths
+are rewritten: files inside the project become project-relative, other files keep only
+their name as provenance.
+
+An encrypted project is refused unless --decrypt is given, which writes its content in
+plain text; the bundle carries no key and can be imported anywhere.`,
+	Example: `  docloom export -p myproj -o myproj.docloom.tgz
+  docloom export -p myproj -o slim.docloom.tgz --strip-index --strip-content`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projDir, err := projectDirFromFlag(expProjectName)
+		if err != nil {
+			return err
+		}
+		out := expOutput
+		if out == "" {
+			name := expProjectName
+			if name == "" {
+				p, err := project.LoadProject(projDir)
+				if err != nil {
+					return err
+				}
+				name = p.Name
+			}
+			out = name + bundle.Extension
+		}
+		m, err := bundle.ExportToFile(projDir, out, bundle.ExportOptions{
+			StripIndex:   expStripIndex,
+			StripContent: expStripContent,
+			Decrypt:      expDecrypt,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Exported %s to %s (%d files, format v%d)\n", m.Project, out, len(m.Files), m.FormatVersion)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVarP(&expProjectName, "project", "p", "", "project name")
+	exportCmd.Flags().StringVarP(&expOutput, "output", "o", "", "bundle path (default <project>"+bundle.Extension+")")
+	exportCmd.Flags().BoolVar(&expStripIndex, "strip-index", false, "leave out the retrieval index (rebuilt on the next --retrieval run)")
+	exportCmd.Flags().BoolVar(&expStripContent, "strip-content", false, "leave out cached document content (metadata and summaries only)")
+	exportCmd.Flags().BoolVar(&expDecrypt, "decrypt", false, "export an encrypted project in plain text")
+}
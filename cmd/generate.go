@@ -5,12 +5,14 @@ import (
 	"crypto/sha1"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/KaramelBytes/docloom-cli/internal/ai"
 	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/KaramelBytes/docloom-cli/internal/redact"
 	"github.com/KaramelBytes/docloom-cli/internal/utils"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -34,23 +36,33 @@ func (f embedFunc) Embed(ctx context.Context, texts []string) ([][]float32, erro
 }
 
 var (
-	genProjectName string
-	genModel       string
-	genModelPreset string
-	genProvider    string
-	genMaxTokens   int
-	genTemp        float64
-	genDryRun      bool
-	genQuiet       bool
-	genJSON        bool
-	genPrintPrompt bool
-	genPromptLimit int
-	genBudgetLimit float64
-	genOutputPath  string
-	genOutputFmt   string
-	genStream      bool
-	genOllamaHost  string
-	genTimeoutSec  int
+	genProjectName    string
+	genProjects       []string
+	genWorkspace      string
+	genModel          string
+	genModelPreset    string
+	genProvider       string
+	genMaxTokens      int
+	genTemp           float64
+	genDryRun         bool
+	genQuiet          bool
+	genJSON           bool
+	genPrintPrompt    bool
+	genPromptLimit    int
+	genAllocate       string
+	genPromptTemplate string
+	genTasks          []string
+	genDocs           []string
+	genTags           []string
+	genExcludeTags    []string
+	genBudgetLimit    float64
+	genOutputPath     string
+	genOutputFmt      string
+	genStream         bool
+	genOllamaHost     string
+	genTimeoutSec     int
+	genRedact         bool
+	genFenceUntrusted bool
 	// Retrieval flags
 	genRetrieval       bool
 	genReindex         bool
@@ -58,6 +70,9 @@ var (
 	genEmbedProvider   string
 	genRetrievalTopK   int
 	genRetrievalMinSim float64
+	genRetrievalMode   string
+	genIndexFormat     string
+	genIndexQuant      string
 )
 
 var generateCmd = &cobra.Command{
@@ -66,18 +81,25 @@ var generateCmd = &cobra.Command{
 	Example: `  docloom generate -p myproj --dry-run
   docloom generate -p myproj --model openai/gpt-4o-mini --max-tokens 512
   docloom generate -p myproj --budget-limit 0.05 --prompt-limit 60000
-  docloom generate -p myproj --output out.md --format markdown`,
+  docloom generate -p myproj --output out.md --format markdown
+  docloom generate -p myproj --task summary,risks --output report.md
+  docloom generate -p myproj --tags spec --exclude-tags draft --dry-run
+  docloom generate --projects billing,payments --retrieval --dry-run
+  docloom generate -p myproj --retrieval-mode hybrid --top-k 8
+  docloom generate --workspace platform --task risks`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if genProjectName == "" {
-			return fmt.Errorf("--project is required")
-		}
-
 		if genJSON {
 			genQuiet = true
 		}
+		switch genAllocate {
+		case project.AllocateBySize, project.AllocateByPriority:
+		default:
+			return fmt.Errorf("unsupported --allocate: %s (use size|priority)", genAllocate)
+		}
 
 		// Ensure flags that can carry over between invocations are reset to defaults
 		// unless explicitly provided in THIS run. Use Visit to detect set flags in this parse.
+		redactSet := false
 		if f := cmd.Flags(); f != nil {
 			provided := map[string]bool{}
 			f.Visit(func(fl *pflag.Flag) {
@@ -107,15 +129,52 @@ var generateCmd = &cobra.Command{
 			if !provided["dry-run"] {
 				genDryRun = false
 			}
+			if !provided["prompt-template"] {
+				genPromptTemplate = ""
+			}
+			if !provided["allocate"] {
+				genAllocate = project.AllocateBySize
+			}
+			if !provided["task"] {
+				genTasks = nil
+			}
+			if !provided["docs"] {
+				genDocs = nil
+			}
+			if !provided["tags"] {
+				genTags = nil
+			}
+			if !provided["exclude-tags"] {
+				genExcludeTags = nil
+			}
+			if !provided["projects"] {
+				genProjects = nil
+			}
+			if !provided["workspace"] {
+				genWorkspace = ""
+			}
+			if !provided["fence-untrusted"] {
+				genFenceUntrusted = false
+			}
+			if !provided["retrieval-mode"] {
+				genRetrievalMode = ""
+			}
+			if !provided["index-format"] {
+				genIndexFormat = ""
+			}
+			if !provided["index-quantization"] {
+				genIndexQuant = ""
+			}
+			redactSet = provided["redact"]
 		}
+		redaction := redactionPolicyFor(cfg, redactSet, genRedact)
 
-		projDir, err := resolveProjectDirByName(genProjectName)
+		p, sources, err := loadWorkspace(cfg, genProjectName, genProjects, genWorkspace)
 		if err != nil {
 			return err
 		}
-		p, err := project.LoadProject(projDir)
-		if err != nil {
-			return err
+		if len(sources) > 1 && !genQuiet {
+			fmt.Printf("Workspace %s: %s (%d documents)\n", p.Name, strings.Join(p.Sources(), ", "), len(p.Documents))
 		}
 		// Apply provider-preset via explicit --provider (offline, no network)
 		providerUsed := ""
@@ -170,25 +229,61 @@ var generateCmd = &cobra.Command{
 				}
 			}
 		}
-		prompt, tokens, err := p.BuildPrompt()
+		selected, err := p.SelectedIDs(genSelection())
 		if err != nil {
 			return err
 		}
+		tasks := parseTaskList(genTasks)
+		// Render each task once up front so layout, task or empty-project errors
+		// surface before retrieval, and collect the instructions as the query.
+		queries := make([]string, 0, len(tasks))
+		for _, task := range tasks {
+			if _, err := p.BuildPromptWithOptions(project.PromptOptions{Layout: genPromptTemplate, Task: task, Selection: genSelection()}); err != nil {
+				return err
+			}
+			set, err := p.LookupInstructions(task)
+			if err != nil {
+				return err
+			}
+			queries = append(queries, set.Text)
+		}
 
-		prompt, tokens, err = prepareRetrievedContext(
+		// Screen what is about to be sent for prompt-injection attempts.
+		flagged, err := p.ScreenSelected(genSelection())
+		if err != nil {
+			return err
+		}
+		if !genQuiet && len(flagged) > 0 {
+			for _, d := range flagged {
+				printScreening(d)
+			}
+			if !genFenceUntrusted {
+				fmt.Println("  use --fence-untrusted to mark document content as untrusted in the prompt")
+			}
+		}
+
+		// Retrieval runs once so every task sees the same assembled context.
+		retrieved, err := retrieveWorkspaceChunks(
 			cmd.Context(),
-			p,
-			prompt,
-			tokens,
+			sources,
+			p.Instructions,
 			cfg,
 			retrievalOptions{
-				Enabled:       genRetrieval,
-				Reindex:       genReindex,
-				EmbedModel:    genEmbedModel,
-				EmbedProvider: genEmbedProvider,
-				TopK:          genRetrievalTopK,
-				MinScore:      genRetrievalMinSim,
-				OllamaHost:    genOllamaHost,
+				Enabled:           genRetrieval || genRetrievalMode != "",
+				Mode:              genRetrievalMode,
+				Reindex:           genReindex,
+				EmbedModel:        genEmbedModel,
+				EmbedProvider:     genEmbedProvider,
+				TopK:              genRetrievalTopK,
+				MinScore:          genRetrievalMinSim,
+				OllamaHost:        genOllamaHost,
+				Query:             strings.Join(queries, "\n\n"),
+				ReadOnly:          readOnly,
+				LockTimeout:       lockTimeout,
+				DocIDs:            selected,
+				Redaction:         redaction,
+				IndexFormat:       genIndexFormat,
+				IndexQuantization: genIndexQuant,
 			},
 			defaultRetrievalDeps,
 		)
@@ -196,245 +291,344 @@ var generateCmd = &cobra.Command{
 			return err
 		}
 
-		// Optional prompt cap/truncation before proceeding
-		if genPromptLimit > 0 && tokens > genPromptLimit {
-			if !genQuiet {
-				fmt.Printf("⚠ Prompt exceeds limit (%d > %d). Truncating before send...\n", tokens, genPromptLimit)
+		multi := len(tasks) > 1
+		for _, task := range tasks {
+			if multi && !genJSON {
+				fmt.Printf("\n=== Task: %s ===\n", task)
+			}
+			if err := runGenerateTask(p, task, retrieved, redaction, multi); err != nil {
+				if multi {
+					return fmt.Errorf("task %s: %w", task, err)
+				}
+				return err
 			}
-			prompt = utils.TruncateToTokenLimit(prompt, genPromptLimit)
-			tokens = utils.CountTokens(prompt)
-		}
-
-		model := selectModel(p, cfg, genModel)
-
-		maxTokens := genMaxTokens
-		if maxTokens == 0 && p.Config != nil && p.Config.MaxTokens > 0 {
-			maxTokens = p.Config.MaxTokens
 		}
-		if maxTokens == 0 {
-			maxTokens = 1024
+		if len(sources) == 1 && !readOnly && !genDryRun {
+			// Remembered for 'watch --generate' once the model has answered;
+			// failing to record never fails the run.
+			_ = recordLastGenerate(p.RootDir(), cmd.LocalFlags())
 		}
+		return nil
+	},
+}
 
-		temp := genTemp
-		if temp == 0 && p.Config != nil && p.Config.Temperature > 0 {
-			temp = p.Config.Temperature
-		}
-		if temp == 0 {
-			temp = 0.7
-		}
+// genSelection returns the document selection from --docs, --tags and --exclude-tags.
+func genSelection() project.Selection {
+	return project.Selection{Docs: genDocs, Tags: genTags, ExcludeTags: genExcludeTags}
+}
 
-		// Token breakdown
-		docsTokens := 0
-		for _, d := range p.Documents {
+// runGenerateTask builds the prompt for one instruction set over the shared
+// retrieved context and either previews it (--dry-run) or sends it. With
+// multi set, the task name is added to outputs so each task writes its own file.
+// When redaction applies, the prompt is redacted and the response restored.
+func runGenerateTask(p *project.Project, task string, retrieved []project.RetrievedChunk, redaction redactionPolicy, multi bool) error {
+	set, err := p.LookupInstructions(task)
+	if err != nil {
+		return err
+	}
+	promptOpts := project.PromptOptions{Layout: genPromptTemplate, Task: task, Retrieved: retrieved, Selection: genSelection(), FenceUntrusted: genFenceUntrusted}
+	var built *project.PromptResult
+	droppedChunks := 0
+	if genPromptLimit > 0 {
+		built, droppedChunks, err = fitPromptLimit(p, promptOpts, genPromptLimit, genAllocate)
+	} else {
+		built, err = p.BuildPromptWithOptions(promptOpts)
+	}
+	if err != nil {
+		return err
+	}
+	if !genQuiet && (droppedChunks > 0 || len(built.Truncated) > 0 || len(built.Dropped) > 0) {
+		fmt.Printf("⚠ Prompt exceeded --prompt-limit %d:\n", genPromptLimit)
+		if droppedChunks > 0 {
+			fmt.Printf("  - dropped %d lowest-ranked retrieved chunk(s)\n", droppedChunks)
+		}
+		for _, t := range built.Truncated {
+			fmt.Printf("  - %s: truncated %d tokens (%s allocation)\n", t.Document.Name, t.Removed, genAllocate)
+		}
+		if len(built.Dropped) > 0 {
+			names := make([]string, 0, len(built.Dropped))
+			for _, d := range built.Dropped {
+				names = append(names, d.Name)
+			}
+			fmt.Printf("⚠ Dropped %d low-priority document(s) to fit --prompt-limit: %s\n", len(names), strings.Join(names, ", "))
+		}
+	}
+	prompt, tokens := built.Text, built.Tokens
+	if genPromptLimit > 0 && tokens > genPromptLimit {
+		return fmt.Errorf("prompt needs %d tokens with every document trimmed, more than --prompt-limit %d: instructions and the task are never cut, so raise the limit or shorten them", tokens, genPromptLimit)
+	}
+
+	redactor, err := redaction.redactor(runtimeProvider(cfg, genProvider))
+	if err != nil {
+		return err
+	}
+	if redactor != nil {
+		prompt = redactor.Redact(prompt)
+		tokens = utils.CountTokens(prompt)
+		if genDryRun && !genQuiet {
+			printRedactionReport(redactor)
+		} else if !genQuiet && redactor.Count() > 0 {
+			fmt.Printf("🔒 Redacted %d sensitive value(s) before sending; the response is restored locally\n", redactor.Count())
+		}
+	}
+
+	model := selectModel(p, cfg, genModel)
+
+	maxTokens := genMaxTokens
+	if maxTokens == 0 && p.Config != nil && p.Config.MaxTokens > 0 {
+		maxTokens = p.Config.MaxTokens
+	}
+	if maxTokens == 0 {
+		maxTokens = 1024
+	}
+
+	temp := genTemp
+	if temp == 0 && p.Config != nil && p.Config.Temperature > 0 {
+		temp = p.Config.Temperature
+	}
+	if temp == 0 {
+		temp = 0.7
+	}
+
+	// Token breakdown
+	dropped := make(map[string]bool, len(built.Dropped))
+	for _, d := range built.Dropped {
+		dropped[d.ID] = true
+	}
+	docsTokens := 0
+	for _, d := range p.Documents {
+		if !dropped[d.ID] {
 			docsTokens += d.Tokens
 		}
-		instrTokens := utils.CountTokens(p.Instructions)
-		overhead := tokens - (docsTokens + instrTokens)
-		if overhead < 0 {
-			overhead = 0
-		}
+	}
+	instrTokens := utils.CountTokens(set.Text)
+	overhead := tokens - (docsTokens + instrTokens)
+	if overhead < 0 {
+		overhead = 0
+	}
+
+	if !genQuiet {
+		fmt.Printf("Tokens: total≈%d (instructions≈%d, docs≈%d, overhead≈%d)\n", tokens, instrTokens, docsTokens, overhead)
+	}
+
+	// Model metadata and pricing warnings
+	var estCost float64
+	if mi, ok := ai.LookupModel(model); ok {
+		fmt.Printf("DEBUG: Model: %s, ContextTokens: %d, tokens: %d, maxTokens: %d\n", mi.Name, mi.ContextTokens, tokens, maxTokens)
+		if !genDryRun && (tokens+maxTokens > mi.ContextTokens) {
+			msg := fmt.Sprintf("⚠ Prompt (%d tokens) + max-tokens (%d) exceeds %s context window (~%d tokens).\n",
+				tokens, maxTokens, mi.Name, mi.ContextTokens)
 
-		if !genQuiet {
-			fmt.Printf("Tokens: total≈%d (instructions≈%d, docs≈%d, overhead≈%d)\n", tokens, instrTokens, docsTokens, overhead)
-		}
-
-		// Model metadata and pricing warnings
-		var estCost float64
-		if mi, ok := ai.LookupModel(model); ok {
-			fmt.Printf("DEBUG: Model: %s, ContextTokens: %d, tokens: %d, maxTokens: %d\n", mi.Name, mi.ContextTokens, tokens, maxTokens)
-			if !genDryRun && (tokens+maxTokens > mi.ContextTokens) {
-				msg := fmt.Sprintf("⚠ Prompt (%d tokens) + max-tokens (%d) exceeds %s context window (~%d tokens).\n",
-					tokens, maxTokens, mi.Name, mi.ContextTokens)
+			if !genQuiet {
+				fmt.Print(msg)
+			}
 
-				if !genQuiet {
-					fmt.Print(msg)
+			{
+				_, providerName, err := buildRuntime(cfg, runtimeOptions{
+					ProviderFlag: genProvider,
+					OllamaHost:   genOllamaHost,
+				})
+				if err != nil {
+					return err
 				}
-
-				{
-					_, providerName, err := buildRuntime(cfg, runtimeOptions{
-						ProviderFlag: genProvider,
-						OllamaHost:   genOllamaHost,
-					})
-					if err != nil {
-						return err
+				if providerName == ai.ProviderOllama || providerName == "local" {
+					availableForPrompt := mi.ContextTokens - maxTokens
+					if availableForPrompt < 0 {
+						availableForPrompt = mi.ContextTokens / 2 // Conservative
 					}
-					if providerName == ai.ProviderOllama || providerName == "local" {
-						availableForPrompt := mi.ContextTokens - maxTokens
-						if availableForPrompt < 0 {
-							availableForPrompt = mi.ContextTokens / 2 // Conservative
-						}
-
-						return fmt.Errorf("context window exceeded for local model '%s'.\n"+
-							"  Required: %d tokens (prompt) + %d (max-tokens) = %d total\n"+
-							"  Available: %d tokens\n\n"+
-							"Solutions:\n"+
-							"  1. Use --prompt-limit %d to truncate the prompt\n"+
-							"  2. Enable retrieval mode with --retrieval to use only relevant chunks\n"+
-							"  3. Remove documents from project or reduce --max-rows for XLSX files\n"+
-							"  4. Use a model with larger context window",
-							model, tokens, maxTokens, tokens+maxTokens, mi.ContextTokens,
-							availableForPrompt)
-					}
-				}
-			}
-			if cost, ok := ai.EstimateCostUSD(model, tokens, maxTokens); ok {
-				estCost = cost
-				if !genQuiet {
-					fmt.Printf("Estimated max cost: ~$%.4f (in %.4f/out %.4f per 1K tokens)\n", cost, mi.InputPerK, mi.OutputPerK)
+
+					return fmt.Errorf("context window exceeded for local model '%s'.\n"+
+						"  Required: %d tokens (prompt) + %d (max-tokens) = %d total\n"+
+						"  Available: %d tokens\n\n"+
+						"Solutions:\n"+
+						"  1. Use --prompt-limit %d to truncate the prompt\n"+
+						"  2. Enable retrieval mode with --retrieval to use only relevant chunks\n"+
+						"  3. Remove documents from project or reduce --max-rows for XLSX files\n"+
+						"  4. Use a model with larger context window",
+						model, tokens, maxTokens, tokens+maxTokens, mi.ContextTokens,
+						availableForPrompt)
 				}
 			}
 		}
-
-		if err := enforceBudget(estCost, genBudgetLimit); err != nil {
-			return err
-		}
-
-		if genDryRun {
+		if cost, ok := ai.EstimateCostUSD(model, tokens, maxTokens); ok {
+			estCost = cost
 			if !genQuiet {
-				// Deterministic dry-run request id for observability
-				sum := sha1.Sum([]byte(prompt))
-				rid := fmt.Sprintf("sim_%x", sum[:6])
-				fmt.Println("\n--dry-run: no API call will be made. Prompt preview below --")
-				fmt.Printf("Request ID (dry-run): %s\n", rid)
-			}
-			fmt.Println(prompt)
-			return nil
-		}
-
-		if genPrintPrompt && !genQuiet {
-			fmt.Println("\n--print-prompt: sending the following prompt --")
-			fmt.Println(prompt)
+				fmt.Printf("Estimated max cost: ~$%.4f (in %.4f/out %.4f per 1K tokens)\n", cost, mi.InputPerK, mi.OutputPerK)
+			}
 		}
+	}
 
-		client, providerName, err := buildRuntime(cfg, runtimeOptions{
-			ProviderFlag: genProvider,
-			OllamaHost:   genOllamaHost,
-		})
-		if err != nil {
-			return err
-		}
+	if err := enforceBudget(estCost, genBudgetLimit); err != nil {
+		return err
+	}
 
-		// Request timeout
-		timeoutSec := genTimeoutSec
-		if timeoutSec <= 0 {
-			timeoutSec = 180
+	if genDryRun {
+		if !genQuiet {
+			// Deterministic dry-run request id for observability
+			sum := sha1.Sum([]byte(prompt))
+			rid := fmt.Sprintf("sim_%x", sum[:6])
+			fmt.Println("\n--dry-run: no API call will be made. Prompt preview below --")
+			fmt.Printf("Request ID (dry-run): %s\n", rid)
 		}
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSec)*time.Second)
-		defer cancel()
-
-		req := ai.GenerateRequest{
-			Model: model,
-			Messages: []ai.Message{
-				{Role: "user", Content: prompt},
-			},
-			MaxTokens:   maxTokens,
-			Temperature: temp,
+		fmt.Println(prompt)
+		return nil
+	}
+
+	if genPrintPrompt && !genQuiet {
+		fmt.Println("\n--print-prompt: sending the following prompt --")
+		fmt.Println(prompt)
+	}
+
+	client, providerName, err := buildRuntime(cfg, runtimeOptions{
+		ProviderFlag: genProvider,
+		OllamaHost:   genOllamaHost,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Request timeout
+	timeoutSec := genTimeoutSec
+	if timeoutSec <= 0 {
+		timeoutSec = 180
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSec)*time.Second)
+	defer cancel()
+
+	req := ai.GenerateRequest{
+		Model: model,
+		Messages: []ai.Message{
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens:   maxTokens,
+		Temperature: temp,
+	}
+
+	// Basic warning if prompt is very large relative to typical limits
+	if tokens > 100000 {
+		if !genQuiet {
+			fmt.Printf("⚠ Warning: very large prompt (≈%d tokens). Consider removing or truncating documents.\n", tokens)
 		}
-
-		// Basic warning if prompt is very large relative to typical limits
-		if tokens > 100000 {
-			if !genQuiet {
-				fmt.Printf("⚠ Warning: very large prompt (≈%d tokens). Consider removing or truncating documents.\n", tokens)
+	}
+	if genMaxTokens > 0 && (tokens+genMaxTokens) > 120000 {
+		if !genQuiet {
+			fmt.Printf("⚠ Warning: prompt + max-tokens (≈%d) may exceed common model context windows.\n", tokens+genMaxTokens)
+		}
+	}
+
+	if !genQuiet {
+		fmt.Printf("⚙ Generating with model=%s (prompt tokens≈%d) ...\n", model, tokens)
+	}
+	var deltas io.Writer = os.Stdout
+	var restore *redact.RestoreWriter
+	if redactor != nil {
+		restore = redact.NewRestoreWriter(redactor, os.Stdout)
+		deltas = restore
+	}
+	handled, err := handleStreaming(ctx, client, req, streamingOptions{
+		Enabled:     genStream,
+		Quiet:       genQuiet,
+		PrintPrompt: genPrintPrompt,
+		Prompt:      prompt,
+		Writer:      os.Stdout,
+		DeltaWriter: deltas,
+	})
+	if restore != nil {
+		if ferr := restore.Flush(); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if handled {
+		return nil
+	}
+	resp, err := client.Generate(ctx, req)
+	if err != nil {
+		// Provide user-friendly hints for common error classes
+		var (
+			authErr *ai.AuthError
+			rlErr   *ai.RateLimitError
+			nfErr   *ai.ModelNotFoundError
+			brErr   *ai.BadRequestError
+			qErr    *ai.QuotaExceededError
+			sErr    *ai.ServerError
+			unreach *ai.UnreachableError
+		)
+		switch {
+		case errors.As(err, &unreach):
+			if providerName == ai.ProviderOllama {
+				return fmt.Errorf("Ollama not reachable at %s. Ensure Ollama is running (see https://ollama.com) and host is correct. You can set DOCLOOM_OLLAMA_HOST or config 'ollama_host'. Detail: %w", unreach.Host, err)
 			}
-		}
-		if genMaxTokens > 0 && (tokens+genMaxTokens) > 120000 {
-			if !genQuiet {
-				fmt.Printf("⚠ Warning: prompt + max-tokens (≈%d) may exceed common model context windows.\n", tokens+genMaxTokens)
+			return fmt.Errorf("endpoint unreachable. Check your network and provider settings: %w", err)
+		case errors.As(err, &authErr):
+			return fmt.Errorf("authentication failed: set OPENROUTER_API_KEY or add api_key in config (~/.docloom-cli/config.yaml): %w", err)
+		case errors.As(err, &rlErr):
+			if rlErr.RetryAfter > 0 {
+				return fmt.Errorf("rate limited, try again in ~%ds: %w", int(rlErr.RetryAfter.Seconds()), err)
 			}
-		}
-
-		if !genQuiet {
-			fmt.Printf("⚙ Generating with model=%s (prompt tokens≈%d) ...\n", model, tokens)
-		}
-		handled, err := handleStreaming(ctx, client, req, streamingOptions{
-			Enabled:     genStream,
-			Quiet:       genQuiet,
-			PrintPrompt: genPrintPrompt,
-			Prompt:      prompt,
-			Writer:      os.Stdout,
-			DeltaWriter: os.Stdout,
-		})
-		if err != nil {
-			return err
-		}
-		if handled {
-			return nil
-		}
-		resp, err := client.Generate(ctx, req)
-		if err != nil {
-			// Provide user-friendly hints for common error classes
-			var (
-				authErr *ai.AuthError
-				rlErr   *ai.RateLimitError
-				nfErr   *ai.ModelNotFoundError
-				brErr   *ai.BadRequestError
-				qErr    *ai.QuotaExceededError
-				sErr    *ai.ServerError
-				unreach *ai.UnreachableError
-			)
-			switch {
-			case errors.As(err, &unreach):
-				if providerName == ai.ProviderOllama {
-					return fmt.Errorf("Ollama not reachable at %s. Ensure Ollama is running (see https://ollama.com) and host is correct. You can set DOCLOOM_OLLAMA_HOST or config 'ollama_host'. Detail: %w", unreach.Host, err)
-				}
-				return fmt.Errorf("endpoint unreachable. Check your network and provider settings: %w", err)
-			case errors.As(err, &authErr):
-				return fmt.Errorf("authentication failed: set OPENROUTER_API_KEY or add api_key in config (~/.docloom-cli/config.yaml): %w", err)
-			case errors.As(err, &rlErr):
-				if rlErr.RetryAfter > 0 {
-					return fmt.Errorf("rate limited, try again in ~%ds: %w", int(rlErr.RetryAfter.Seconds()), err)
-				}
-				return fmt.Errorf("rate limited by provider, please retry: %w", err)
-			case errors.As(err, &nfErr):
-				if providerName == ai.ProviderOllama {
-					return fmt.Errorf("local model not available (%s). Install it with 'ollama pull %s' or choose another model. %w", model, model, err)
-				}
-				return fmt.Errorf("model not found (%s). Verify the model name or sync catalog via 'docloom models fetch' or 'docloom models show': %w", model, err)
-			case errors.As(err, &brErr):
-				// Check if prompt was very large
-				if tokens > 50000 {
-					return fmt.Errorf("request invalid: prompt is very large (%d tokens).\n"+
-						"  This often happens with multiple XLSX files in a project.\n"+
-						"  Try: --retrieval mode (processes only relevant chunks), or reduce documents",
-						tokens)
-				}
-				return fmt.Errorf("request invalid. Try reducing prompt size or max-tokens: %w", err)
-			case errors.As(err, &qErr):
-				return fmt.Errorf("quota/billing issue. Check your provider account: %w", err)
-			case errors.As(err, &sErr):
-				return fmt.Errorf("provider appears unavailable (server error). Please retry later: %w", err)
-			default:
-				return fmt.Errorf("generation failed: %w", err)
+			return fmt.Errorf("rate limited by provider, please retry: %w", err)
+		case errors.As(err, &nfErr):
+			if providerName == ai.ProviderOllama {
+				return fmt.Errorf("local model not available (%s). Install it with 'ollama pull %s' or choose another model. %w", model, model, err)
 			}
-		}
-		if len(resp.Choices) == 0 {
-			return fmt.Errorf("no content returned from model")
-		}
-		if resp.RequestID != "" {
-			fmt.Printf("Request ID: %s\n", resp.RequestID)
-		}
-		content := resp.Choices[0].Message.Content
-		if err := formatAndWriteOutput(content, outputOptions{
-			JSON:         genJSON,
-			Quiet:        genQuiet,
-			Project:      genProjectName,
-			Model:        model,
-			MaxTokens:    maxTokens,
-			Temperature:  temp,
-			PromptTokens: tokens,
-			OutputPath:   genOutputPath,
-			OutputFormat: genOutputFmt,
-			Writer:       os.Stdout,
-		}); err != nil {
-			return err
-		}
-		return nil
-	},
+			return fmt.Errorf("model not found (%s). Verify the model name or sync catalog via 'docloom models fetch' or 'docloom models show': %w", model, err)
+		case errors.As(err, &brErr):
+			// Check if prompt was very large
+			if tokens > 50000 {
+				return fmt.Errorf("request invalid: prompt is very large (%d tokens).\n"+
+					"  This often happens with multiple XLSX files in a project.\n"+
+					"  Try: --retrieval mode (processes only relevant chunks), or reduce documents",
+					tokens)
+			}
+			return fmt.Errorf("request invalid. Try reducing prompt size or max-tokens: %w", err)
+		case errors.As(err, &qErr):
+			return fmt.Errorf("quota/billing issue. Check your provider account: %w", err)
+		case errors.As(err, &sErr):
+			return fmt.Errorf("provider appears unavailable (server error). Please retry later: %w", err)
+		default:
+			return fmt.Errorf("generation failed: %w", err)
+		}
+	}
+	if len(resp.Choices) == 0 {
+		return fmt.Errorf("no content returned from model")
+	}
+	if resp.RequestID != "" {
+		fmt.Printf("Request ID: %s\n", resp.RequestID)
+	}
+	content := resp.Choices[0].Message.Content
+	if redactor != nil {
+		content = redactor.Restore(content)
+	}
+	projectLabel := p.Name
+	outPath := genOutputPath
+	if multi {
+		outPath = taskOutputPath(genOutputPath, task)
+	}
+	if err := formatAndWriteOutput(content, outputOptions{
+		JSON:         genJSON,
+		Task:         task,
+		Quiet:        genQuiet,
+		Project:      projectLabel,
+		Model:        model,
+		MaxTokens:    maxTokens,
+		Temperature:  temp,
+		PromptTokens: tokens,
+		OutputPath:   outPath,
+		OutputFormat: genOutputFmt,
+		Writer:       os.Stdout,
+	}); err != nil {
+		return err
+	}
+	return nil
 }
 
 func init() {
 	rootCmd.AddCommand(generateCmd)
 	generateCmd.Flags().StringVarP(&genProjectName, "project", "p", "", "project name")
+	generateCmd.Flags().StringSliceVar(&genProjects, "projects", nil, "query several projects together (comma-separated); -p, if given, comes first and supplies instructions and config")
+	generateCmd.Flags().StringVar(&genWorkspace, "workspace", "", "query a named group of projects from the workspaces config")
 	generateCmd.Flags().StringVar(&genModel, "model", "", "override model (default from project config)")
 	generateCmd.Flags().StringVar(&genModelPreset, "model-preset", "", "apply preset: provider catalog (openrouter|openai|anthropic|google|gemini|meta|llama) or tier (cheap|balanced|high-context) or <provider>:<tier>")
 	generateCmd.Flags().StringVar(&genProvider, "provider", "", "explicit provider to merge catalog and guide tier selection (openrouter|openai|anthropic|google|gemini|meta|llama)")
@@ -442,7 +636,13 @@ func init() {
 	generateCmd.Flags().Float64Var(&genTemp, "temp", 0, "sampling temperature")
 	generateCmd.Flags().BoolVar(&genDryRun, "dry-run", false, "build prompt and print token breakdown without calling the API")
 	generateCmd.Flags().BoolVar(&genPrintPrompt, "print-prompt", false, "print the prompt being sent to the API")
-	generateCmd.Flags().IntVar(&genPromptLimit, "prompt-limit", 0, "truncate built prompt to this many tokens before sending")
+	generateCmd.Flags().IntVar(&genPromptLimit, "prompt-limit", 0, "fit the built prompt into this many tokens by dropping retrieved chunks, then truncating documents (instructions and task are kept)")
+	generateCmd.Flags().StringVar(&genPromptTemplate, "prompt-template", "", "prompt layout: default|xml-tagged|minimal, a project template name, or a .tmpl file path")
+	generateCmd.Flags().StringSliceVar(&genTasks, "task", nil, "instruction set(s) to run, comma-separated; each task writes its own output (default: the default set)")
+	generateCmd.Flags().StringSliceVar(&genDocs, "docs", nil, "only use these documents (IDs, ID prefixes or names; comma-separated)")
+	generateCmd.Flags().StringSliceVar(&genTags, "tags", nil, "only use documents carrying any of these tags (comma-separated)")
+	generateCmd.Flags().StringSliceVar(&genExcludeTags, "exclude-tags", nil, "leave out documents carrying any of these tags (comma-separated)")
+	generateCmd.Flags().StringVar(&genAllocate, "allocate", project.AllocateBySize, "how --prompt-limit splits the budget across documents: size|priority")
 	generateCmd.Flags().Float64Var(&genBudgetLimit, "budget-limit", 0, "fail if estimated max cost (USD) exceeds this budget")
 	generateCmd.Flags().StringVar(&genOutputPath, "output", "", "optional path to write the response (skips in --dry-run)")
 	generateCmd.Flags().StringVar(&genOutputFmt, "format", "text", "output format: text|markdown|json")
@@ -451,6 +651,8 @@ func init() {
 	generateCmd.Flags().BoolVar(&genStream, "stream", false, "stream responses if supported by the provider")
 	generateCmd.Flags().StringVar(&genOllamaHost, "ollama-host", "", "override Ollama host (e.g., http://127.0.0.1:11434)")
 	generateCmd.Flags().IntVar(&genTimeoutSec, "timeout-sec", 180, "request timeout in seconds (default 180)")
+	generateCmd.Flags().BoolVar(&genFenceUntrusted, "fence-untrusted", false, "wrap document content and retrieved chunks in delimited untrusted blocks and tell the model not to follow instructions inside them")
+	generateCmd.Flags().BoolVar(&genRedact, "redact", false, "replace emails, phones, IBANs, cards, secrets and custom patterns with placeholders before sending (overrides the redact config; --redact=false disables)")
 	// Retrieval flags
 	generateCmd.Flags().BoolVar(&genRetrieval, "retrieval", false, "enable retrieval-augmented generation (RAG)")
 	generateCmd.Flags().BoolVar(&genReindex, "reindex", false, "rebuild the retrieval index before generation")
@@ -458,4 +660,7 @@ func init() {
 	generateCmd.Flags().StringVar(&genEmbedProvider, "embed-provider", "", "embedding provider: openrouter|ollama")
 	generateCmd.Flags().IntVar(&genRetrievalTopK, "top-k", 6, "number of chunks to retrieve for context")
 	generateCmd.Flags().Float64Var(&genRetrievalMinSim, "min-score", 0.0, "minimum cosine similarity threshold for retrieved chunks")
+	generateCmd.Flags().StringVar(&genRetrievalMode, "retrieval-mode", "", "retrieval ranking: vector (embeddings), lexical (BM25, no embedding provider) or hybrid (rank fusion of both); implies --retrieval")
+	generateCmd.Flags().StringVar(&genIndexFormat, "index-format", "", "retrieval index storage: binary (default; index.json is migrated) or json")
+	generateCmd.Flags().StringVar(&genIndexQuant, "index-quantization", "", "binary index vector encoding: float32, float16 or int8 (default: keep the current encoding)")
 }
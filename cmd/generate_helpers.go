@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -14,17 +15,32 @@ import (
 	cfgpkg "github.com/KaramelBytes/docloom-cli/internal/config"
 	"github.com/KaramelBytes/docloom-cli/internal/project"
 	"github.com/KaramelBytes/docloom-cli/internal/retrieval"
-	"github.com/KaramelBytes/docloom-cli/internal/utils"
 )
 
 type retrievalOptions struct {
-	Enabled       bool
+	Enabled bool
+	// Mode is retrieval.ModeVector, ModeLexical or ModeHybrid; empty uses
+	// config retrieval_mode, then vector.
+	Mode          string
 	Reindex       bool
 	EmbedModel    string
 	EmbedProvider string
 	TopK          int
 	MinScore      float64
 	OllamaHost    string
+	// Query is embedded to search the index; empty uses the default instructions.
+	Query string
+	// ReadOnly searches a freshly built in-memory index without writing index.json.
+	ReadOnly    bool
+	LockTimeout time.Duration
+	// DocIDs restricts search to the selected documents; nil searches all.
+	DocIDs map[string]bool
+	// Redaction decides whether chunk texts are redacted before embedding.
+	Redaction redactionPolicy
+	// IndexFormat and IndexQuantization override config index_format and
+	// index_quantization for the stored index.
+	IndexFormat       string
+	IndexQuantization string
 }
 
 type retrievalDeps struct {
@@ -37,59 +53,192 @@ var defaultRetrievalDeps = retrievalDeps{
 	buildIndex:  retrieval.BuildIndex,
 }
 
+// prepareRetrievedContext re-renders the prompt with retrieved chunks. The
+// original prompt is returned unchanged when retrieval is disabled or finds nothing.
 func prepareRetrievedContext(ctx context.Context, p *project.Project, prompt string, baseTokens int, cfg *cfgpkg.Global, opts retrievalOptions, deps retrievalDeps) (string, int, error) {
-	if !opts.Enabled {
+	chunks, err := retrieveChunks(ctx, p, cfg, opts, deps)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(chunks) == 0 {
 		return prompt, baseTokens, nil
 	}
+	res, err := p.BuildPromptWithOptions(project.PromptOptions{Retrieved: chunks})
+	if err != nil {
+		return "", 0, err
+	}
+	return res.Text, res.Tokens, nil
+}
 
-	provider := strings.ToLower(strings.TrimSpace(opts.EmbedProvider))
-	if provider == "" && cfg != nil && cfg.EmbeddingProvider != "" {
-		provider = strings.ToLower(cfg.EmbeddingProvider)
+// retrieveChunks refreshes the index and searches it with opts.Query (the
+// project instructions by default). It returns nil when retrieval is disabled or nothing matched.
+func retrieveChunks(ctx context.Context, p *project.Project, cfg *cfgpkg.Global, opts retrievalOptions, deps retrievalDeps) ([]project.RetrievedChunk, error) {
+	return retrieveWorkspaceChunks(ctx, []*project.Project{p}, p.Instructions, cfg, opts, deps)
+}
+
+// retrieveWorkspaceChunks refreshes and searches each source project's own
+// index with one query (embedded once unless the mode is lexical), then
+// fuses the hits by score into a single top-k list. With several sources
+// every chunk is labelled with its project. An empty opts.Query falls back
+// to instructions.
+func retrieveWorkspaceChunks(ctx context.Context, sources []*project.Project, instructions string, cfg *cfgpkg.Global, opts retrievalOptions, deps retrievalDeps) ([]project.RetrievedChunk, error) {
+	if !opts.Enabled {
+		return nil, nil
 	}
-	if provider == "" {
-		provider = ai.ProviderOpenRouter
+	mode, err := retrievalMode(cfg, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	embedModel := strings.TrimSpace(opts.EmbedModel)
-	if embedModel == "" && cfg != nil && cfg.EmbeddingModel != "" {
-		embedModel = cfg.EmbeddingModel
+	query := opts.Query
+	if query == "" {
+		query = instructions
 	}
-	if embedModel == "" {
-		if provider == ai.ProviderOllama {
-			embedModel = "nomic-embed-text"
-		} else {
-			embedModel = "openai/text-embedding-3-small"
+
+	// Lexical mode chunks and indexes locally; no embedder is needed.
+	provider, embedModel := embeddingSettings(cfg, opts)
+	var emb retrieval.Embedder
+	var vector []float32
+	if mode != retrieval.ModeLexical {
+		if deps.newEmbedder == nil {
+			deps.newEmbedder = defaultNewEmbedder
 		}
+		if emb, err = deps.newEmbedder(ctx, provider, embedModel, cfg, opts); err != nil {
+			return nil, fmt.Errorf("init embedder: %w", err)
+		}
+		if emb, err = opts.Redaction.embedder(emb, provider); err != nil {
+			return nil, err
+		}
+		vectors, err := emb.Embed(ctx, []string{query})
+		if err != nil || len(vectors) == 0 {
+			return nil, fmt.Errorf("embed query: %w", err)
+		}
+		vector = vectors[0]
 	}
+	buildOpts := indexBuildOptions(cfg, opts, provider, embedModel)
 
-	if deps.newEmbedder == nil {
-		deps.newEmbedder = defaultNewEmbedder
+	topK := opts.TopK
+	if topK <= 0 && cfg != nil && cfg.RetrievalTopK > 0 {
+		topK = cfg.RetrievalTopK
 	}
-	if deps.buildIndex == nil {
-		deps.buildIndex = retrieval.BuildIndex
+	if topK <= 0 {
+		topK = 6
 	}
 
-	emb, err := deps.newEmbedder(ctx, provider, embedModel, cfg, opts)
-	if err != nil {
-		return "", 0, fmt.Errorf("init embedder: %w", err)
+	minScore := opts.MinScore
+	if minScore <= 0 && cfg != nil {
+		minScore = cfg.RetrievalMinScore
+	}
+	if minScore < 0 {
+		minScore = 0
 	}
 
-	docs := make(map[string]struct{ Name, Content string }, len(p.Documents))
-	for id, d := range p.Documents {
-		docs[id] = struct{ Name, Content string }{Name: d.Name, Content: d.Content}
+	// Scores of different indexes are not comparable (BM25 statistics and
+	// fused ranks are per corpus), so several projects' rankings are merged
+	// by reciprocal rank fusion.
+	var rankings [][]retrieval.Record
+	projectOf := map[string]string{}
+	for _, p := range sources {
+		idx, err := refreshIndex(ctx, p, emb, buildOpts, deps)
+		if err != nil {
+			if len(sources) > 1 {
+				return nil, fmt.Errorf("build retrieval index for %s: %w", p.Name, err)
+			}
+			return nil, fmt.Errorf("build retrieval index: %w", err)
+		}
+		// Merged workspaces namespace document IDs by project.
+		docIDs := opts.DocIDs
+		if len(sources) > 1 {
+			docIDs = project.SourceIDs(docIDs, p.Name)
+		}
+		var hits []retrieval.Record
+		switch mode {
+		case retrieval.ModeLexical:
+			hits = idx.SearchLexical(idx.Lexical(p.RootDir()), query, topK, docIDs)
+		case retrieval.ModeHybrid:
+			hits = idx.SearchHybrid(idx.Lexical(p.RootDir()), vector, query, topK, minScore, docIDs)
+		default:
+			hits = idx.SearchDocs(vector, topK, minScore, docIDs)
+		}
+		if len(sources) > 1 {
+			for i := range hits {
+				hits[i].DocID = project.WorkspaceID(p.Name, hits[i].DocID)
+				projectOf[hits[i].DocID] = p.Name
+			}
+		}
+		rankings = append(rankings, hits)
+	}
+	hits := rankings[0]
+	if len(rankings) > 1 {
+		hits = retrieval.Fuse(topK, rankings...)
+	}
+	if len(hits) == 0 {
+		return nil, nil
+	}
+	chunks := make([]project.RetrievedChunk, len(hits))
+	for i, r := range hits {
+		chunks[i] = project.RetrievedChunk{DocID: r.DocID, DocName: r.DocName, ChunkID: r.ChunkID, Text: r.Text, Score: r.Score, Project: projectOf[r.DocID]}
 	}
+	for i := range chunks {
+		chunks[i].Rank = i + 1
+	}
+	return chunks, nil
+}
 
+// retrievalMode resolves the retrieval mode from opts, then config.
+func retrievalMode(cfg *cfgpkg.Global, opts retrievalOptions) (string, error) {
+	mode := opts.Mode
+	if mode == "" && cfg != nil {
+		mode = cfg.RetrievalMode
+	}
+	return retrieval.ParseMode(mode)
+}
+
+// embeddingSettings resolves the embedding provider and model from opts,
+// then config, then the provider's default model.
+func embeddingSettings(cfg *cfgpkg.Global, opts retrievalOptions) (provider, model string) {
+	provider = strings.ToLower(strings.TrimSpace(opts.EmbedProvider))
+	if provider == "" && cfg != nil && cfg.EmbeddingProvider != "" {
+		provider = strings.ToLower(cfg.EmbeddingProvider)
+	}
+	if provider == "" {
+		provider = ai.ProviderOpenRouter
+	}
+
+	model = strings.TrimSpace(opts.EmbedModel)
+	if model == "" && cfg != nil && cfg.EmbeddingModel != "" {
+		model = cfg.EmbeddingModel
+	}
+	if model == "" {
+		if provider == ai.ProviderOllama {
+			model = "nomic-embed-text"
+		} else {
+			model = "openai/text-embedding-3-small"
+		}
+	}
+	return provider, model
+}
+
+// indexBuildOptions returns the chunking and filtering settings for index builds.
+func indexBuildOptions(cfg *cfgpkg.Global, opts retrievalOptions, provider, model string) retrieval.BuildOptions {
 	buildOpts := retrieval.BuildOptions{
 		Force:           opts.Reindex,
 		EmbedProvider:   provider,
-		EmbedModel:      embedModel,
+		EmbedModel:      model,
 		ChunkMaxTokens:  400,
 		ChunkOverlap:    60,
 		Include:         nil,
 		Exclude:         nil,
 		MaxChunksPerDoc: 0,
+		ReadOnly:        opts.ReadOnly,
+		LockTimeout:     opts.LockTimeout,
+		Format:          indexFormat(cfg, opts.IndexFormat),
+		Quantization:    opts.IndexQuantization,
 	}
 	if cfg != nil {
+		if buildOpts.Quantization == "" {
+			buildOpts.Quantization = cfg.IndexQuantization
+		}
 		if len(cfg.RetrievalInclude) > 0 {
 			buildOpts.Include = cfg.RetrievalInclude
 		}
@@ -100,48 +249,89 @@ func prepareRetrievedContext(ctx context.Context, p *project.Project, prompt str
 			buildOpts.MaxChunksPerDoc = cfg.RetrievalMaxChunksPerDoc
 		}
 	}
+	return buildOpts
+}
 
-	idx, err := deps.buildIndex(ctx, emb, p.RootDir(), docs, buildOpts)
-	if err != nil {
-		return "", 0, fmt.Errorf("build retrieval index: %w", err)
-	}
-
-	vectors, err := emb.Embed(ctx, []string{p.Instructions})
-	if err != nil || len(vectors) == 0 {
-		return "", 0, fmt.Errorf("embed query: %w", err)
+// indexFormat resolves the stored index format from the flag, then config;
+// empty means the binary default.
+func indexFormat(cfg *cfgpkg.Global, flag string) string {
+	if flag == "" && cfg != nil {
+		return cfg.IndexFormat
 	}
+	return flag
+}
 
-	topK := opts.TopK
-	if topK <= 0 && cfg != nil && cfg.RetrievalTopK > 0 {
-		topK = cfg.RetrievalTopK
+// refreshIndex brings p's index up to date with its documents. Only
+// documents whose content changed are re-embedded.
+func refreshIndex(ctx context.Context, p *project.Project, emb retrieval.Embedder, buildOpts retrieval.BuildOptions, deps retrievalDeps) (*retrieval.Index, error) {
+	if deps.buildIndex == nil {
+		deps.buildIndex = retrieval.BuildIndex
 	}
-	if topK <= 0 {
-		topK = 6
+	docs := make(map[string]struct{ Name, Content string }, len(p.Documents))
+	for id, d := range p.Documents {
+		text, err := p.LoadContent(d)
+		if err != nil {
+			return nil, err
+		}
+		docs[id] = struct{ Name, Content string }{Name: d.Name, Content: text}
 	}
+	return deps.buildIndex(ctx, emb, p.RootDir(), docs, buildOpts)
+}
 
-	minScore := opts.MinScore
-	if minScore <= 0 && cfg != nil {
-		minScore = cfg.RetrievalMinScore
+// parseTaskList normalizes --task values; no tasks selects the default set.
+func parseTaskList(values []string) []string {
+	var tasks []string
+	seen := map[string]bool{}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		tasks = append(tasks, v)
 	}
-	if minScore < 0 {
-		minScore = 0
+	if len(tasks) == 0 {
+		return []string{project.DefaultInstructionSet}
 	}
+	return tasks
+}
 
-	records := idx.Search(vectors[0], topK, minScore)
-	if len(records) == 0 {
-		return prompt, baseTokens, nil
+// taskOutputPath derives a per-task output file, e.g. report.md -> report.risks.md.
+func taskOutputPath(path, task string) string {
+	if path == "" {
+		return ""
 	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + task + ext
+}
 
-	var sb strings.Builder
-	sb.WriteString("[RETRIEVED CONTEXT]\n")
-	for i, r := range records {
-		sb.WriteString(fmt.Sprintf("-- %d) %s (chunk %d) --\n", i+1, r.DocName, r.ChunkID))
-		sb.WriteString(r.Text)
-		sb.WriteString("\n\n")
+// fitPromptLimit builds the prompt within limit tokens. Retrieved chunks are
+// dropped first, lowest-ranked first, so documents are only trimmed (split by
+// allocation) when the prompt is over the limit without any chunks. It
+// returns the number of chunks dropped; the result may still exceed limit
+// when instructions and the task alone do.
+func fitPromptLimit(p *project.Project, opts project.PromptOptions, limit int, allocation string) (*project.PromptResult, int, error) {
+	retrieved := len(opts.Retrieved)
+	built, err := p.BuildPromptWithOptions(opts)
+	if err != nil {
+		return nil, 0, err
 	}
-
-	augmented := strings.Replace(prompt, "[REFERENCE DOCUMENTS]", sb.String()+"[REFERENCE DOCUMENTS]", 1)
-	return augmented, utils.CountTokens(augmented), nil
+	for len(opts.Retrieved) > 0 && built.Tokens > limit {
+		opts.Retrieved = opts.Retrieved[:len(opts.Retrieved)-1]
+		if built, err = p.BuildPromptWithOptions(opts); err != nil {
+			return nil, 0, err
+		}
+	}
+	dropped := retrieved - len(opts.Retrieved)
+	if built.Tokens <= limit {
+		return built, dropped, nil
+	}
+	opts.TokenLimit = limit
+	opts.Allocation = allocation
+	if built, err = p.BuildPromptWithOptions(opts); err != nil {
+		return nil, 0, err
+	}
+	return built, dropped, nil
 }
 
 func defaultNewEmbedder(ctx context.Context, provider, model string, cfg *cfgpkg.Global, opts retrievalOptions) (retrieval.Embedder, error) {
@@ -191,6 +381,28 @@ type runtimeOptions struct {
 	OllamaHost   string
 }
 
+// runtimeProvider resolves the generation provider from --provider and the
+// config default: ai.ProviderOllama or ai.ProviderOpenRouter.
+func runtimeProvider(cfg *cfgpkg.Global, flag string) string {
+	providerName := strings.ToLower(strings.TrimSpace(flag))
+	if providerName == "" && cfg != nil && cfg.DefaultProvider != "" {
+		providerName = strings.ToLower(cfg.DefaultProvider)
+	}
+	if providerName == "" {
+		providerName = ai.ProviderOpenRouter
+	}
+
+	switch providerName {
+	case "local":
+		providerName = ai.ProviderOllama
+	case "openai", "anthropic", "google", "gemini", "meta", "llama":
+		providerName = ai.ProviderOpenRouter
+	case "ollama":
+		providerName = ai.ProviderOllama
+	}
+	return providerName
+}
+
 func buildRuntime(cfg *cfgpkg.Global, opts runtimeOptions) (ai.Runtime, string, error) {
 	httpTimeout := 60 * time.Second
 	retryMax := 3
@@ -211,22 +423,7 @@ func buildRuntime(cfg *cfgpkg.Global, opts runtimeOptions) (ai.Runtime, string,
 		}
 	}
 
-	providerName := strings.ToLower(strings.TrimSpace(opts.ProviderFlag))
-	if providerName == "" && cfg != nil && cfg.DefaultProvider != "" {
-		providerName = strings.ToLower(cfg.DefaultProvider)
-	}
-	if providerName == "" {
-		providerName = ai.ProviderOpenRouter
-	}
-
-	switch providerName {
-	case "local":
-		providerName = ai.ProviderOllama
-	case "openai", "anthropic", "google", "gemini", "meta", "llama":
-		providerName = ai.ProviderOpenRouter
-	case "ollama":
-		providerName = ai.ProviderOllama
-	}
+	providerName := runtimeProvider(cfg, opts.ProviderFlag)
 
 	apiKey := os.Getenv("OPENROUTER_API_KEY")
 	if apiKey == "" && cfg != nil && cfg.APIKey != "" {
@@ -345,6 +542,7 @@ func handleStreaming(ctx context.Context, runtime ai.Runtime, req ai.GenerateReq
 
 type outputOptions struct {
 	JSON         bool
+	Task         string
 	Quiet        bool
 	Project      string
 	Model        string
@@ -371,6 +569,9 @@ func formatAndWriteOutput(content string, opts outputOptions) error {
 			"prompt_tokens": opts.PromptTokens,
 			"content":       content,
 		}
+		if opts.Task != "" {
+			out["task"] = opts.Task
+		}
 		b, err := json.MarshalIndent(out, "", "  ")
 		if err != nil {
 			return fmt.Errorf("marshal output: %w", err)
@@ -403,6 +604,9 @@ func formatAndWriteOutput(content string, opts outputOptions) error {
 			"prompt_tokens": opts.PromptTokens,
 			"content":       content,
 		}
+		if opts.Task != "" {
+			out["task"] = opts.Task
+		}
 		b, err := json.MarshalIndent(out, "", "  ")
 		if err != nil {
 			return fmt.Errorf("marshal output: %w", err)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -240,3 +241,169 @@ func TestHandleStreamingErrorPropagation(t *testing.T) {
 		t.Fatal("expected handled to be true even on error")
 	}
 }
+
+func TestParseTaskListAndOutputPath(t *testing.T) {
+	if got := parseTaskList(nil); len(got) != 1 || got[0] != project.DefaultInstructionSet {
+		t.Fatalf("expected default task, got %v", got)
+	}
+	if got := parseTaskList([]string{"a", " b", "a", ""}); strings.Join(got, ",") != "a,b" {
+		t.Fatalf("unexpected tasks: %v", got)
+	}
+	if got := taskOutputPath("out/report.md", "risks"); got != "out/report.risks.md" {
+		t.Fatalf("unexpected output path: %s", got)
+	}
+	if got := taskOutputPath("", "risks"); got != "" {
+		t.Fatalf("empty output path should stay empty, got %s", got)
+	}
+}
+
+func TestRetrieveWorkspaceChunksFusesByRank(t *testing.T) {
+	root := t.TempDir()
+	billing := project.NewProject("billing", "", filepath.Join(root, "billing"))
+	billing.Documents["b1"] = &project.Document{ID: "b1", Name: "invoices.md", Content: "invoices"}
+	payments := project.NewProject("payments", "", filepath.Join(root, "payments"))
+	payments.Documents["p1"] = &project.Document{ID: "p1", Name: "refunds.md", Content: "refunds"}
+
+	// Both billing chunks score above every payments chunk, but raw scores of
+	// different indexes are not compared: each project's best chunk wins.
+	indexes := map[string]*retrieval.Index{
+		billing.RootDir(): {Records: []retrieval.Record{
+			{DocID: "b1", DocName: "invoices.md", ChunkID: 0, Text: "billing-best", Vector: []float32{1, 0}},
+			{DocID: "b1", DocName: "invoices.md", ChunkID: 1, Text: "billing-next", Vector: []float32{0.95, 0.05}},
+		}},
+		payments.RootDir(): {Records: []retrieval.Record{
+			{DocID: "p1", DocName: "refunds.md", ChunkID: 0, Text: "payments-best", Vector: []float32{0.6, 0.4}},
+			{DocID: "p1", DocName: "refunds.md", ChunkID: 1, Text: "payments-far", Vector: []float32{0.1, 0.9}},
+		}},
+	}
+	deps := retrievalDeps{
+		newEmbedder: func(context.Context, string, string, *cfgpkg.Global, retrievalOptions) (retrieval.Embedder, error) {
+			return embedFunc(func(context.Context, []string) ([][]float32, error) {
+				return [][]float32{{1, 0}}, nil
+			}), nil
+		},
+		buildIndex: func(_ context.Context, _ retrieval.Embedder, root string, _ map[string]struct{ Name, Content string }, _ retrieval.BuildOptions) (*retrieval.Index, error) {
+			return indexes[root], nil
+		},
+	}
+
+	chunks, err := retrieveWorkspaceChunks(context.Background(), []*project.Project{billing, payments}, "q", nil, retrievalOptions{Enabled: true, TopK: 2}, deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("expected top 2 across projects, got %+v", chunks)
+	}
+	if chunks[0].Text != "billing-best" || chunks[0].Project != "billing" || chunks[0].Rank != 1 {
+		t.Fatalf("unexpected first hit: %+v", chunks[0])
+	}
+	if chunks[1].Text != "payments-best" || chunks[1].Project != "payments" || chunks[1].Rank != 2 {
+		t.Fatalf("unexpected second hit: %+v", chunks[1])
+	}
+
+	// A selection holds merged IDs, namespaced by project.
+	only := retrievalOptions{Enabled: true, TopK: 2, DocIDs: map[string]bool{project.WorkspaceID("billing", "b1"): true}}
+	chunks, err = retrieveWorkspaceChunks(context.Background(), []*project.Project{billing, payments}, "q", nil, only, deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 || chunks[0].Project != "billing" || chunks[0].DocID != "billing:b1" {
+		t.Fatalf("expected only billing hits, got %+v", chunks)
+	}
+}
+
+func TestRetrieveChunksModes(t *testing.T) {
+	p := project.NewProject("support", "", filepath.Join(t.TempDir(), "support"))
+	p.Documents["d1"] = &project.Document{ID: "d1", Name: "faq.md", Content: "faq"}
+	idx := &retrieval.Index{Records: []retrieval.Record{
+		{DocID: "d1", DocName: "faq.md", ChunkID: 0, Text: "General troubleshooting for license problems.", Vector: []float32{1, 0}},
+		{DocID: "d1", DocName: "faq.md", ChunkID: 1, Text: "ERR-4021 means the license server is unreachable.", Vector: []float32{0.2, 0.8}},
+		{DocID: "d1", DocName: "faq.md", ChunkID: 2, Text: "Billing questions go to finance.", Vector: []float32{0.6, 0.4}},
+	}}
+	var embedded bool
+	deps := retrievalDeps{
+		newEmbedder: func(context.Context, string, string, *cfgpkg.Global, retrievalOptions) (retrieval.Embedder, error) {
+			embedded = true
+			return embedFunc(func(context.Context, []string) ([][]float32, error) {
+				return [][]float32{{1, 0}}, nil
+			}), nil
+		},
+		buildIndex: func(_ context.Context, emb retrieval.Embedder, _ string, _ map[string]struct{ Name, Content string }, _ retrieval.BuildOptions) (*retrieval.Index, error) {
+			if embedded != (emb != nil) {
+				t.Fatalf("embedder passed to the index build does not match the mode")
+			}
+			return idx, nil
+		},
+	}
+	run := func(mode string) []project.RetrievedChunk {
+		t.Helper()
+		embedded = false
+		chunks, err := retrieveChunks(context.Background(), p, nil, retrievalOptions{Enabled: true, Mode: mode, TopK: 2, Query: "What is ERR-4021?"}, deps)
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		return chunks
+	}
+
+	if chunks := run(retrieval.ModeVector); chunks[0].ChunkID != 0 {
+		t.Fatalf("vector mode should rank by cosine, got %+v", chunks)
+	}
+	chunks := run(retrieval.ModeLexical)
+	if embedded {
+		t.Fatal("lexical mode must not create an embedder")
+	}
+	if len(chunks) != 1 || chunks[0].ChunkID != 1 {
+		t.Fatalf("lexical mode should find only the exact error code, got %+v", chunks)
+	}
+	chunks = run(retrieval.ModeHybrid)
+	if len(chunks) != 2 || (chunks[0].ChunkID != 1 && chunks[1].ChunkID != 1) {
+		t.Fatalf("hybrid mode should include the exact match, got %+v", chunks)
+	}
+	if _, err := retrieveChunks(context.Background(), p, &cfgpkg.Global{RetrievalMode: "fuzzy"}, retrievalOptions{Enabled: true}, deps); err == nil {
+		t.Fatal("expected an invalid retrieval_mode to be rejected")
+	}
+}
+
+func TestFitPromptLimitDropsChunksBeforeTrimmingDocuments(t *testing.T) {
+	p := project.NewProject("fit", "", filepath.Join(t.TempDir(), "fit"))
+	p.SetInstructions("Summarize")
+	body := strings.Repeat("Pinned design decision. ", 40)
+	p.Documents["d1"] = &project.Document{ID: "d1", Name: "design.md", Content: body}
+	var chunks []project.RetrievedChunk
+	for i := 0; i < 3; i++ {
+		chunks = append(chunks, project.RetrievedChunk{DocID: "d1", DocName: "design.md", ChunkID: i, Rank: i + 1,
+			Text: fmt.Sprintf("chunk-%d ", i) + strings.Repeat("Retrieved context. ", 30)})
+	}
+	opts := project.PromptOptions{Retrieved: chunks}
+	full, err := p.BuildPromptWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oneChunk, err := p.BuildPromptWithOptions(project.PromptOptions{Retrieved: chunks[:1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oneChunk.Tokens >= full.Tokens {
+		t.Fatalf("test setup: %d >= %d", oneChunk.Tokens, full.Tokens)
+	}
+
+	built, dropped, err := fitPromptLimit(p, opts, oneChunk.Tokens, project.AllocateBySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 2 || len(built.Truncated) != 0 || len(built.Dropped) != 0 {
+		t.Fatalf("expected only the two lowest-ranked chunks dropped, got %d dropped, truncated %+v", dropped, built.Truncated)
+	}
+	if !strings.Contains(built.Text, strings.TrimSpace(body)) || !strings.Contains(built.Text, "chunk-0") || strings.Contains(built.Text, "chunk-1") {
+		t.Fatal("document must stay whole and the top chunk must be kept")
+	}
+
+	// Without room for the document, every chunk goes before it is trimmed.
+	built, dropped, err = fitPromptLimit(p, opts, oneChunk.Tokens/2, project.AllocateBySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 3 || len(built.Truncated) != 1 {
+		t.Fatalf("expected all chunks dropped and the document trimmed, got %d dropped, truncated %+v", dropped, built.Truncated)
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/KaramelBytes/docloom-cli/internal/bundle"
+	"github.com/spf13/cobra"
+)
+
+var impName string
+
+var importCmd = &cobra.Command{
+	Use:   "import <bundle>",
+	Short: "Import a project from a .docloom.tgz bundle",
+	Long: `Validates the bundle (manifest, format version, checksums, safe paths) before writing
+anything, then installs it into projects_dir. An existing project with the same name is
+never overwritten; use --name to import under another name.`,
+	Example: `  docloom import myproj.docloom.tgz
+  docloom import myproj.docloom.tgz --name myproj-review`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireWritable(); err != nil {
+			return err
+		}
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("open bundle: %w", err)
+		}
+		defer f.Close()
+		b, err := bundle.Read(f)
+		if err != nil {
+			return err
+		}
+		root, err := defaultProjectsDir()
+		if err != nil {
+			return err
+		}
+		dir, err := b.Install(root, impName)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Imported %s to %s (%d files)\n", b.Manifest.Project, dir, len(b.Manifest.Files))
+		if b.Manifest.IndexStripped {
+			fmt.Println("  Retrieval index not included; it is rebuilt on the next 'generate --retrieval'.")
+		}
+		if b.Manifest.ContentStripped {
+			fmt.Println("⚠ Document content was stripped on export; re-add documents before generating.")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVar(&impName, "name", "", "import under this project name (default: name in the bundle)")
+}
@@ -14,19 +14,47 @@ import (
 
 var (
 	initDescription string
+	initHere        bool
 )
 
 var initCmd = &cobra.Command{
 	Use:   "init <project-name>",
 	Short: "Initialize a new DocLoom project",
-	Args:  cobra.ExactArgs(1),
+	Long: `Creates a project under projects_dir. With --here the project is created in a .docloom/
+directory of the current directory instead (the name defaults to the directory's name).
+Commands run anywhere below that directory use it when -p is omitted, and document paths
+are stored relative to it, so the project can be committed next to the documents.`,
+	Example: `  docloom init myproj
+  cd ~/src/service && docloom init --here`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if initHere {
+			return cobra.MaximumNArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		name := args[0]
-		root, err := defaultProjectsDir()
-		if err != nil {
+		if err := requireWritable(); err != nil {
 			return err
 		}
-		projDir := filepath.Join(root, name)
+		var name, projDir string
+		if initHere {
+			wd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			name = filepath.Base(wd)
+			if len(args) > 0 {
+				name = args[0]
+			}
+			projDir = filepath.Join(wd, project.LocalDirName)
+		} else {
+			name = args[0]
+			root, err := defaultProjectsDir()
+			if err != nil {
+				return err
+			}
+			projDir = filepath.Join(root, name)
+		}
 		// Refuse to overwrite an existing project.
 		if info, err := os.Stat(projDir); err == nil && info.IsDir() {
 			projectFile := filepath.Join(projDir, "project.json")
@@ -50,6 +78,12 @@ var initCmd = &cobra.Command{
 		if err := p.Save(); err != nil {
 			return err
 		}
+		if initHere {
+			// Keep transient files out of version control.
+			if err := utils.SafeWriteFile(filepath.Join(projDir, ".gitignore"), []byte("*.lock\n*.tmp\n")); err != nil {
+				return err
+			}
+		}
 		fmt.Printf("✓ Project initialized: %s\n", projDir)
 		return nil
 	},
@@ -96,7 +130,25 @@ func resolveProjectDirByName(name string) (string, error) {
 	return filepath.Join(root, name), nil
 }
 
+// errNoProject is returned when -p is omitted outside any local project.
+var errNoProject = errors.New("--project is required (or run inside a directory with a local project, see 'docloom init --here')")
+
+// projectDirFromFlag resolves the project named by -p. Without a name it
+// falls back to the nearest project enclosing the working directory, the way
+// git finds its repository.
+func projectDirFromFlag(name string) (string, error) {
+	if name != "" {
+		return resolveProjectDirByName(name)
+	}
+	dir, err := utils.FindProjectRoot("")
+	if err != nil {
+		return "", errNoProject
+	}
+	return dir, nil
+}
+
 func init() {
 	rootCmd.AddCommand(initCmd)
 	initCmd.Flags().StringVarP(&initDescription, "desc", "d", "", "project description")
+	initCmd.Flags().BoolVar(&initHere, "here", false, "create the project in .docloom/ of the current directory")
 }
@@ -4,35 +4,79 @@ import (
 	"fmt"
 
 	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/KaramelBytes/docloom-cli/internal/templates"
 	"github.com/spf13/cobra"
 )
 
 var (
 	instrProjectName string
+	instrTemplate    string
+	instrSetName     string
+	instrVars        []string
 )
 
 var instructCmd = &cobra.Command{
-	Use:   "instruct <instructions>",
+	Use:   "instruct [instructions]",
 	Short: "Set or update project instructions",
-	Args:  cobra.ExactArgs(1),
+	Long: `Sets the project's instructions from a literal string or, with --template, from the
+instruction template library (see 'docloom templates list'). Template placeholders are
+filled with --var key=value; the template name and variables are stored on the project.
+
+A project can hold several named instruction sets (tasks). --name selects the set to
+write; without it the default set is updated. Run a set with 'generate --task <name>'.`,
+	Example: `  docloom instruct -p myproj "Summarize the key decisions"
+  docloom instruct -p myproj --template concise-summary --var bullets=3-5
+  docloom instruct -p myproj --name risks "List the top risks with mitigations"`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		text := args[0]
-		if instrProjectName == "" {
-			return fmt.Errorf("--project is required")
+		if instrTemplate == "" && len(args) == 0 {
+			return fmt.Errorf("provide instructions or --template")
+		}
+		if instrTemplate != "" && len(args) > 0 {
+			return fmt.Errorf("instructions and --template are mutually exclusive")
 		}
-		projDir, err := resolveProjectDirByName(instrProjectName)
+		if instrTemplate == "" && len(instrVars) > 0 {
+			return fmt.Errorf("--var requires --template")
+		}
+		projDir, err := projectDirFromFlag(instrProjectName)
 		if err != nil {
 			return err
 		}
-		p, err := project.LoadProject(projDir)
+		p, err := openProjectForUpdate(projDir)
 		if err != nil {
 			return err
 		}
-		p.SetInstructions(text)
+		defer p.Close()
+		if instrTemplate != "" {
+			vars, err := templates.ParseVars(instrVars)
+			if err != nil {
+				return err
+			}
+			t, err := templates.Get(instrTemplate)
+			if err != nil {
+				return err
+			}
+			text, err := t.Render(vars)
+			if err != nil {
+				return err
+			}
+			if err := p.SetInstructionSet(instrSetName, project.InstructionSet{Text: text, Template: t.Name, TemplateVars: vars}); err != nil {
+				return err
+			}
+		} else if err := p.SetInstructionSet(instrSetName, project.InstructionSet{Text: args[0]}); err != nil {
+			return err
+		}
 		if err := p.Save(); err != nil {
 			return err
 		}
-		fmt.Println("✓ Instructions updated")
+		msg := "✓ Instructions updated"
+		if instrSetName != "" {
+			msg += fmt.Sprintf(" (set %s)", instrSetName)
+		}
+		if instrTemplate != "" {
+			msg += fmt.Sprintf(" from template %s", instrTemplate)
+		}
+		fmt.Println(msg)
 		return nil
 	},
 }
@@ -40,4 +84,7 @@ var instructCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(instructCmd)
 	instructCmd.Flags().StringVarP(&instrProjectName, "project", "p", "", "project name")
+	instructCmd.Flags().StringVar(&instrSetName, "name", "", "instruction set (task) to update (default: the default set)")
+	instructCmd.Flags().StringVar(&instrTemplate, "template", "", "render instructions from a library template (see 'docloom templates list')")
+	instructCmd.Flags().StringArrayVar(&instrVars, "var", nil, "template variable as key=value (repeatable)")
 }
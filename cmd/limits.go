@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/KaramelBytes/docloom-cli/internal/ai"
+	cfgpkg "github.com/KaramelBytes/docloom-cli/internal/config"
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+)
+
+// responseReserve is the response budget generate uses when neither
+// --max-tokens nor the project sets one; the size cap leaves room for it.
+const responseReserve = 1024
+
+// projectSizeLimits derives the document token limits for p. Precedence:
+// retrieval-only projects are uncapped, then the project's token_limit, the
+// global project_token_limit, and finally the effective model's context
+// window less the response budget. Unknown models fall back to
+// project.DefaultTokenLimit.
+func projectSizeLimits(p *project.Project, c *cfgpkg.Global, force bool) project.SizeLimits {
+	if p.Config != nil && p.Config.RetrievalOnly {
+		return project.SizeLimits{Source: "retrieval-only project", Force: force}
+	}
+	ratio := project.DefaultWarnRatio
+	if c != nil && c.ProjectWarnRatio > 0 && c.ProjectWarnRatio <= 1 {
+		ratio = c.ProjectWarnRatio
+	}
+	l := project.DefaultSizeLimits()
+	switch {
+	case p.Config != nil && p.Config.TokenLimit > 0:
+		l.Max, l.Source = p.Config.TokenLimit, "project token_limit"
+	case c != nil && c.ProjectTokenLimit > 0:
+		l.Max, l.Source = c.ProjectTokenLimit, "global project_token_limit"
+	default:
+		model := selectModel(p, c, "")
+		if mi, ok := ai.LookupModel(model); ok && mi.ContextTokens > 0 {
+			reserve := responseReserve
+			if p.Config != nil && p.Config.MaxTokens > 0 {
+				reserve = p.Config.MaxTokens
+			}
+			if mi.ContextTokens > reserve {
+				l.Max = mi.ContextTokens - reserve
+				l.Source = fmt.Sprintf("%s context window less %d response tokens", model, reserve)
+			}
+		}
+	}
+	l.Warn = int(float64(l.Max) * ratio)
+	l.Force = force
+	return l
+}
+
+// printHeadroom reports how much of the project's limit the documents use.
+func printHeadroom(p *project.Project) {
+	l := p.SizeLimits()
+	used := p.TotalTokens()
+	if l.Max <= 0 {
+		fmt.Printf("Context: ≈%d document tokens (%s: no full-context cap)\n", used, l.Source)
+		return
+	}
+	if used > l.Max {
+		fmt.Printf("⚠ Context: ≈%d of %d tokens used (%s); over by ≈%d, use --retrieval when generating\n", used, l.Max, l.Source, used-l.Max)
+		return
+	}
+	fmt.Printf("Context: ≈%d of %d tokens used (%s); ≈%d left\n", used, l.Max, l.Source, l.Max-used)
+}
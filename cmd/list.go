@@ -2,10 +2,10 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
-	"sort"
+	"strings"
 
+	"github.com/KaramelBytes/docloom-cli/internal/bundle"
+	"github.com/KaramelBytes/docloom-cli/internal/injection"
 	"github.com/KaramelBytes/docloom-cli/internal/project"
 	"github.com/spf13/cobra"
 )
@@ -13,6 +13,8 @@ import (
 var (
 	listProjects bool
 	listDocs     bool
+	listInstr    bool
+	listArchived bool
 	listProjName string
 )
 
@@ -20,17 +22,19 @@ var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List projects or documents",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if listProjects == listDocs { // either both true or both false
-			return fmt.Errorf("specify exactly one of --projects or --docs")
+		modes := 0
+		for _, on := range []bool{listProjects, listDocs, listInstr} {
+			if on {
+				modes++
+			}
+		}
+		if modes != 1 {
+			return fmt.Errorf("specify exactly one of --projects, --docs or --instructions")
 		}
 		if listProjects {
 			return listAllProjects()
 		}
-		// list docs
-		if listProjName == "" {
-			return fmt.Errorf("--project is required when using --docs")
-		}
-		projDir, err := resolveProjectDirByName(listProjName)
+		projDir, err := projectDirFromFlag(listProjName)
 		if err != nil {
 			return err
 		}
@@ -38,52 +42,96 @@ var listCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		if listInstr {
+			listInstructionSets(p)
+			return nil
+		}
+		// list docs
 		if len(p.Documents) == 0 {
 			fmt.Println("(no documents)")
 			return nil
 		}
-		ids := make([]string, 0, len(p.Documents))
-		for id := range p.Documents {
-			ids = append(ids, id)
+		for _, d := range p.OrderedDocuments() {
+			pin := ""
+			if d.Pinned {
+				pin = " [pinned]"
+			}
+			tags := ""
+			if len(d.Tags) > 0 {
+				tags = " [tags: " + strings.Join(d.Tags, ", ") + "]"
+			}
+			flagged := ""
+			if len(d.Screening) > 0 {
+				flagged = " [⚠ possible prompt injection: " + injection.Summary(d.Screening) + "]"
+			}
+			fmt.Printf("- %s: %s (%s)%s%s%s\n", d.ID, d.Name, d.Description, pin, tags, flagged)
+			for _, f := range d.Screening {
+				fmt.Printf("    %s: %s\n", f.Kind, f.Excerpt)
+			}
 		}
-		sort.Strings(ids)
-		for _, id := range ids {
-			d := p.Documents[id]
-			fmt.Printf("- %s: %s (%s)\n", d.ID, d.Name, d.Description)
+		if lines := p.RelationshipLines(); len(lines) > 0 {
+			fmt.Println("\nRelationships:")
+			for _, l := range lines {
+				fmt.Printf("  %s\n", l)
+			}
 		}
 		return nil
 	},
 }
 
 func listAllProjects() error {
-	root, err := defaultProjectsDir()
+	names, err := projectNames()
 	if err != nil {
 		return err
 	}
-	dirs, err := os.ReadDir(root)
-	if err != nil {
-		return err
+	for _, n := range names {
+		fmt.Printf("- %s\n", n)
 	}
-	found := false
-	for _, e := range dirs {
-		if !e.IsDir() {
-			continue
+	if len(names) == 0 {
+		fmt.Println("(no projects)")
+	}
+	if listArchived {
+		root, err := defaultProjectsDir()
+		if err != nil {
+			return err
 		}
-		pj := filepath.Join(root, e.Name(), "project.json")
-		if _, err := os.Stat(pj); err == nil {
-			fmt.Printf("- %s\n", e.Name())
-			found = true
+		names, err := bundle.ListArchived(root)
+		if err != nil {
+			return err
+		}
+		for _, n := range names {
+			fmt.Printf("- %s [archived]\n", n)
 		}
-	}
-	if !found {
-		fmt.Println("(no projects)")
 	}
 	return nil
 }
 
+func listInstructionSets(p *project.Project) {
+	for _, name := range p.InstructionSetNames() {
+		set, err := p.LookupInstructions(name)
+		if err != nil {
+			continue
+		}
+		src := ""
+		if set.Template != "" {
+			src = fmt.Sprintf(" [template: %s]", set.Template)
+		}
+		text := strings.TrimSpace(set.Text)
+		if text == "" {
+			text = "(empty)"
+		}
+		if first, _, cut := strings.Cut(text, "\n"); cut {
+			text = first + " ..."
+		}
+		fmt.Printf("- %s%s: %s\n", name, src, text)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(listCmd)
 	listCmd.Flags().BoolVar(&listProjects, "projects", false, "list projects")
 	listCmd.Flags().BoolVar(&listDocs, "docs", false, "list documents in a project")
-	listCmd.Flags().StringVarP(&listProjName, "project", "p", "", "project name for --docs")
+	listCmd.Flags().BoolVar(&listArchived, "archived", false, "with --projects, also show archived projects")
+	listCmd.Flags().BoolVar(&listInstr, "instructions", false, "list instruction sets (tasks) in a project")
+	listCmd.Flags().StringVarP(&listProjName, "project", "p", "", "project name for --docs or --instructions")
 }
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/KaramelBytes/docloom-cli/internal/retrieval"
+	"github.com/KaramelBytes/docloom-cli/internal/schema"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migProjectName string
+	migDryRun      bool
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade project.json and index.json to the current schema version",
+	Long: `Older files are upgraded in memory whenever they are opened and written in the current
+format on the next save. migrate rewrites them now: project.json and the index are brought to
+the current schema version, index.json is converted to the binary index.bin (unless config
+index_format is json), and document text still stored inline moves to the blob store.
+Without --project the enclosing local project is migrated, or every project when run outside
+one. --dry-run only reports what would change.`,
+	Example: `  docloom migrate --dry-run
+  docloom migrate -p myproj`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Each target is a display name and its project directory.
+		var names, dirs []string
+		if local, err := projectDirFromFlag(migProjectName); err == nil {
+			name := migProjectName
+			if name == "" {
+				name = local
+			}
+			names, dirs = []string{name}, []string{local}
+		} else if migProjectName != "" {
+			return err
+		} else {
+			all, err := projectNames()
+			if err != nil {
+				return err
+			}
+			for _, name := range all {
+				dir, err := resolveProjectDirByName(name)
+				if err != nil {
+					return err
+				}
+				names, dirs = append(names, name), append(dirs, dir)
+			}
+		}
+		if !migDryRun {
+			if err := requireWritable(); err != nil {
+				return err
+			}
+		}
+		pending := 0
+		for i, name := range names {
+			changed, err := migrateProject(name, dirs[i], migDryRun)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if changed {
+				pending++
+			}
+		}
+		switch {
+		case pending == 0:
+			fmt.Printf("✓ All %d project(s) are up to date (project.json v%d, index.json v%d)\n",
+				len(names), project.Schema.Current(), retrieval.Schema.Current())
+		case migDryRun:
+			fmt.Printf("%d of %d project(s) need migration (dry run, nothing written)\n", pending, len(names))
+		default:
+			fmt.Printf("✓ Migrated %d of %d project(s)\n", pending, len(names))
+		}
+		return nil
+	},
+}
+
+// migrateProject reports and, unless dryRun, applies pending migrations for
+// one project. It returns whether anything needed migrating.
+func migrateProject(name, dir string, dryRun bool) (bool, error) {
+	pst, err := project.CheckSchema(dir)
+	if err != nil {
+		return false, err
+	}
+	ist, err := retrieval.CheckSchema(dir)
+	hasIndex := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	format, err := retrieval.ParseFormat(indexFormat(cfg, ""))
+	if err != nil {
+		return false, err
+	}
+	convert := hasIndex && retrieval.StoredFormat(dir) == retrieval.FormatJSON && format == retrieval.FormatBinary
+	p, err := project.LoadProject(dir)
+	if err != nil {
+		return false, err
+	}
+	inline := p.InlineContentCount()
+	if pst.UpToDate() && (!hasIndex || ist.UpToDate()) && !convert && inline == 0 {
+		return false, nil
+	}
+
+	fmt.Printf("%s:\n", name)
+	printSchemaStatus(pst)
+	if hasIndex {
+		printSchemaStatus(ist)
+	}
+	if convert {
+		fmt.Println("  index: index.json → index.bin (binary format)")
+	}
+	if inline > 0 {
+		fmt.Printf("  blobs: %d document(s) with inline content move to the blob store\n", inline)
+	}
+	if dryRun {
+		return true, nil
+	}
+
+	if !pst.UpToDate() || inline > 0 {
+		p, err := openProjectForUpdate(dir)
+		if err != nil {
+			return false, err
+		}
+		err = p.Save()
+		p.Close()
+		if err != nil {
+			return false, err
+		}
+	}
+	if hasIndex && (!ist.UpToDate() || convert) {
+		lock, err := retrieval.LockIndex(dir, lockTimeout)
+		if err != nil {
+			return false, err
+		}
+		defer lock.Release()
+		idx, err := retrieval.Open(dir)
+		if err != nil {
+			return false, err
+		}
+		defer idx.Close()
+		if convert {
+			idx.Format = retrieval.FormatBinary
+		}
+		if err := idx.Store(dir); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func printSchemaStatus(st schema.Status) {
+	if st.UpToDate() {
+		fmt.Printf("  %s: up to date (v%d)\n", st.Name, st.To)
+		return
+	}
+	fmt.Printf("  %s: v%d → v%d\n", st.Name, st.From, st.To)
+	for _, m := range st.Pending {
+		fmt.Printf("    - v%d→v%d: %s\n", m.From, m.From+1, m.Description)
+	}
+}
+
+// projectNames lists projects in the projects directory.
+func projectNames() ([]string, error) {
+	root, err := defaultProjectsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, e.Name(), "project.json")); err == nil {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().StringVarP(&migProjectName, "project", "p", "", "project name (default: all projects)")
+	migrateCmd.Flags().BoolVar(&migDryRun, "dry-run", false, "report pending migrations without writing")
+}
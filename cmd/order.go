@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ordProjectName string
+	ordAtEnd       bool
+	ordPin         bool
+	ordUnpin       bool
+	ordPriority    string
+	ordTruncate    string
+)
+
+var orderCmd = &cobra.Command{
+	Use:   "order [doc...]",
+	Short: "Show or change document order, pinning and priority in prompts",
+	Long: `Without arguments, prints documents in prompt order with their priority and pin state.
+
+With documents and no attribute flags, moves them (in the given sequence) to the start of
+the prompt, or to the end with --end. With --pin, --unpin, --priority or --truncate, updates
+those attributes on the listed documents instead of reordering.
+
+When --prompt-limit applies, each document gets a share of the budget and is shortened with
+its truncation strategy. Pinned documents are always included; if shares become too small,
+unpinned documents are dropped lowest priority first, then from the end of the prompt.`,
+	Example: `  docloom order -p myproj
+  docloom order -p myproj overview.md spec-v2.md
+  docloom order -p myproj checklist.md --end
+  docloom order -p myproj --pin spec-v2.md
+  docloom order -p myproj --priority low meeting-notes.md
+  docloom order -p myproj --truncate head-tail changelog.md`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ordPin && ordUnpin {
+			return fmt.Errorf("--pin and --unpin are mutually exclusive")
+		}
+		projDir, err := projectDirFromFlag(ordProjectName)
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			p, err := project.LoadProject(projDir)
+			if err != nil {
+				return err
+			}
+			printDocumentOrder(p)
+			return nil
+		}
+		p, err := openProjectForUpdate(projDir)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+
+		attrMode := ordPin || ordUnpin || cmd.Flags().Changed("priority") || cmd.Flags().Changed("truncate")
+		if attrMode {
+			if ordPin || ordUnpin {
+				if err := p.SetPinned(args, ordPin); err != nil {
+					return err
+				}
+			}
+			if cmd.Flags().Changed("priority") {
+				prio, err := project.ParsePriority(ordPriority)
+				if err != nil {
+					return err
+				}
+				if err := p.SetPriority(args, prio); err != nil {
+					return err
+				}
+			}
+			if cmd.Flags().Changed("truncate") {
+				if err := p.SetTruncation(args, ordTruncate); err != nil {
+					return err
+				}
+			}
+		} else if err := p.Reorder(args, ordAtEnd); err != nil {
+			return err
+		}
+		if err := p.Save(); err != nil {
+			return err
+		}
+		fmt.Println("✓ Document order updated")
+		printDocumentOrder(p)
+		return nil
+	},
+}
+
+func printDocumentOrder(p *project.Project) {
+	docs := p.OrderedDocuments()
+	if len(docs) == 0 {
+		fmt.Println("(no documents)")
+		return
+	}
+	for i, d := range docs {
+		pin := ""
+		if d.Pinned {
+			pin = " [pinned]"
+		}
+		trunc := d.Truncation
+		if trunc == "" {
+			trunc = project.TruncateHead
+		}
+		fmt.Printf("%2d. %s (priority: %s, truncate: %s)%s\n", i+1, d.Name, project.PriorityLabel(d.Priority), trunc, pin)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(orderCmd)
+	orderCmd.Flags().StringVarP(&ordProjectName, "project", "p", "", "project name")
+	orderCmd.Flags().BoolVar(&ordAtEnd, "end", false, "move the listed documents to the end of the prompt instead of the start")
+	orderCmd.Flags().BoolVar(&ordPin, "pin", false, "pin the listed documents (always included)")
+	orderCmd.Flags().BoolVar(&ordUnpin, "unpin", false, "unpin the listed documents")
+	orderCmd.Flags().StringVar(&ordPriority, "priority", "", "set priority of the listed documents: low|normal|high or an integer")
+	orderCmd.Flags().StringVar(&ordTruncate, "truncate", "", "set truncation strategy of the listed documents: head|head-tail|sections")
+}
@@ -1,20 +1,34 @@
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
 
+	"github.com/KaramelBytes/docloom-cli/internal/bundle"
 	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/KaramelBytes/docloom-cli/internal/retrieval"
 	"github.com/spf13/cobra"
 )
 
 var (
-	pmProject string
-	pmClear   bool
+	pmProject  string
+	pmClear    bool
+	pmFreshIDs bool
+	pmYes      bool
+	pmEnable   bool
+	pmDisable  bool
+	pmKeep     int
+	pmLimit    int
+	pmRetrOnly bool
 )
 
 var projectCmd = &cobra.Command{
 	Use:   "project",
-	Short: "Manage per-project settings",
+	Short: "Manage per-project settings and project lifecycle",
 }
 
 var projectSetModelCmd = &cobra.Command{
@@ -22,20 +36,15 @@ var projectSetModelCmd = &cobra.Command{
 	Short: "Set or clear a project's default model",
 	Args:  cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if pmProject == "" {
-			return fmt.Errorf("--project is required")
-		}
-		dir, err := resolveProjectDirByName(pmProject)
+		dir, err := projectDirFromFlag(pmProject)
 		if err != nil {
 			return err
 		}
-		p, err := project.LoadProject(dir)
+		p, err := openProjectForUpdate(dir)
 		if err != nil {
 			return err
 		}
-		if p.Config == nil {
-			p.Config = &project.ProjectConfig{}
-		}
+		defer p.Close()
 		if pmClear {
 			p.Config.Model = ""
 		} else {
@@ -48,18 +57,443 @@ var projectSetModelCmd = &cobra.Command{
 			return err
 		}
 		if pmClear {
-			fmt.Printf("✓ Cleared project model for %s\n", pmProject)
+			fmt.Printf("✓ Cleared project model for %s\n", p.Name)
+		} else {
+			fmt.Printf("✓ Set project model for %s: %s\n", p.Name, p.Config.Model)
+		}
+		return nil
+	},
+}
+
+var projectSetTemplateCmd = &cobra.Command{
+	Use:   "set-template <layout>",
+	Short: "Set or clear a project's default prompt layout",
+	Long: "Set the prompt layout used by generate when --prompt-template is not given.\n" +
+		"Accepts a built-in layout (" + strings.Join(project.BuiltinLayouts(), ", ") + "), the name of a\n" +
+		"template stored as <project>/" + project.LayoutDirName + "/<name>.tmpl, or a path to a .tmpl file.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := projectDirFromFlag(pmProject)
+		if err != nil {
+			return err
+		}
+		p, err := openProjectForUpdate(dir)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		if pmClear {
+			p.PromptTemplate = ""
+		} else {
+			if len(args) == 0 || args[0] == "" {
+				return fmt.Errorf("layout is required unless --clear is set")
+			}
+			if _, err := p.LoadLayout(args[0]); err != nil {
+				return err
+			}
+			p.PromptTemplate = args[0]
+		}
+		if err := p.Save(); err != nil {
+			return err
+		}
+		if pmClear {
+			fmt.Printf("✓ Cleared prompt layout for %s\n", p.Name)
 		} else {
-			fmt.Printf("✓ Set project model for %s: %s\n", pmProject, p.Config.Model)
+			fmt.Printf("✓ Set prompt layout for %s: %s\n", p.Name, p.PromptTemplate)
+		}
+		return nil
+	},
+}
+
+var projectRenameCmd = &cobra.Command{
+	Use:   "rename <old> <new>",
+	Short: "Rename a project",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireWritable(); err != nil {
+			return err
+		}
+		root, err := defaultProjectsDir()
+		if err != nil {
+			return err
+		}
+		p, err := project.Rename(root, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Renamed %s to %s (%s)\n", args[0], args[1], p.RootDir())
+		return nil
+	},
+}
+
+var projectCloneCmd = &cobra.Command{
+	Use:   "clone <source> <new>",
+	Short: "Copy a project, including its index and dataset summaries",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireWritable(); err != nil {
+			return err
+		}
+		root, err := defaultProjectsDir()
+		if err != nil {
+			return err
+		}
+		p, err := project.Clone(root, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		if pmFreshIDs {
+			mapping := p.RegenerateIDs()
+			// Snapshots hold the old IDs; the clone starts a new history.
+			if err := p.ClearHistory(); err != nil {
+				return err
+			}
+			if err := p.Save(); err != nil {
+				return err
+			}
+			lock, err := retrieval.LockIndex(p.RootDir(), lockTimeout)
+			if err != nil {
+				return err
+			}
+			defer lock.Release()
+			if idx, err := retrieval.Open(p.RootDir()); err == nil {
+				idx.RemapDocIDs(mapping)
+				err = idx.Store(p.RootDir())
+				idx.Close()
+				if err != nil {
+					return fmt.Errorf("update cloned index: %w", err)
+				}
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("load cloned index: %w", err)
+			}
+		}
+		fmt.Printf("✓ Cloned %s to %s (%s)\n", args[0], args[1], p.RootDir())
+		return nil
+	},
+}
+
+var projectDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Move a project to the trash (recover with 'project restore')",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireWritable(); err != nil {
+			return err
+		}
+		root, err := defaultProjectsDir()
+		if err != nil {
+			return err
+		}
+		if !pmYes {
+			fmt.Fprintf(cmd.OutOrStdout(), "Delete project %s? It will be moved to %s. [y/N]: ", args[0], filepath.Join(root, project.TrashDirName))
+			answer, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+			if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+				fmt.Println("Aborted.")
+				return nil
+			}
+		}
+		dst, err := project.Trash(root, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Moved %s to trash: %s\n", args[0], dst)
+		return nil
+	},
+}
+
+var projectRestoreCmd = &cobra.Command{
+	Use:   "restore <name>",
+	Short: "Restore the most recently deleted project with this name from the trash",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireWritable(); err != nil {
+			return err
+		}
+		root, err := defaultProjectsDir()
+		if err != nil {
+			return err
+		}
+		p, err := project.RestoreFromTrash(root, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Restored %s (%s)\n", args[0], p.RootDir())
+		return nil
+	},
+}
+
+var projectArchiveCmd = &cobra.Command{
+	Use:   "archive <name>",
+	Short: "Compress an inactive project and hide it from 'list --projects'",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireWritable(); err != nil {
+			return err
+		}
+		root, err := defaultProjectsDir()
+		if err != nil {
+			return err
+		}
+		out, err := bundle.Archive(root, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Archived %s to %s\n", args[0], out)
+		return nil
+	},
+}
+
+var projectUnarchiveCmd = &cobra.Command{
+	Use:   "unarchive <name>",
+	Short: "Restore an archived project",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireWritable(); err != nil {
+			return err
+		}
+		root, err := defaultProjectsDir()
+		if err != nil {
+			return err
+		}
+		dir, err := bundle.Unarchive(root, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Unarchived %s (%s)\n", args[0], dir)
+		return nil
+	},
+}
+
+var projectHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List project snapshots, or enable/disable snapshotting",
+	Long: `With --enable, every save of project.json records a content-addressed snapshot under
+<project>/.history (document text is stored once per distinct content). --keep sets how many
+snapshots are retained. Without flags, lists snapshots from oldest to newest.`,
+	Example: `  docloom project history -p myproj --enable --keep 50
+  docloom project history -p myproj`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		modify := pmEnable || pmDisable || cmd.Flags().Changed("keep")
+		load := loadProjectFlag
+		if modify {
+			load = loadProjectFlagForUpdate
+		}
+		p, err := load()
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		if pmEnable && pmDisable {
+			return fmt.Errorf("--enable and --disable are mutually exclusive")
+		}
+		if modify {
+			switch {
+			case pmDisable:
+				p.Config.HistoryKeep = 0
+			case cmd.Flags().Changed("keep"):
+				if pmKeep <= 0 {
+					return fmt.Errorf("--keep must be positive (use --disable to turn history off)")
+				}
+				p.Config.HistoryKeep = pmKeep
+			case p.Config.HistoryKeep == 0:
+				p.Config.HistoryKeep = project.DefaultHistoryKeep
+			}
+			if err := p.Save(); err != nil {
+				return err
+			}
+			if p.HistoryEnabled() {
+				fmt.Printf("✓ History enabled for %s (keeping %d snapshots)\n", p.Name, p.Config.HistoryKeep)
+			} else {
+				fmt.Printf("✓ History disabled for %s (existing snapshots kept)\n", p.Name)
+			}
+			return nil
+		}
+		log, err := p.History()
+		if err != nil {
+			return err
+		}
+		if len(log) == 0 {
+			fmt.Println("(no history)")
+			return nil
+		}
+		for _, r := range log {
+			fmt.Printf("%s  %s  %d document(s)\n", r.Rev, r.CreatedAt.Local().Format("2006-01-02 15:04:05"), r.Documents)
 		}
 		return nil
 	},
 }
 
+var projectLimitsCmd = &cobra.Command{
+	Use:   "limits",
+	Short: "Show or set a project's document token limit",
+	Long: `Without flags, shows the effective limit and how much of it the documents use.
+The limit comes from the project's --token-limit, then the global project_token_limit,
+then the project model's context window less the response budget. Retrieval-only
+projects have no full-context cap because generate sends only retrieved chunks.`,
+	Example: `  docloom project limits -p myproj
+  docloom project limits -p myproj --token-limit 32000
+  docloom project limits -p myproj --retrieval-only`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		modify := cmd.Flags().Changed("token-limit") || cmd.Flags().Changed("retrieval-only")
+		load := loadProjectFlag
+		if modify {
+			load = loadProjectFlagForUpdate
+		}
+		p, err := load()
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		if modify {
+			if cmd.Flags().Changed("token-limit") {
+				if pmLimit < 0 {
+					return fmt.Errorf("--token-limit must not be negative (0 inherits)")
+				}
+				p.Config.TokenLimit = pmLimit
+			}
+			if cmd.Flags().Changed("retrieval-only") {
+				p.Config.RetrievalOnly = pmRetrOnly
+			}
+			if err := p.Save(); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Updated limits for %s\n", p.Name)
+		}
+		p.SetSizeLimits(projectSizeLimits(p, cfg, false))
+		printHeadroom(p)
+		return nil
+	},
+}
+
+var projectDiffCmd = &cobra.Command{
+	Use:   "diff <rev1> <rev2>",
+	Short: "Show instruction and document changes between two snapshots",
+	Long:  "Revisions may be abbreviated to a unique prefix; 'latest' names the newest snapshot.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := loadProjectFlag()
+		if err != nil {
+			return err
+		}
+		d, err := p.Diff(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		if d.Empty() {
+			fmt.Println("(no changes)")
+			return nil
+		}
+		if d.InstructionsChanged() {
+			fmt.Println("Instructions:")
+			for _, l := range d.Instructions {
+				fmt.Printf("  %s\n", l)
+			}
+		}
+		printDiffSection("Instruction sets", d.InstructionSets, "")
+		printDiffSection("Documents added", d.Added, "+ ")
+		printDiffSection("Documents removed", d.Removed, "- ")
+		printDiffSection("Documents changed", d.Changed, "~ ")
+		return nil
+	},
+}
+
+func printDiffSection(title string, items []string, prefix string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", title)
+	for _, it := range items {
+		fmt.Printf("  %s%s\n", prefix, it)
+	}
+}
+
+var projectRollbackCmd = &cobra.Command{
+	Use:   "rollback <rev>",
+	Short: "Restore instructions and documents from a snapshot",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := loadProjectFlagForUpdate()
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		if err := p.Rollback(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Rolled back %s to %s\n", p.Name, args[0])
+		return nil
+	},
+}
+
+var projectCompactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Move inline document content into the blob store and drop unused blobs",
+	Long:  "Projects created before the blob store keep document text inside project.json. Any save migrates them; compact does it explicitly and also sweeps the whole blob store for unreferenced blobs (saves only collect the ones they release).",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := loadProjectFlagForUpdate()
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		inline := p.InlineContentCount()
+		if err := p.Compact(); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Compacted %s (%d document(s) migrated to the blob store)\n", p.Name, inline)
+		return nil
+	},
+}
+
+// loadProjectFlag loads the project named by -p (or the enclosing local
+// project) for project subcommands.
+func loadProjectFlag() (*project.Project, error) {
+	dir, err := projectDirFromFlag(pmProject)
+	if err != nil {
+		return nil, err
+	}
+	return project.LoadProject(dir)
+}
+
+// loadProjectFlagForUpdate is loadProjectFlag holding the project lock; callers must Close.
+func loadProjectFlagForUpdate() (*project.Project, error) {
+	dir, err := projectDirFromFlag(pmProject)
+	if err != nil {
+		return nil, err
+	}
+	return openProjectForUpdate(dir)
+}
+
 func init() {
 	rootCmd.AddCommand(projectCmd)
 	projectCmd.AddCommand(projectSetModelCmd)
+	projectCmd.AddCommand(projectSetTemplateCmd)
+	projectCmd.AddCommand(projectRenameCmd)
+	projectCmd.AddCommand(projectCloneCmd)
+	projectCmd.AddCommand(projectDeleteCmd)
+	projectCmd.AddCommand(projectRestoreCmd)
+	projectCmd.AddCommand(projectArchiveCmd)
+	projectCmd.AddCommand(projectUnarchiveCmd)
+	projectCmd.AddCommand(projectHistoryCmd)
+	projectCmd.AddCommand(projectDiffCmd)
+	projectCmd.AddCommand(projectRollbackCmd)
+	projectCmd.AddCommand(projectCompactCmd)
+	projectCmd.AddCommand(projectLimitsCmd)
 
 	projectSetModelCmd.Flags().StringVarP(&pmProject, "project", "p", "", "project name")
 	projectSetModelCmd.Flags().BoolVar(&pmClear, "clear", false, "clear the project's model override")
+	projectSetTemplateCmd.Flags().StringVarP(&pmProject, "project", "p", "", "project name")
+	projectSetTemplateCmd.Flags().BoolVar(&pmClear, "clear", false, "clear the project's prompt layout")
+	projectCloneCmd.Flags().BoolVar(&pmFreshIDs, "fresh-ids", false, "assign new document IDs in the copy (the index is remapped and history snapshots are dropped)")
+	for _, c := range []*cobra.Command{projectHistoryCmd, projectDiffCmd, projectRollbackCmd, projectCompactCmd, projectLimitsCmd} {
+		c.Flags().StringVarP(&pmProject, "project", "p", "", "project name")
+	}
+	projectHistoryCmd.Flags().BoolVar(&pmEnable, "enable", false, "record a snapshot on every save")
+	projectHistoryCmd.Flags().BoolVar(&pmDisable, "disable", false, "stop recording snapshots")
+	projectHistoryCmd.Flags().IntVar(&pmKeep, "keep", project.DefaultHistoryKeep, "number of snapshots to retain")
+	projectLimitsCmd.Flags().IntVar(&pmLimit, "token-limit", 0, "cap on the project's document tokens (0 inherits the global or model-derived limit)")
+	projectLimitsCmd.Flags().BoolVar(&pmRetrOnly, "retrieval-only", false, "mark the project as queried through retrieval only (no full-context cap); --retrieval-only=false clears it")
+	projectDeleteCmd.Flags().BoolVarP(&pmYes, "yes", "y", false, "skip the confirmation prompt")
 }
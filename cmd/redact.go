@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/KaramelBytes/docloom-cli/internal/ai"
+	cfgpkg "github.com/KaramelBytes/docloom-cli/internal/config"
+	"github.com/KaramelBytes/docloom-cli/internal/redact"
+	"github.com/KaramelBytes/docloom-cli/internal/retrieval"
+)
+
+// redactionPolicy decides whether content sent to a provider is redacted
+// first. Remote providers are redacted when enabled; Ollama stays on the
+// machine and is only redacted when Local is set.
+type redactionPolicy struct {
+	Enabled bool
+	Local   bool
+	Options redact.Options
+}
+
+// redactionPolicyFor reads the redaction config. A --redact flag given on
+// the command line (changed) overrides the config for this run.
+func redactionPolicyFor(c *cfgpkg.Global, changed, flag bool) redactionPolicy {
+	var rp redactionPolicy
+	if c != nil {
+		rp = redactionPolicy{
+			Enabled: c.Redact,
+			Local:   c.RedactLocal,
+			Options: redact.Options{Detectors: c.RedactDetectors, Rules: c.RedactRules},
+		}
+	}
+	if changed {
+		rp.Enabled = flag
+		if !flag {
+			rp.Local = false
+		}
+	}
+	return rp
+}
+
+// applies reports whether content sent to provider must be redacted.
+func (rp redactionPolicy) applies(provider string) bool {
+	if !rp.Enabled {
+		return false
+	}
+	local := provider == ai.ProviderOllama || provider == ai.ProviderLocal
+	return !local || rp.Local
+}
+
+// redactor returns a fresh Redactor for provider, or nil when redaction does
+// not apply.
+func (rp redactionPolicy) redactor(provider string) (*redact.Redactor, error) {
+	if !rp.applies(provider) {
+		return nil, nil
+	}
+	return redact.New(rp.Options)
+}
+
+// embedder wraps emb so texts are redacted before they are embedded by provider.
+func (rp redactionPolicy) embedder(emb retrieval.Embedder, provider string) (retrieval.Embedder, error) {
+	r, err := rp.redactor(provider)
+	if err != nil || r == nil {
+		return emb, err
+	}
+	return embedFunc(func(ctx context.Context, texts []string) ([][]float32, error) {
+		redacted := make([]string, len(texts))
+		for i, t := range texts {
+			redacted[i] = r.Redact(t)
+		}
+		return emb.Embed(ctx, redacted)
+	}), nil
+}
+
+// printRedactionReport lists what was redacted from a prompt.
+func printRedactionReport(r *redact.Redactor) {
+	report := r.Report()
+	if len(report) == 0 {
+		fmt.Println("🔒 Redaction: nothing sensitive detected")
+		return
+	}
+	fmt.Printf("🔒 Redaction: %d value(s) replaced with placeholders\n", r.Count())
+	for _, f := range report {
+		fmt.Printf("  - %s: %d occurrence(s), %d distinct (e.g. %s)\n", f.Detector, f.Occurrences, f.Distinct, strings.Join(f.Examples, ", "))
+	}
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/KaramelBytes/docloom-cli/internal/ai"
+	cfgpkg "github.com/KaramelBytes/docloom-cli/internal/config"
+)
+
+func TestRedactionPolicySkipsLocalProvidersAndWrapsEmbedder(t *testing.T) {
+	cfg := &cfgpkg.Global{Redact: true}
+	rp := redactionPolicyFor(cfg, false, false)
+	if !rp.applies(ai.ProviderOpenRouter) || rp.applies(ai.ProviderOllama) {
+		t.Fatalf("unexpected policy: %+v", rp)
+	}
+	if off := redactionPolicyFor(cfg, true, false); off.applies(ai.ProviderOpenRouter) {
+		t.Fatal("--redact=false should override the config")
+	}
+	cfg.RedactLocal = true
+	if !redactionPolicyFor(cfg, false, false).applies(ai.ProviderOllama) {
+		t.Fatal("redact_local should cover ollama")
+	}
+
+	var seen []string
+	emb, err := rp.embedder(embedFunc(func(_ context.Context, texts []string) ([][]float32, error) {
+		seen = append(seen, texts...)
+		return make([][]float32, len(texts)), nil
+	}), ai.ProviderOpenRouter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := emb.Embed(context.Background(), []string{"mail jane.doe@example.com today"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 1 || strings.Contains(seen[0], "jane.doe") || !strings.Contains(seen[0], "[REDACTED_EMAIL_1]") {
+		t.Fatalf("embedder saw unredacted text: %q", seen)
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/spf13/cobra"
+)
+
+var (
+	relProjectName string
+	relRemove      bool
+)
+
+var relateCmd = &cobra.Command{
+	Use:   "relate <docA> <relation> <docB>",
+	Short: "Record a relationship between two documents",
+	Long: "Record a directed relationship between two documents so the prompt can explain how they relate.\n" +
+		"Documents may be referenced by ID, unique ID prefix, or file name.\n" +
+		"Relations: " + strings.Join(project.Relations, ", "),
+	Example: `  docloom relate -p myproj spec-v2.md supersedes spec-v1.md
+  docloom relate -p myproj sales.summary.md data-for report.md
+  docloom relate -p myproj spec-v2.md supersedes spec-v1.md --remove`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projDir, err := projectDirFromFlag(relProjectName)
+		if err != nil {
+			return err
+		}
+		p, err := openProjectForUpdate(projDir)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		if relRemove {
+			removed, err := p.RemoveRelationship(args[0], args[1], args[2])
+			if err != nil {
+				return err
+			}
+			if !removed {
+				return fmt.Errorf("relationship not found: %s %s %s", args[0], args[1], args[2])
+			}
+			if err := p.Save(); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Relationship removed: %s %s %s\n", args[0], args[1], args[2])
+			return nil
+		}
+		r, err := p.AddRelationship(args[0], args[1], args[2])
+		if err != nil {
+			return err
+		}
+		if err := p.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Relationship recorded: %s %s %s\n", p.Documents[r.From].Name, r.Relation, p.Documents[r.To].Name)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(relateCmd)
+	relateCmd.Flags().StringVarP(&relProjectName, "project", "p", "", "project name")
+	relateCmd.Flags().BoolVar(&relRemove, "remove", false, "remove the relationship instead of adding it")
+}
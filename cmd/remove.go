@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	rmProjectName string
+)
+
+var removeCmd = &cobra.Command{
+	Use:   "remove <doc>",
+	Short: "Remove a document (and its relationships) from a project",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projDir, err := projectDirFromFlag(rmProjectName)
+		if err != nil {
+			return err
+		}
+		p, err := openProjectForUpdate(projDir)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		d, err := p.RemoveDocument(args[0])
+		if err != nil {
+			return err
+		}
+		if err := p.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Document removed: %s\n", d.Name)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(removeCmd)
+	removeCmd.Flags().StringVarP(&rmProjectName, "project", "p", "", "project name")
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,6 +11,8 @@ import (
 
 	"github.com/KaramelBytes/docloom-cli/internal/ai"
 	cfgpkg "github.com/KaramelBytes/docloom-cli/internal/config"
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/KaramelBytes/docloom-cli/internal/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -22,6 +25,9 @@ var (
 	flagRetryMaxAttempts int
 	flagRetryBaseDelayMs int
 	flagRetryMaxDelayMs  int
+	// Concurrency: --read-only refuses writes and never takes locks
+	readOnly    bool
+	lockTimeout time.Duration
 
 	// Loaded configuration
 	cfg *cfgpkg.Global
@@ -51,6 +57,30 @@ func init() {
 	rootCmd.PersistentFlags().IntVar(&flagRetryMaxAttempts, "retry-max", 0, "max retry attempts on 429/5xx (overrides config)")
 	rootCmd.PersistentFlags().IntVar(&flagRetryBaseDelayMs, "retry-base-ms", 0, "base retry backoff in ms (overrides config)")
 	rootCmd.PersistentFlags().IntVar(&flagRetryMaxDelayMs, "retry-max-ms", 0, "max retry backoff cap in ms (overrides config)")
+	rootCmd.PersistentFlags().BoolVar(&readOnly, "read-only", false, "never modify projects or the retrieval index (no locks are taken)")
+	rootCmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", utils.DefaultLockTimeout, "how long to wait for another docloom process holding the project lock")
+}
+
+// errReadOnlyMode is returned by commands that would modify a project under --read-only.
+var errReadOnlyMode = errors.New("refusing to modify the project in --read-only mode")
+
+// requireWritable rejects writes under --read-only and applies --lock-timeout.
+func requireWritable() error {
+	if readOnly {
+		return errReadOnlyMode
+	}
+	project.LockTimeout = lockTimeout
+	return nil
+}
+
+// openProjectForUpdate loads the project at dir while holding its lock, so
+// concurrent docloom processes cannot lose each other's changes. Callers must
+// Close the project to release the lock.
+func openProjectForUpdate(dir string) (*project.Project, error) {
+	if err := requireWritable(); err != nil {
+		return nil, err
+	}
+	return project.LoadProjectForUpdate(dir)
 }
 
 func loadConfig() {
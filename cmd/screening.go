@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/KaramelBytes/docloom-cli/internal/injection"
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+)
+
+// maxScreeningExcerpts caps how many findings are printed per document.
+const maxScreeningExcerpts = 3
+
+// printScreening warns about a document whose content looks like prompt
+// injection and shows a few of the suspicious spans.
+func printScreening(d *project.Document) {
+	if len(d.Screening) == 0 {
+		return
+	}
+	name := d.Name
+	if d.Project != "" {
+		name = d.Project + "/" + d.Name
+	}
+	fmt.Printf("⚠ %s: possible prompt injection (%s)\n", name, injection.Summary(d.Screening))
+	for i, f := range d.Screening {
+		if i == maxScreeningExcerpts {
+			fmt.Printf("  ... %d more (see 'docloom list --docs')\n", len(d.Screening)-i)
+			break
+		}
+		fmt.Printf("  - %s: %s\n", f.Kind, f.Excerpt)
+	}
+}
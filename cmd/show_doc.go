@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/KaramelBytes/docloom-cli/internal/parser"
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/spf13/cobra"
+)
+
+var (
+	showDocProjectName string
+	showDocReparse     bool
+	showDocCheck       bool
+)
+
+var showDocCmd = &cobra.Command{
+	Use:   "show-doc <doc>",
+	Short: "Show a document's provenance and whether its source has drifted",
+	Long: `Shows how a document was produced: the parser and its version, the parse options
+(such as XLSX sheet or analysis settings), and the SHA-256, size and modification time of
+the source file. The source is hashed again to report whether it is unchanged, only touched
+(newer mtime, same content), modified or missing. --reparse also re-parses the source with
+the recorded options and compares the result with the stored content.`,
+	Example: `  docloom show-doc -p myproj spec.md
+  docloom show-doc -p myproj 3f2a --reparse
+  docloom show-doc -p myproj data.summary.md --check`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projDir, err := projectDirFromFlag(showDocProjectName)
+		if err != nil {
+			return err
+		}
+		p, err := project.LoadProject(projDir)
+		if err != nil {
+			return err
+		}
+		d, err := p.ResolveDocument(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Document:    %s (%s)\n", d.Name, d.ID)
+		fmt.Printf("Path:        %s\n", d.Path)
+		if d.Description != "" {
+			fmt.Printf("Description: %s\n", d.Description)
+		}
+		fmt.Printf("Tokens:      %d\n", d.Tokens)
+
+		prov := d.Provenance
+		if prov == nil {
+			fmt.Println("Provenance:  (not recorded; re-add or refresh the document to record it)")
+		} else {
+			if prov.Source != "" {
+				fmt.Printf("Source:      %s\n", prov.Source)
+			}
+			fmt.Printf("Parser:      %s (version %s)\n", prov.Parser, prov.ParserVersion)
+			if prov.Options != nil {
+				b, err := json.Marshal(prov.Options)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Options:     %s\n", b)
+			}
+			fmt.Printf("SHA-256:     %s\n", prov.SHA256)
+			fmt.Printf("Size:        %d bytes\n", prov.Size)
+			fmt.Printf("Modified:    %s\n", prov.ModTime.Format(time.RFC3339))
+			if prov.ParserVersion != parser.Version {
+				fmt.Printf("⚠ Parsed by parser version %s; this docloom has version %s\n", prov.ParserVersion, parser.Version)
+			}
+		}
+
+		drifted := false
+		drift := p.CheckDrift(d)
+		switch drift.Status {
+		case project.DriftNone:
+			fmt.Println("✓ Source unchanged")
+		case project.DriftTouched:
+			fmt.Printf("✓ Source content unchanged (modified time is now %s)\n", drift.ModTime.Format(time.RFC3339))
+		case project.DriftModified:
+			drifted = true
+			fmt.Printf("⚠ Source modified since it was parsed: sha256 %s, %d bytes, modified %s\n",
+				drift.SHA256, drift.Size, drift.ModTime.Format(time.RFC3339))
+		case project.DriftMissing:
+			drifted = true
+			fmt.Printf("✗ Source unavailable: %v\n", drift.Err)
+		case project.DriftUnknown:
+			fmt.Printf("⚠ Source present (sha256 %s) but no checksum was recorded to compare with\n", drift.SHA256)
+		}
+
+		if showDocReparse && drift.Status != project.DriftMissing {
+			parsed, err := p.Reparse(d)
+			if err != nil {
+				return fmt.Errorf("re-parse %s: %w", d.Name, err)
+			}
+			stored, err := p.LoadContent(d)
+			if err != nil {
+				return err
+			}
+			if parsed == stored {
+				fmt.Println("✓ Re-parsing reproduces the stored content")
+			} else {
+				drifted = true
+				fmt.Printf("⚠ Re-parsing gives different content (≈%d tokens now, %d stored)\n", parser.EstimateTokens(parsed), d.Tokens)
+			}
+		}
+		if showDocCheck && drifted {
+			return fmt.Errorf("document %s has drifted from its source", d.Name)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(showDocCmd)
+	showDocCmd.Flags().StringVarP(&showDocProjectName, "project", "p", "", "project name")
+	showDocCmd.Flags().BoolVar(&showDocReparse, "reparse", false, "re-parse the source with the recorded options and compare with the stored content")
+	showDocCmd.Flags().BoolVar(&showDocCheck, "check", false, "exit with an error when the source has drifted")
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tagProjectName string
+)
+
+var tagCmd = &cobra.Command{
+	Use:   "tag <doc> <tag>...",
+	Short: "Add tags to a document",
+	Long: `Tags group documents so generate can select a subset with --tags and --exclude-tags.
+Tags are case-insensitive and may contain letters, digits and - _ . : /.`,
+	Example: `  docloom tag -p myproj spec.md spec v2
+  docloom generate -p myproj --tags spec --exclude-tags draft`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateTags(args[0], func(d *project.Document) (string, error) {
+			added, err := d.AddTags(args[1:]...)
+			if err != nil {
+				return "", err
+			}
+			if len(added) == 0 {
+				return fmt.Sprintf("%s already has these tags", d.Name), nil
+			}
+			return fmt.Sprintf("✓ Tagged %s: %s", d.Name, strings.Join(added, ", ")), nil
+		})
+	},
+}
+
+var untagCmd = &cobra.Command{
+	Use:   "untag <doc> <tag>...",
+	Short: "Remove tags from a document",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateTags(args[0], func(d *project.Document) (string, error) {
+			removed := d.RemoveTags(args[1:]...)
+			if len(removed) == 0 {
+				return fmt.Sprintf("%s has none of these tags", d.Name), nil
+			}
+			return fmt.Sprintf("✓ Removed from %s: %s", d.Name, strings.Join(removed, ", ")), nil
+		})
+	},
+}
+
+// updateTags applies fn to the referenced document and saves the project.
+func updateTags(ref string, fn func(d *project.Document) (string, error)) error {
+	projDir, err := projectDirFromFlag(tagProjectName)
+	if err != nil {
+		return err
+	}
+	p, err := openProjectForUpdate(projDir)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	d, err := p.ResolveDocument(ref)
+	if err != nil {
+		return err
+	}
+	msg, err := fn(d)
+	if err != nil {
+		return err
+	}
+	if err := p.Save(); err != nil {
+		return err
+	}
+	fmt.Println(msg)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+	rootCmd.AddCommand(untagCmd)
+	tagCmd.Flags().StringVarP(&tagProjectName, "project", "p", "", "project name")
+	untagCmd.Flags().StringVarP(&tagProjectName, "project", "p", "", "project name")
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KaramelBytes/docloom-cli/internal/templates"
+	"github.com/spf13/cobra"
+)
+
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "Browse the instruction template library",
+	Long: "Built-in templates ship with DocLoom; user templates are *.md files in\n" +
+		strings.Join(templates.UserDirs(), " or ") + " and override built-ins of the same name.\n" +
+		"Placeholders are written {{name}} (required) or {{name|default}} (optional).",
+}
+
+var templatesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List available instruction templates",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, err := templates.List()
+		if err != nil {
+			return err
+		}
+		for i := range all {
+			t := &all[i]
+			fmt.Printf("- %s [%s]", t.Name, t.Source)
+			if vars := t.Vars(); len(vars) > 0 {
+				fmt.Printf(" vars: %s", formatTemplateVars(vars))
+			}
+			fmt.Println()
+		}
+		return nil
+	},
+}
+
+var templatesShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Print an instruction template and its variables",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		t, err := templates.Get(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Template: %s [%s]\n", t.Name, t.Source)
+		if vars := t.Vars(); len(vars) > 0 {
+			fmt.Printf("Variables: %s\n", formatTemplateVars(vars))
+		}
+		fmt.Println()
+		fmt.Println(strings.TrimRight(t.Body, "\n"))
+		return nil
+	},
+}
+
+func formatTemplateVars(vars []templates.Var) string {
+	parts := make([]string, 0, len(vars))
+	for _, v := range vars {
+		if v.Required {
+			parts = append(parts, v.Name+" (required)")
+		} else {
+			parts = append(parts, fmt.Sprintf("%s (default %q)", v.Name, v.Default))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func init() {
+	rootCmd.AddCommand(templatesCmd)
+	templatesCmd.AddCommand(templatesListCmd)
+	templatesCmd.AddCommand(templatesShowCmd)
+}
@@ -0,0 +1,406 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/KaramelBytes/docloom-cli/internal/retrieval"
+	"github.com/KaramelBytes/docloom-cli/internal/utils"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	watchProjectName string
+	watchInterval    time.Duration
+	watchDebounce    time.Duration
+	watchGenerate    bool
+	watchOutput      string
+	watchOnce        bool
+)
+
+// lastGenerateFile records the flags of the project's last generate run so
+// watch --generate can repeat it.
+const lastGenerateFile = "last_generate.json"
+
+type lastGenerate struct {
+	Args []string `json:"args"`
+	// Dir is the working directory of the run; relative paths in Args, such
+	// as --output or --prompt-template, resolve against it.
+	Dir string    `json:"dir,omitempty"`
+	At  time.Time `json:"at"`
+}
+
+// secretFlags name or carry a project's secret. They are never recorded or
+// passed on as flags; the child gets the watcher's secret instead (see
+// childSecretEnv).
+var secretFlags = map[string]bool{"key-file": true, "passphrase-fd": true}
+
+// flagArgs returns the flags set on the command line as --name=value
+// arguments, leaving out secretFlags and the names in skip.
+func flagArgs(flags *pflag.FlagSet, skip ...string) []string {
+	var args []string
+	flags.VisitAll(func(fl *pflag.Flag) {
+		if !fl.Changed || secretFlags[fl.Name] || slices.Contains(skip, fl.Name) {
+			return
+		}
+		val := fl.Value.String()
+		if sv, ok := fl.Value.(pflag.SliceValue); ok {
+			val = strings.Join(sv.GetSlice(), ",")
+		}
+		args = append(args, "--"+fl.Name+"="+val)
+	})
+	return args
+}
+
+// recordLastGenerate stores generate's own flags (not the global ones) in the
+// project directory, sealed when the project is encrypted.
+func recordLastGenerate(dir string, flags *pflag.FlagSet) error {
+	last := lastGenerate{Args: append([]string{"generate"}, flagArgs(flags)...), At: time.Now()}
+	if wd, err := os.Getwd(); err == nil {
+		last.Dir = wd
+	}
+	data, err := utils.PrettyJSON(last)
+	if err != nil {
+		return err
+	}
+	return vault.WriteFile(filepath.Join(dir, lastGenerateFile), data)
+}
+
+func loadLastGenerate(dir string) (*lastGenerate, error) {
+	b, err := vault.ReadFile(filepath.Join(dir, lastGenerateFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no previous generate run recorded for this project; run 'docloom generate -p <project> ...' once first")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", lastGenerateFile, err)
+	}
+	var last lastGenerate
+	if err := json.Unmarshal(b, &last); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", lastGenerateFile, err)
+	}
+	return &last, nil
+}
+
+// runGenerateArgs runs docloom with args in a child process so a failing or
+// panicking generate never stops the watcher. A non-empty workDir runs it
+// there, which lets a local project be found without -p; env is added to the
+// watcher's environment.
+var runGenerateArgs = func(ctx context.Context, workDir string, args, env []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	c := exec.CommandContext(ctx, exe, args...)
+	c.Dir = workDir
+	c.Env = append(os.Environ(), env...)
+	c.Stdout, c.Stderr = os.Stdout, os.Stderr
+	return c.Run()
+}
+
+// childSecretEnv passes the secret of the encrypted project at dir to a child
+// through the variables a user would set: the watcher's key file, or the
+// passphrase it was unlocked with, since a --passphrase-fd descriptor cannot
+// be read again by the child.
+func childSecretEnv(dir string) []string {
+	h, err := vault.ReadHeader(dir)
+	if err != nil {
+		return nil
+	}
+	if h.KDF == vault.KDFKeyFile {
+		if path := keySourcePath(flagKeyFile, envKeyFile); path != "" {
+			return []string{envKeyFile + "=" + absDir(path)}
+		}
+		return nil
+	}
+	if pass, ok := projectPassphrase(dir); ok {
+		return []string{envPassphrase + "=" + pass}
+	}
+	return nil
+}
+
+type pendingChange struct {
+	mod   time.Time
+	since time.Time
+}
+
+// watcher polls the source files of a project's documents. A document is
+// stale when its file's modification time differs from the one recorded when
+// it was parsed (Document.OriginModTime); it is synced once that time has
+// been stable for the debounce period, so bursts of saves trigger one update.
+type watcher struct {
+	dir      string
+	debounce time.Duration
+	pending  map[string]pendingChange
+	// failed remembers the modification time of files that failed to parse,
+	// so they are retried only after the next save.
+	failed  map[string]time.Time
+	missing map[string]bool
+}
+
+func newWatcher(dir string, debounce time.Duration) *watcher {
+	return &watcher{
+		dir:      dir,
+		debounce: debounce,
+		pending:  map[string]pendingChange{},
+		failed:   map[string]time.Time{},
+		missing:  map[string]bool{},
+	}
+}
+
+// scan returns the source paths whose changes have settled by now.
+func (w *watcher) scan(p *project.Project, now time.Time) []string {
+	var ready []string
+	for _, d := range p.OrderedDocuments() {
+		src := p.OriginPath(d)
+		info, err := os.Stat(src)
+		if err != nil {
+			if !w.missing[src] {
+				fmt.Printf("⚠ Source of %s is unavailable: %v\n", d.Name, err)
+				w.missing[src] = true
+			}
+			continue
+		}
+		delete(w.missing, src)
+		mod := info.ModTime()
+		if mod.Equal(d.OriginModTime()) {
+			delete(w.pending, src)
+			continue
+		}
+		if f, ok := w.failed[src]; ok && f.Equal(mod) {
+			continue
+		}
+		pc, ok := w.pending[src]
+		if !ok || !pc.mod.Equal(mod) {
+			w.pending[src] = pendingChange{mod: mod, since: now}
+			if w.debounce > 0 {
+				continue
+			}
+		} else if now.Sub(pc.since) < w.debounce {
+			continue
+		}
+		ready = append(ready, src)
+	}
+	return ready
+}
+
+// sync re-parses the given source files with their recorded parser options
+// and updates their documents under the project lock. Parse failures are
+// reported and skipped. It returns the number of documents updated.
+func (w *watcher) sync(paths []string) (int, error) {
+	want := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		want[path] = true
+	}
+	p, err := openProjectForUpdate(w.dir)
+	if err != nil {
+		return 0, err
+	}
+	defer p.Close()
+	p.SetSizeLimits(projectSizeLimits(p, cfg, false))
+	updated := 0
+	for _, d := range p.OrderedDocuments() {
+		src := p.OriginPath(d)
+		if !want[src] {
+			continue
+		}
+		delete(w.pending, src)
+		info, err := os.Stat(src)
+		if err != nil {
+			fmt.Printf("✗ %s: %v\n", src, err)
+			continue
+		}
+		if err := p.Refresh(d); err != nil {
+			w.failed[src] = info.ModTime()
+			fmt.Printf("✗ %s: %v\n", src, err)
+			continue
+		}
+		delete(w.failed, src)
+		updated++
+		fmt.Printf("✓ Updated %s (≈%d tokens)\n", d.Name, d.Tokens)
+	}
+	if updated == 0 {
+		return 0, nil
+	}
+	if err := p.Save(); err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// refreshWatchedIndex updates index.json when the project has one, reusing
+// the embedding provider and model it was built with. An index built for
+// lexical retrieval only (no embedding provider) is refreshed without embedding.
+func refreshWatchedIndex(ctx context.Context, dir string) error {
+	prev, err := retrieval.Open(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // no index yet; generate --retrieval builds it
+	}
+	if err != nil {
+		return fmt.Errorf("open retrieval index: %w", err)
+	}
+	prev.Close()
+	p, err := project.LoadProject(dir)
+	if err != nil {
+		return err
+	}
+	opts := retrievalOptions{
+		EmbedProvider: prev.Meta.EmbedProvider,
+		EmbedModel:    prev.Meta.EmbedModel,
+		LockTimeout:   lockTimeout,
+		Redaction:     redactionPolicyFor(cfg, false, false),
+	}
+	provider, model := embeddingSettings(cfg, opts)
+	var emb retrieval.Embedder
+	if prev.Meta.EmbedProvider != "" {
+		if emb, err = defaultRetrievalDeps.newEmbedder(ctx, provider, model, cfg, opts); err != nil {
+			return fmt.Errorf("init embedder: %w", err)
+		}
+		if emb, err = opts.Redaction.embedder(emb, provider); err != nil {
+			return err
+		}
+	}
+	idx, err := refreshIndex(ctx, p, emb, indexBuildOptions(cfg, opts, provider, model), defaultRetrievalDeps)
+	if err != nil {
+		return fmt.Errorf("update retrieval index: %w", err)
+	}
+	fmt.Printf("✓ Index updated (%d chunks)\n", len(idx.Records))
+	return nil
+}
+
+// tick runs one poll: scan, sync, and the optional index update and
+// regeneration. Problems are reported and never stop the watcher.
+func (w *watcher) tick(ctx context.Context, now time.Time) {
+	p, err := project.LoadProject(w.dir)
+	if err != nil {
+		fmt.Printf("✗ %v\n", err)
+		return
+	}
+	ready := w.scan(p, now)
+	if len(ready) == 0 {
+		return
+	}
+	updated, err := w.sync(ready)
+	if err != nil {
+		fmt.Printf("✗ %v\n", err)
+		return
+	}
+	if updated == 0 {
+		return
+	}
+	if err := refreshWatchedIndex(ctx, w.dir); err != nil {
+		fmt.Printf("✗ %v\n", err)
+	}
+	if !watchGenerate {
+		return
+	}
+	last, err := loadLastGenerate(w.dir)
+	if err != nil {
+		fmt.Printf("✗ %v\n", err)
+		return
+	}
+	// Global flags given to the watcher (--config, --http-timeout, ...) apply
+	// to the runs it starts.
+	args := append(append([]string(nil), last.Args...), flagArgs(rootCmd.PersistentFlags(), "read-only")...)
+	if watchOutput != "" {
+		out, err := filepath.Abs(watchOutput)
+		if err != nil {
+			fmt.Printf("✗ %v\n", err)
+			return
+		}
+		args = append(args, "--output="+out)
+	}
+	workDir := p.BaseDir()
+	if st, err := os.Stat(last.Dir); err == nil && st.IsDir() {
+		workDir = last.Dir
+	}
+	fmt.Printf("⚙ Regenerating: docloom %s\n", strings.Join(args, " "))
+	if err := runGenerateArgs(ctx, workDir, args, childSecretEnv(w.dir)); err != nil {
+		fmt.Printf("✗ generate failed: %v\n", err)
+	}
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Keep a project in sync with its source files and optionally regenerate",
+	Long: `Polls the source file of every document. When a file changes and then stays unchanged
+for --debounce, it is re-parsed and the document is updated in place (ID, order, tags and
+relationships are kept). An existing retrieval index is updated incrementally. With
+--generate, the project's last generate run that called the model (not a --dry-run) is
+repeated with the same flags from the same working directory, writing to its --output file
+(or to --output given here). Global flags such as --config and the secret of an encrypted
+project are taken from this command, not recorded. A file that fails to parse is reported and
+retried after its next save; the watcher keeps running.`,
+	Example: `  docloom watch -p myproj
+  docloom watch -p myproj --generate --output report.md
+  docloom watch -p myproj --once`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireWritable(); err != nil {
+			return err
+		}
+		if watchInterval <= 0 {
+			return fmt.Errorf("--interval must be positive")
+		}
+		dir, err := projectDirFromFlag(watchProjectName)
+		if err != nil {
+			return err
+		}
+		p, err := project.LoadProject(dir)
+		if err != nil {
+			return err
+		}
+		if watchGenerate {
+			if _, err := loadLastGenerate(dir); err != nil {
+				return err
+			}
+		}
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if watchOnce {
+			newWatcher(dir, 0).tick(ctx, time.Now())
+			return nil
+		}
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+
+		fmt.Printf("👀 Watching %d document(s) of %s (poll every %s, debounce %s). Press Ctrl+C to stop.\n",
+			len(p.Documents), p.Name, watchInterval, watchDebounce)
+		w := newWatcher(dir, watchDebounce)
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				fmt.Println("Stopped watching.")
+				return nil
+			case now := <-ticker.C:
+				w.tick(ctx, now)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().StringVarP(&watchProjectName, "project", "p", "", "project name")
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", time.Second, "how often to check source files")
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", 500*time.Millisecond, "how long a changed file must stay unchanged before it is synced")
+	watchCmd.Flags().BoolVar(&watchGenerate, "generate", false, "rerun the project's last generate after each sync")
+	watchCmd.Flags().StringVar(&watchOutput, "output", "", "output file for --generate (default: the last run's --output)")
+	watchCmd.Flags().BoolVar(&watchOnce, "once", false, "sync changed documents once without debouncing and exit")
+}
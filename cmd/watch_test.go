@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
+)
+
+func TestWatcherDebouncesAndSurvivesParseFailures(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	spec := filepath.Join(home, "spec.md")
+	broken := filepath.Join(home, "broken.docx")
+	if err := os.WriteFile(spec, []byte("Version one."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runCmd(t, "init", "watched")
+	runCmd(t, "add", "-p", "watched", spec)
+	runCmd(t, "instruct", "-p", "watched", "Summarize")
+	runCmd(t, "generate", "-p", "watched", "--dry-run", "--prompt-limit", "500")
+
+	// A preview is not recorded as the run to repeat.
+	dir := filepath.Join(home, ".docloom", "projects", "watched")
+	if _, err := loadLastGenerate(dir); err == nil {
+		t.Fatal("a --dry-run must not be recorded")
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"Summary."},"done":true}`)
+	}))
+	defer srv.Close()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(home); err != nil {
+		t.Fatal(err)
+	}
+	runCmd(t, "generate", "-p", "watched", "--provider", "ollama", "--model", "ollama/watch-model",
+		"--ollama-host", srv.URL, "--prompt-limit", "500", "--output", "out.md")
+	last, err := loadLastGenerate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(last.Args, " "); !strings.Contains(got, "--project=watched") || !strings.Contains(got, "--prompt-limit=500") {
+		t.Fatalf("unexpected recorded args: %s", got)
+	}
+	if last.Dir != home {
+		t.Fatalf("recorded working directory %q, want %q", last.Dir, home)
+	}
+	if err := os.Chdir(wd); err != nil {
+		t.Fatal(err)
+	}
+
+	// Register a docx document, then corrupt its source.
+	p, err := project.LoadProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(broken, []byte("placeholder"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := p.AddParsed(broken, "", "Docx text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Save(); err != nil {
+		t.Fatal(err)
+	}
+	later := d.AddedAt.Add(time.Minute)
+	if err := os.WriteFile(spec, []byte("Version two."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{spec, broken} {
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var reran [][]string
+	oldRun := runGenerateArgs
+	defer func() { runGenerateArgs = oldRun; watchGenerate = false }()
+	runGenerateArgs = func(_ context.Context, workDir string, args, _ []string) error {
+		if workDir != home {
+			t.Errorf("regenerated in %q, want the recorded %q", workDir, home)
+		}
+		reran = append(reran, args)
+		return nil
+	}
+	watchGenerate = true
+
+	w := newWatcher(dir, time.Second)
+	start := time.Now()
+	w.tick(context.Background(), start)
+	if len(reran) != 0 {
+		t.Fatal("changes must wait for the debounce period")
+	}
+	w.tick(context.Background(), start.Add(2*time.Second))
+
+	p, err = project.LoadProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := p.ResolveDocument("spec.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := p.LoadContent(doc); !strings.Contains(text, "Version two") {
+		t.Fatalf("spec not re-parsed: %q", text)
+	}
+	bad, _ := p.ResolveDocument("broken.docx")
+	if text, _ := p.LoadContent(bad); text != "Docx text" {
+		t.Fatalf("failed parse must keep the old content, got %q", text)
+	}
+	if len(reran) != 1 || reran[0][0] != "generate" {
+		t.Fatalf("expected one regeneration, got %v", reran)
+	}
+
+	// Nothing changed since: the failed file is not retried until saved again.
+	w.tick(context.Background(), start.Add(4*time.Second))
+	if len(reran) != 1 {
+		t.Fatalf("unexpected regeneration: %v", reran)
+	}
+}
+
+func TestWatchKeepsSecretsOutOfRecordedRuns(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	doc := filepath.Join(home, "notes.md")
+	if err := os.WriteFile(doc, []byte("Version one."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(home, "project.key")
+	if err := os.WriteFile(keyFile, []byte("0123456789abcdef0123456789abcdef"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	runCmd(t, "init", "sealed-watch")
+	runCmd(t, "add", "-p", "sealed-watch", doc)
+	runCmd(t, "instruct", "-p", "sealed-watch", "Summarize")
+	runCmd(t, "project", "encrypt", "-p", "sealed-watch", "--key-file", keyFile)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"Summary."},"done":true}`)
+	}))
+	defer srv.Close()
+	runCmd(t, "generate", "-p", "sealed-watch", "--key-file", keyFile, "--provider", "ollama",
+		"--model", "ollama/watch-model", "--ollama-host", srv.URL, "--prompt-limit", "500")
+
+	dir := filepath.Join(home, ".docloom", "projects", "sealed-watch")
+	raw, err := os.ReadFile(filepath.Join(dir, lastGenerateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vault.Sealed(raw) {
+		t.Fatalf("%s written in plain text in an encrypted project", lastGenerateFile)
+	}
+	last, err := loadLastGenerate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(last.Args, " "); strings.Contains(got, "key-file") || strings.Contains(got, "passphrase-fd") {
+		t.Fatalf("secret flags recorded: %s", got)
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(doc, []byte("Version two."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(doc, later, later); err != nil {
+		t.Fatal(err)
+	}
+	var childEnv []string
+	oldRun := runGenerateArgs
+	defer func() { runGenerateArgs = oldRun; watchGenerate = false }()
+	runGenerateArgs = func(_ context.Context, _ string, _, env []string) error {
+		childEnv = env
+		return nil
+	}
+	watchGenerate = true
+	// As if the watcher itself was started with --key-file.
+	flagKeyFile = keyFile
+	defer func() { flagKeyFile = "" }()
+	newWatcher(dir, 0).tick(context.Background(), time.Now())
+	if want := envKeyFile + "=" + keyFile; !slices.Contains(childEnv, want) {
+		t.Fatalf("child env %v, want %s", childEnv, want)
+	}
+
+	// A broken index is reported, not mistaken for a missing one.
+	if err := os.WriteFile(filepath.Join(dir, "index.bin"), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := refreshWatchedIndex(context.Background(), dir); err == nil {
+		t.Fatal("expected an unreadable index to be reported")
+	}
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	cfgpkg "github.com/KaramelBytes/docloom-cli/internal/config"
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+)
+
+// workspaceProjects resolves the project names for a query: the -p project
+// first, then --projects, or the members of a named workspace from config.
+// Repeated names are dropped.
+func workspaceProjects(c *cfgpkg.Global, primary string, projects []string, workspace string) ([]string, error) {
+	if workspace != "" && len(projects) > 0 {
+		return nil, fmt.Errorf("use either --projects or --workspace, not both")
+	}
+	names := []string{primary}
+	if workspace != "" {
+		var members []string
+		if c != nil {
+			members = c.Workspaces[workspace]
+		}
+		if len(members) == 0 {
+			return nil, fmt.Errorf("unknown workspace %q (define it with 'docloom config set workspaces.%s <project,...>')%s", workspace, workspace, knownWorkspaces(c))
+		}
+		names = append(names, members...)
+	} else {
+		names = append(names, projects...)
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if n == "" || seen[n] {
+			continue
+		}
+		seen[n] = true
+		out = append(out, n)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("--project is required")
+	}
+	return out, nil
+}
+
+func knownWorkspaces(c *cfgpkg.Global) string {
+	if c == nil || len(c.Workspaces) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(c.Workspaces))
+	for n := range c.Workspaces {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return "; available: " + strings.Join(names, ", ")
+}
+
+// loadWorkspace loads the projects selected by -p, --projects or --workspace.
+// A single project is returned as is; several are merged into a read-only
+// project labelled with the workspace name (or the joined project names).
+// sources always lists the loaded projects so retrieval can search each
+// project's own index. Without any of them the enclosing local project is used.
+func loadWorkspace(c *cfgpkg.Global, primary string, projects []string, workspace string) (*project.Project, []*project.Project, error) {
+	if primary == "" && len(projects) == 0 && workspace == "" {
+		dir, err := projectDirFromFlag("")
+		if err != nil {
+			return nil, nil, err
+		}
+		p, err := project.LoadProject(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return p, []*project.Project{p}, nil
+	}
+	names, err := workspaceProjects(c, primary, projects, workspace)
+	if err != nil {
+		return nil, nil, err
+	}
+	sources := make([]*project.Project, 0, len(names))
+	for _, name := range names {
+		dir, err := resolveProjectDirByName(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		p, err := project.LoadProject(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, p)
+	}
+	if len(sources) == 1 {
+		return sources[0], sources, nil
+	}
+	label := workspace
+	if label == "" {
+		label = strings.Join(names, "+")
+	}
+	merged, err := project.Merge(label, sources...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, sources, nil
+}
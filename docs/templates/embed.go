@@ -0,0 +1,9 @@
+// Package templates embeds the built-in instruction templates shipped in docs/templates.
+package templates
+
+import "embed"
+
+// FS holds the built-in instruction templates (*.md).
+//
+//go:embed *.md
+var FS embed.FS
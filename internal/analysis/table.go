@@ -18,26 +18,26 @@ import (
 // Options controls analysis behavior for tabular data.
 type Options struct {
 	// MaxRows limits rows processed; 0 means unlimited.
-	MaxRows int
+	MaxRows int `json:"max_rows"`
 	// SampleRows determines how many example rows to include in the report.
-	SampleRows int
+	SampleRows int `json:"sample_rows"`
 	// Delimiter for CSV. If 0, auto-detects among ',', ';', '\t'.
-	Delimiter rune
+	Delimiter rune `json:"delimiter,omitempty"`
 	// GroupBy computes per-group summaries for the given column names.
-	GroupBy []string
+	GroupBy []string `json:"group_by,omitempty"`
 	// Correlations computes Pearson correlations among numeric columns.
-	Correlations bool
+	Correlations bool `json:"correlations,omitempty"`
 	// CorrPerGroup computes correlations per group key.
-	CorrPerGroup bool
+	CorrPerGroup bool `json:"corr_per_group,omitempty"`
 	// Numeric parsing locale. If DecimalSeparator is 0, auto-detect per value.
-	DecimalSeparator   rune
-	ThousandsSeparator rune // optional; if 0, auto-detect common separators (',' '.' space)
+	DecimalSeparator   rune `json:"decimal_separator,omitempty"`
+	ThousandsSeparator rune `json:"thousands_separator,omitempty"` // optional; if 0, auto-detect common separators (',' '.' space)
 	// Outlier detection via robust Z-score (MAD). If Outliers is true, counts |z|>threshold.
-	Outliers         bool
-	OutlierThreshold float64
+	Outliers         bool    `json:"outliers,omitempty"`
+	OutlierThreshold float64 `json:"outlier_threshold,omitempty"`
 	// Unit normalization: convert values to target units using simple mappings.
-	UnitNormalize bool
-	UnitTargets   map[string]string // map[fromUnit]toUnit, e.g., {"g/L":"mg/L", "ug/L":"mg/L", "°F":"°C"}
+	UnitNormalize bool              `json:"unit_normalize,omitempty"`
+	UnitTargets   map[string]string `json:"unit_targets,omitempty"` // map[fromUnit]toUnit, e.g., {"g/L":"mg/L", "ug/L":"mg/L", "°F":"°C"}
 }
 
 // DefaultOptions returns reasonable defaults for dataset analysis.
@@ -0,0 +1,106 @@
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+)
+
+// ArchivePath returns where Archive stores the named project.
+func ArchivePath(projectsDir, name string) string {
+	return filepath.Join(projectsDir, project.ArchiveDirName, name+Extension)
+}
+
+// Archive compresses a project into <projectsDir>/.archive/<name>.docloom.tgz
+// and removes its directory, hiding it from project listings. Unlike export,
+// paths to documents outside the project are kept as they are, and an
+// encrypted project stays sealed.
+func Archive(projectsDir, name string) (string, error) {
+	dir := filepath.Join(projectsDir, name)
+	out := ArchivePath(projectsDir, name)
+	// Keep writers out until the directory is gone.
+	p, err := project.LoadProjectForUpdate(dir)
+	if err != nil {
+		return "", err
+	}
+	defer p.Close()
+	if _, err := os.Stat(out); err == nil {
+		return "", fmt.Errorf("an archive for %s already exists at %s", name, out)
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return "", fmt.Errorf("create archive dir: %w", err)
+	}
+	if _, err := ExportToFile(dir, out, ExportOptions{KeepPaths: true, KeepSealed: true}); err != nil {
+		return "", err
+	}
+	// Verify the archive before deleting the only other copy.
+	if err := verifyFile(out); err != nil {
+		_ = os.Remove(out)
+		return "", err
+	}
+	_ = p.Close()
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("remove archived project directory: %w", err)
+	}
+	return out, nil
+}
+
+// Unarchive restores an archived project and removes the archive file.
+func Unarchive(projectsDir, name string) (string, error) {
+	path := ArchivePath(projectsDir, name)
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("no archived project named %q", name)
+		}
+		return "", fmt.Errorf("open archive: %w", err)
+	}
+	b, err := Read(f)
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+	dir, err := b.Install(projectsDir, name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Remove(path); err != nil {
+		return "", fmt.Errorf("remove archive: %w", err)
+	}
+	return dir, nil
+}
+
+// ListArchived returns the names of archived projects.
+func ListArchived(projectsDir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(projectsDir, project.ArchiveDirName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read archive dir: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), Extension); ok && !e.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func verifyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = Read(f)
+	return err
+}
@@ -0,0 +1,428 @@
+// Package bundle exports a project directory as a portable .docloom.tgz
+// archive and imports it back with integrity checks.
+//
+// An archive holds manifest.json followed by the project files. The manifest
+// records the format version and a SHA-256 checksum for every file; import
+// verifies all of them before anything is written to disk.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/KaramelBytes/docloom-cli/internal/utils"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
+)
+
+// FormatVersion is the bundle layout version written by Export.
+const FormatVersion = 1
+
+// Extension is the conventional suffix for bundle files.
+const Extension = ".docloom.tgz"
+
+const (
+	manifestName    = "manifest.json"
+	projectFileName = "project.json"
+	indexFileName   = "index.json"
+	lexicalFileName = "lexical.json"
+	binaryIndexName = "index.bin"
+	// maxFileSize guards import against oversized or malicious entries.
+	maxFileSize = 512 << 20
+)
+
+// Manifest describes the contents of a bundle.
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	Project       string    `json:"project"`
+	CreatedAt     time.Time `json:"created_at"`
+	// IndexStripped and ContentStripped record which export options were used.
+	IndexStripped   bool `json:"index_stripped,omitempty"`
+	ContentStripped bool `json:"content_stripped,omitempty"`
+	// Encrypted bundles hold an encrypted project's files still sealed,
+	// together with its encryption header.
+	Encrypted bool        `json:"encrypted,omitempty"`
+	Files     []FileEntry `json:"files"`
+}
+
+// FileEntry is a file stored in the bundle with its checksum.
+type FileEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ExportOptions tunes what goes into a bundle.
+type ExportOptions struct {
+	// StripIndex leaves out the retrieval index (the receiver rebuilds it).
+	StripIndex bool
+	// StripContent clears cached document content from project.json.
+	StripContent bool
+	// KeepPaths leaves paths outside the project absolute and keeps the
+	// history snapshots (used for local archives); paths inside the project
+	// are always made relative.
+	KeepPaths bool
+	// Decrypt writes an encrypted project's content in plain text.
+	Decrypt bool
+	// KeepSealed copies an encrypted project's files as they are stored,
+	// still sealed and with the encryption header, instead of failing.
+	KeepSealed bool
+}
+
+// ErrEncrypted is returned by Export for an encrypted project unless
+// ExportOptions.Decrypt or KeepSealed is set.
+var ErrEncrypted = errors.New("project is encrypted")
+
+// Export writes the project at dir as a gzipped tar to w. Absolute document
+// paths are rewritten: files inside the project become project-relative and
+// files elsewhere keep only their base name as provenance.
+//
+// An encrypted project is refused unless opts.Decrypt asks for plain content
+// or opts.KeepSealed asks for its files as stored; sealed files are copied
+// byte for byte, project.json included, so paths are not rewritten.
+func Export(dir string, w io.Writer, opts ExportOptions) (*Manifest, error) {
+	sealed := vault.IsEncrypted(dir) && !opts.Decrypt
+	if sealed && !opts.KeepSealed {
+		return nil, fmt.Errorf("%w: %s (use --decrypt to export it in plain text)", ErrEncrypted, dir)
+	}
+	if sealed && opts.StripContent {
+		return nil, fmt.Errorf("%w: content cannot be stripped from sealed files", ErrEncrypted)
+	}
+	p, err := project.LoadProject(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	err = filepath.WalkDir(dir, func(pth string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, pth)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel != "." && strings.HasPrefix(d.Name(), ".") && !(opts.KeepPaths && rel == project.HistoryDirName) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(rel, ".tmp") || strings.HasSuffix(rel, ".lock") {
+			return nil
+		}
+		// Plain bundles get a rewritten project.json and no header; the
+		// importer may encrypt its copy.
+		if !sealed && (rel == projectFileName || rel == vault.HeaderFile) {
+			return nil
+		}
+		if opts.StripIndex && (rel == indexFileName || rel == binaryIndexName || rel == lexicalFileName) {
+			return nil
+		}
+		if opts.StripContent && strings.HasPrefix(rel, project.BlobDirName+"/") {
+			return nil
+		}
+		read := vault.ReadFile
+		if sealed {
+			read = os.ReadFile
+		}
+		b, err := read(pth)
+		if err != nil {
+			return err
+		}
+		files[rel] = b
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("collect project files: %w", err)
+	}
+	if sealed {
+		return writeBundle(w, p.Name, files, opts)
+	}
+
+	for _, d := range p.Documents {
+		d.Path = relativeProvenance(dir, d.Path, opts.KeepPaths)
+		if d.Provenance != nil && d.Provenance.Source != "" {
+			d.Provenance.Source = relativeProvenance(dir, d.Provenance.Source, opts.KeepPaths)
+		}
+		if opts.StripContent {
+			d.Content = ""
+			d.ContentHash = ""
+		}
+	}
+	pj, err := utils.PrettyJSON(p)
+	if err != nil {
+		return nil, err
+	}
+	files[projectFileName] = pj
+	return writeBundle(w, p.Name, files, opts)
+}
+
+// writeBundle writes files with their manifest as a gzipped tar to w.
+func writeBundle(w io.Writer, name string, files map[string][]byte, opts ExportOptions) (*Manifest, error) {
+	_, encrypted := files[vault.HeaderFile]
+	m := &Manifest{
+		FormatVersion:   FormatVersion,
+		Project:         name,
+		CreatedAt:       time.Now().UTC(),
+		IndexStripped:   opts.StripIndex,
+		ContentStripped: opts.StripContent,
+		Encrypted:       encrypted,
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sum := sha256.Sum256(files[name])
+		m.Files = append(m.Files, FileEntry{Path: name, Size: int64(len(files[name])), SHA256: hex.EncodeToString(sum[:])})
+	}
+	mb, err := utils.PrettyJSON(m)
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	write := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: m.CreatedAt, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := write(manifestName, mb); err != nil {
+		return nil, fmt.Errorf("write bundle: %w", err)
+	}
+	for _, name := range names {
+		if err := write(name, files[name]); err != nil {
+			return nil, fmt.Errorf("write bundle: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("write bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("write bundle: %w", err)
+	}
+	return m, nil
+}
+
+// relativeProvenance converts an absolute document path into a portable one.
+func relativeProvenance(root, p string, keepExternal bool) string {
+	if p == "" || !filepath.IsAbs(p) {
+		return filepath.ToSlash(p)
+	}
+	if rel, err := filepath.Rel(root, p); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(rel)
+	}
+	if keepExternal {
+		return p
+	}
+	return filepath.Base(p)
+}
+
+// Bundle is a validated archive held in memory.
+type Bundle struct {
+	Manifest Manifest
+	// Project is nil for an encrypted bundle, whose project.json is sealed.
+	Project *project.Project
+	files   map[string][]byte
+}
+
+// Read loads and validates an archive: the manifest must be present and
+// supported, every file must be listed with a matching checksum, paths must
+// stay inside the project, and project.json must parse.
+func Read(r io.Reader) (*Bundle, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("invalid bundle: unsupported entry %s", hdr.Name)
+		}
+		name, err := cleanEntryName(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Size > maxFileSize {
+			return nil, fmt.Errorf("invalid bundle: %s exceeds %d bytes", name, maxFileSize)
+		}
+		if _, dup := files[name]; dup {
+			return nil, fmt.Errorf("invalid bundle: duplicate entry %s", name)
+		}
+		b, err := io.ReadAll(io.LimitReader(tr, maxFileSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle: read %s: %w", name, err)
+		}
+		files[name] = b
+	}
+
+	mb, ok := files[manifestName]
+	if !ok {
+		return nil, errors.New("invalid bundle: missing manifest.json")
+	}
+	delete(files, manifestName)
+	var m Manifest
+	if err := json.Unmarshal(mb, &m); err != nil {
+		return nil, fmt.Errorf("invalid bundle: parse manifest: %w", err)
+	}
+	if m.FormatVersion < 1 || m.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("unsupported bundle format version %d (this build supports up to %d)", m.FormatVersion, FormatVersion)
+	}
+	listed := make(map[string]bool, len(m.Files))
+	for _, f := range m.Files {
+		data, ok := files[f.Path]
+		if !ok {
+			return nil, fmt.Errorf("invalid bundle: %s listed in manifest but missing", f.Path)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != f.SHA256 || int64(len(data)) != f.Size {
+			return nil, fmt.Errorf("invalid bundle: checksum mismatch for %s", f.Path)
+		}
+		listed[f.Path] = true
+	}
+	for name := range files {
+		if !listed[name] {
+			return nil, fmt.Errorf("invalid bundle: %s is not listed in manifest", name)
+		}
+	}
+	pj, ok := files[projectFileName]
+	if !ok {
+		return nil, errors.New("invalid bundle: missing project.json")
+	}
+	if m.Encrypted {
+		if _, ok := files[vault.HeaderFile]; !ok {
+			return nil, fmt.Errorf("invalid bundle: encrypted bundle without %s", vault.HeaderFile)
+		}
+		return &Bundle{Manifest: m, files: files}, nil
+	}
+	p, err := project.Decode(pj)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	return &Bundle{Manifest: m, Project: p, files: files}, nil
+}
+
+func cleanEntryName(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid bundle: unsafe path %q", name)
+	}
+	return clean, nil
+}
+
+// ErrProjectExists is returned by Install when the target project already exists.
+var ErrProjectExists = errors.New("project already exists")
+
+// Install writes the bundle as project name under projectsDir. It refuses to
+// overwrite an existing project. Files are staged in a temporary directory
+// and moved into place once complete. Document paths that point at files in
+// the bundle are re-anchored to the new project directory. An encrypted
+// bundle is written as it is and keeps its own name.
+func (b *Bundle) Install(projectsDir, name string) (string, error) {
+	if name == "" {
+		name = b.Manifest.Project
+	}
+	if b.Manifest.Encrypted && name != b.Manifest.Project {
+		return "", fmt.Errorf("%w: an encrypted bundle can only be installed as %s", ErrEncrypted, b.Manifest.Project)
+	}
+	if err := project.ValidateName(name); err != nil {
+		return "", err
+	}
+	target := filepath.Join(projectsDir, name)
+	if _, err := os.Stat(target); err == nil {
+		return "", fmt.Errorf("%w: %s (use --name to import under a different name)", ErrProjectExists, target)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("stat project directory: %w", err)
+	}
+	if err := utils.EnsureProjectDir(projectsDir); err != nil {
+		return "", err
+	}
+	stage, err := os.MkdirTemp(projectsDir, ".import-"+name+"-")
+	if err != nil {
+		return "", fmt.Errorf("create staging dir: %w", err)
+	}
+	defer os.RemoveAll(stage)
+
+	for rel, data := range b.files {
+		if rel == projectFileName && !b.Manifest.Encrypted {
+			continue
+		}
+		dst := filepath.Join(stage, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return "", fmt.Errorf("create %s: %w", filepath.Dir(rel), err)
+		}
+		if err := os.WriteFile(dst, data, 0o644); err != nil {
+			return "", fmt.Errorf("write %s: %w", rel, err)
+		}
+	}
+
+	if b.Manifest.Encrypted {
+		if err := os.Rename(stage, target); err != nil {
+			return "", fmt.Errorf("move project into place: %w", err)
+		}
+		return target, nil
+	}
+	p, err := project.Decode(b.files[projectFileName])
+	if err != nil {
+		return "", err
+	}
+	p.Name = name
+	for _, d := range p.Documents {
+		if _, ok := b.files[d.Path]; ok && d.Path != projectFileName {
+			d.Path = filepath.Join(target, filepath.FromSlash(d.Path))
+		}
+	}
+	pj, err := utils.PrettyJSON(p)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(stage, projectFileName), pj, 0o644); err != nil {
+		return "", fmt.Errorf("write project.json: %w", err)
+	}
+	if err := os.Rename(stage, target); err != nil {
+		return "", fmt.Errorf("move project into place: %w", err)
+	}
+	return target, nil
+}
+
+// ExportToFile writes a bundle to path, replacing it atomically.
+func ExportToFile(dir, path string, opts ExportOptions) (*Manifest, error) {
+	var buf bytes.Buffer
+	m, err := Export(dir, &buf, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.SafeWriteFile(path, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
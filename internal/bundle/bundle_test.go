@@ -0,0 +1,302 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
+)
+
+func newTestProject(t *testing.T) (string, string) {
+	t.Helper()
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "projects", "demo")
+	ext := filepath.Join(tmp, "notes.md")
+	if err := os.WriteFile(ext, []byte("External notes."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "dataset_summaries"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	summary := filepath.Join(dir, "dataset_summaries", "sales.summary.md")
+	if err := os.WriteFile(summary, []byte("Sales summary."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), []byte(`{"records":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := project.NewProject("demo", "", dir)
+	p.SetInstructions("Summarize")
+	for _, f := range []string{ext, summary} {
+		if err := p.AddDocument(f, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Save(); err != nil {
+		t.Fatal(err)
+	}
+	return tmp, dir
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	tmp, dir := newTestProject(t)
+	var buf bytes.Buffer
+	m, err := Export(dir, &buf, ExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.FormatVersion != FormatVersion || len(m.Files) != 5 { // 2 blobs, summary, index, project.json
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+	b, err := Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range b.Project.Documents {
+		if filepath.IsAbs(d.Path) {
+			t.Fatalf("absolute path leaked into bundle: %s", d.Path)
+		}
+	}
+
+	dest := filepath.Join(tmp, "other")
+	if _, err := b.Install(dest, ""); err != nil {
+		t.Fatal(err)
+	}
+	got, err := project.LoadProject(filepath.Join(dest, "demo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Instructions != "Summarize" || len(got.Documents) != 2 {
+		t.Fatalf("imported project mismatch: %+v", got)
+	}
+	for _, d := range got.Documents {
+		switch d.Name {
+		case "sales.summary.md":
+			if d.Path != filepath.Join(dest, "demo", "dataset_summaries", "sales.summary.md") {
+				t.Fatalf("summary path not re-anchored: %s", d.Path)
+			}
+		case "notes.md":
+			text, err := got.LoadContent(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Path != "notes.md" || text != "External notes." {
+				t.Fatalf("external doc provenance wrong: %+v", d)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "demo", "index.json")); err != nil {
+		t.Fatalf("index not imported: %v", err)
+	}
+
+	if _, err := b.Install(dest, ""); !errors.Is(err, ErrProjectExists) {
+		t.Fatalf("expected collision error, got %v", err)
+	}
+	if _, err := b.Install(dest, "demo-2"); err != nil {
+		t.Fatalf("import under new name: %v", err)
+	}
+}
+
+func TestExportStripOptions(t *testing.T) {
+	_, dir := newTestProject(t)
+	var buf bytes.Buffer
+	m, err := Export(dir, &buf, ExportOptions{StripIndex: true, StripContent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range m.Files {
+		if f.Path == "index.json" || strings.HasPrefix(f.Path, "blobs/") {
+			t.Fatalf("%s should be stripped", f.Path)
+		}
+	}
+	b, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range b.Project.Documents {
+		if d.Content != "" || d.ContentHash != "" {
+			t.Fatalf("content should be stripped for %s", d.Name)
+		}
+	}
+}
+
+func TestArchiveKeepsHistory(t *testing.T) {
+	tmp, dir := newTestProject(t)
+	p, err := project.LoadProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Config.HistoryKeep = 5
+	for _, text := range []string{"First", "Second"} {
+		p.SetInstructions(text)
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, err := p.History()
+	if err != nil || len(before) != 2 {
+		t.Fatalf("expected 2 revisions, got %d (%v)", len(before), err)
+	}
+
+	projects := filepath.Join(tmp, "projects")
+	if _, err := Archive(projects, "demo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Unarchive(projects, "demo"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := project.LoadProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := got.History()
+	if err != nil || len(after) != len(before) || after[0].Rev != before[0].Rev {
+		t.Fatalf("history lost across archive: %+v (%v)", after, err)
+	}
+	if err := got.Rollback(before[0].Rev); err != nil {
+		t.Fatalf("rollback after unarchive: %v", err)
+	}
+	if got.Instructions != "First" {
+		t.Fatalf("rollback restored %q", got.Instructions)
+	}
+}
+
+func TestArchiveKeepsEncryptedProjectSealed(t *testing.T) {
+	tmp, dir := newTestProject(t)
+	secret := vault.Secret{Passphrase: "archive"}
+	if err := vault.Encrypt(dir, secret, []string{"project.json", project.BlobDirName, "dataset_summaries", "index.json"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Unlock(dir, secret); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := Export(dir, &buf, ExportOptions{}); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("expected encrypted project to be refused, got %v", err)
+	}
+	if _, err := Export(dir, &buf, ExportOptions{Decrypt: true}); err != nil {
+		t.Fatalf("export with Decrypt: %v", err)
+	}
+
+	projects := filepath.Join(tmp, "projects")
+	out, err := Archive(projects, "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, b := range readEntries(t, data) {
+		if name != "manifest.json" && name != vault.HeaderFile && !vault.Sealed(b) {
+			t.Fatalf("%s archived in plain text", name)
+		}
+	}
+	if _, err := Unarchive(projects, "demo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !vault.IsEncrypted(dir) {
+		t.Fatal("encryption header lost across archive")
+	}
+	for _, rel := range []string{"project.json", "index.json", filepath.Join("dataset_summaries", "sales.summary.md")} {
+		b, err := os.ReadFile(filepath.Join(dir, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !vault.Sealed(b) {
+			t.Fatalf("%s is no longer sealed after unarchive", rel)
+		}
+	}
+	blobs, err := os.ReadDir(filepath.Join(dir, project.BlobDirName))
+	if err != nil || len(blobs) == 0 {
+		t.Fatalf("blobs missing after unarchive: %v", err)
+	}
+	got, err := project.LoadProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Instructions != "Summarize" || len(got.Documents) != 2 {
+		t.Fatalf("unarchived project mismatch: %+v", got)
+	}
+}
+
+func TestReadRejectsTamperedAndUnsafeBundles(t *testing.T) {
+	_, dir := newTestProject(t)
+	var buf bytes.Buffer
+	if _, err := Export(dir, &buf, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	entries := readEntries(t, buf.Bytes())
+
+	tampered := map[string][]byte{}
+	for k, v := range entries {
+		tampered[k] = v
+	}
+	tampered["index.json"] = []byte(`{"records":[1]}`)
+	if _, err := Read(bytes.NewReader(writeEntries(t, tampered))); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+
+	unsafe := map[string][]byte{"../escape.txt": []byte("x"), "manifest.json": entries["manifest.json"]}
+	if _, err := Read(bytes.NewReader(writeEntries(t, unsafe))); err == nil || !strings.Contains(err.Error(), "unsafe path") {
+		t.Fatalf("expected unsafe path error, got %v", err)
+	}
+
+	future := map[string][]byte{"manifest.json": []byte(`{"format_version": 99, "files": []}`)}
+	if _, err := Read(bytes.NewReader(writeEntries(t, future))); err == nil || !strings.Contains(err.Error(), "unsupported bundle format") {
+		t.Fatalf("expected version error, got %v", err)
+	}
+}
+
+func readEntries(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	out := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		var b bytes.Buffer
+		if _, err := b.ReadFrom(tr); err != nil {
+			t.Fatal(err)
+		}
+		out[hdr.Name] = b.Bytes()
+	}
+	return out
+}
+
+func writeEntries(t *testing.T, entries map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -21,9 +21,27 @@ type Global struct {
 	RetrievalInclude         []string `mapstructure:"retrieval_include" yaml:"retrieval_include"`
 	RetrievalExclude         []string `mapstructure:"retrieval_exclude" yaml:"retrieval_exclude"`
 	RetrievalMaxChunksPerDoc int      `mapstructure:"retrieval_max_chunks_per_doc" yaml:"retrieval_max_chunks_per_doc"`
+	RetrievalMode            string   `mapstructure:"retrieval_mode" yaml:"retrieval_mode,omitempty"`
+	IndexFormat              string   `mapstructure:"index_format" yaml:"index_format,omitempty"`
+	IndexQuantization        string   `mapstructure:"index_quantization" yaml:"index_quantization,omitempty"`
 	MaxTokens                int      `mapstructure:"max_tokens" yaml:"max_tokens"`
 	Temperature              float64  `mapstructure:"temperature" yaml:"temperature"`
 	ProjectsDir              string   `mapstructure:"projects_dir" yaml:"projects_dir"`
+	// ProjectTokenLimit caps document tokens per project (0 derives the cap from
+	// the model's context window); ProjectWarnRatio is the share of the cap at
+	// which adds start warning.
+	ProjectTokenLimit int     `mapstructure:"project_token_limit" yaml:"project_token_limit,omitempty"`
+	ProjectWarnRatio  float64 `mapstructure:"project_warn_ratio" yaml:"project_warn_ratio,omitempty"`
+	// Workspaces names groups of projects queried together (generate --workspace).
+	Workspaces map[string][]string `mapstructure:"workspaces" yaml:"workspaces,omitempty"`
+	// Redact replaces sensitive values in prompts and embedded chunks with
+	// placeholders before they are sent to a remote provider; RedactLocal
+	// also redacts for Ollama. RedactDetectors limits the built-in detectors
+	// (empty runs all) and RedactRules adds named regular expressions.
+	Redact          bool              `mapstructure:"redact" yaml:"redact,omitempty"`
+	RedactLocal     bool              `mapstructure:"redact_local" yaml:"redact_local,omitempty"`
+	RedactDetectors []string          `mapstructure:"redact_detectors" yaml:"redact_detectors,omitempty"`
+	RedactRules     map[string]string `mapstructure:"redact_rules" yaml:"redact_rules,omitempty"`
 	// Models catalog auto-sync
 	ModelsCatalogURL string `mapstructure:"models_catalog_url" yaml:"models_catalog_url"`
 	ModelsAutoSync   bool   `mapstructure:"models_auto_sync" yaml:"models_auto_sync"`
@@ -88,6 +106,8 @@ func Load(cfgFile string) (*Global, error) {
 	v.SetDefault("retrieval_max_chunks_per_doc", 0)
 	v.SetDefault("max_tokens", 4096)
 	v.SetDefault("temperature", 0.7)
+	v.SetDefault("project_token_limit", 0)
+	v.SetDefault("project_warn_ratio", 0.8)
 	v.SetDefault("models_auto_sync", false)
 	v.SetDefault("models_merge", true)
 	v.SetDefault("models_provider", "")
@@ -0,0 +1,185 @@
+package ingest
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/KaramelBytes/docloom-cli/internal/parser"
+	"github.com/KaramelBytes/docloom-cli/internal/project"
+)
+
+// Options control which files are collected while walking directories and globs.
+type Options struct {
+	// Include, when non-empty, keeps only files matching at least one pattern.
+	Include []string
+	// Exclude drops files and directories matching any pattern.
+	Exclude []string
+}
+
+// Failure records a path that could not be collected or parsed.
+type Failure struct {
+	Path string
+	Err  error
+}
+
+// Candidates is the outcome of expanding CLI arguments into files.
+type Candidates struct {
+	Files       []string
+	Ignored     []string
+	Unsupported []string
+	Failed      []Failure
+}
+
+// Collect expands files, directories and glob patterns into a de-duplicated
+// list of files to ingest. Directories are walked recursively, honouring
+// .docloomignore files at every level plus the include/exclude patterns.
+// Files named literally are always kept; glob matches are filtered like
+// walked files except that ignore files do not apply to them.
+func Collect(args []string, opts Options) *Candidates {
+	c := &Candidates{}
+	inc := NewMatcher(opts.Include)
+	exc := NewMatcher(opts.Exclude)
+	seen := map[string]struct{}{}
+	add := func(path string) {
+		key := path
+		if abs, err := filepath.Abs(path); err == nil {
+			key = abs
+		}
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		c.Files = append(c.Files, path)
+	}
+
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err == nil {
+			if info.IsDir() {
+				c.walk(arg, inc, exc, add)
+			} else {
+				add(arg)
+			}
+			continue
+		}
+		matches, gerr := filepath.Glob(arg)
+		if gerr != nil || len(matches) == 0 {
+			c.Failed = append(c.Failed, Failure{Path: arg, Err: fmt.Errorf("no such file or matching pattern")})
+			continue
+		}
+		for _, m := range matches {
+			mi, err := os.Stat(m)
+			if err != nil {
+				c.Failed = append(c.Failed, Failure{Path: m, Err: err})
+				continue
+			}
+			if mi.IsDir() {
+				c.walk(m, inc, exc, add)
+				continue
+			}
+			name := filepath.Base(m)
+			if _, ig := exc.Match(name, false); ig {
+				c.Ignored = append(c.Ignored, m)
+				continue
+			}
+			if !inc.Empty() {
+				if _, keep := inc.Match(name, false); !keep {
+					c.Ignored = append(c.Ignored, m)
+					continue
+				}
+			}
+			if !parser.Supported(m) {
+				c.Unsupported = append(c.Unsupported, m)
+				continue
+			}
+			add(m)
+		}
+	}
+	return c
+}
+
+func (c *Candidates) walk(root string, inc, exc *Matcher, add func(string)) {
+	layers := map[string]*Matcher{}
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			c.Failed = append(c.Failed, Failure{Path: path, Err: err})
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		rel, rerr := filepath.Rel(root, path)
+		if rerr != nil {
+			rel = path
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel != "." {
+				// A local project's own state (project.json, history, blobs)
+				// is never a document.
+				if d.Name() == ".git" || d.Name() == project.LocalDirName {
+					return fs.SkipDir
+				}
+				_, excluded := exc.Match(rel, true)
+				if excluded || ignoredBy(layers, rel, true) {
+					c.Ignored = append(c.Ignored, path)
+					return fs.SkipDir
+				}
+			}
+			m, lerr := LoadIgnoreFile(filepath.Join(path, IgnoreFileName))
+			if lerr != nil {
+				c.Failed = append(c.Failed, Failure{Path: filepath.Join(path, IgnoreFileName), Err: lerr})
+			} else if m != nil {
+				layers[rel] = m
+			}
+			return nil
+		}
+		if d.Name() == IgnoreFileName {
+			return nil
+		}
+		if _, excluded := exc.Match(rel, false); excluded || ignoredBy(layers, rel, false) {
+			c.Ignored = append(c.Ignored, path)
+			return nil
+		}
+		if !inc.Empty() {
+			if _, keep := inc.Match(rel, false); !keep {
+				c.Ignored = append(c.Ignored, path)
+				return nil
+			}
+		}
+		if !parser.Supported(path) {
+			c.Unsupported = append(c.Unsupported, path)
+			return nil
+		}
+		add(path)
+		return nil
+	})
+}
+
+// ignoredBy evaluates ignore files from the walk root down to rel's parent so
+// that deeper files can override (or negate) patterns from their ancestors.
+func ignoredBy(layers map[string]*Matcher, rel string, isDir bool) bool {
+	ignored := false
+	dirs := []string{"."}
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		dirs = append(dirs, strings.Join(parts[:i], "/"))
+	}
+	for _, dir := range dirs {
+		m := layers[dir]
+		if m == nil {
+			continue
+		}
+		sub := rel
+		if dir != "." {
+			sub = strings.TrimPrefix(rel, dir+"/")
+		}
+		if matched, ig := m.Match(sub, isDir); matched {
+			ignored = ig
+		}
+	}
+	return ignored
+}
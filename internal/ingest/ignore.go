@@ -0,0 +1,154 @@
+package ingest
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileName is the per-directory ignore file honoured while walking.
+const IgnoreFileName = ".docloomignore"
+
+type rule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher evaluates gitignore-style patterns against slash-separated paths
+// relative to the directory the patterns belong to.
+type Matcher struct {
+	rules []rule
+}
+
+// NewMatcher compiles gitignore-style patterns. Blank lines and lines starting
+// with '#' are ignored; a leading '!' negates; a trailing '/' matches directories
+// only; a '/' anywhere else anchors the pattern to the matcher's base directory.
+func NewMatcher(patterns []string) *Matcher {
+	m := &Matcher{}
+	for _, raw := range patterns {
+		line := strings.TrimRight(raw, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var r rule
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		expr := globToRegexp(line)
+		if anchored {
+			expr = "^" + expr + "$"
+		} else {
+			expr = "(?:^|/)" + expr + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			continue
+		}
+		r.re = re
+		m.rules = append(m.rules, r)
+	}
+	return m
+}
+
+// LoadIgnoreFile reads patterns from path. A missing file yields a nil matcher.
+func LoadIgnoreFile(path string) (*Matcher, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return NewMatcher(lines), nil
+}
+
+// Match reports whether any rule matched rel and, if so, whether the last
+// matching rule ignores it (true) or re-includes it via negation (false).
+func (m *Matcher) Match(rel string, isDir bool) (matched, ignored bool) {
+	if m == nil {
+		return false, false
+	}
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(rel) {
+			matched = true
+			ignored = !r.negate
+		}
+	}
+	return matched, ignored
+}
+
+// Empty reports whether the matcher has no rules.
+func (m *Matcher) Empty() bool { return m == nil || len(m.rules) == 0 }
+
+// globToRegexp converts a gitignore glob into an unanchored regular expression.
+func globToRegexp(p string) string {
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch c {
+		case '*':
+			if i+1 < len(p) && p[i+1] == '*' {
+				// "**/" matches zero or more directories; any other "**" matches everything.
+				if i+2 < len(p) && p[i+2] == '/' {
+					sb.WriteString("(?:.*/)?")
+					i += 2
+				} else {
+					sb.WriteString(".*")
+					i++
+				}
+				continue
+			}
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			j := strings.IndexByte(p[i+1:], ']')
+			if j < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := p[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += j + 1
+		case '\\':
+			if i+1 < len(p) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(p[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
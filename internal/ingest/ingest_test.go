@@ -0,0 +1,129 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestMatcherGitignoreSemantics(t *testing.T) {
+	m := NewMatcher([]string{
+		"# comment",
+		"*.log",
+		"!keep.log",
+		"build/",
+		"/root-only.txt",
+		"docs/**/draft-*.md",
+	})
+	cases := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"a.log", false, true},
+		{"nested/dir/a.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"root-only.txt", false, true},
+		{"sub/root-only.txt", false, false},
+		{"docs/draft-1.md", false, true},
+		{"docs/a/b/draft-2.md", false, true},
+		{"docs/final.md", false, false},
+	}
+	for _, c := range cases {
+		if _, got := m.Match(c.rel, c.isDir); got != c.want {
+			t.Errorf("Match(%q, dir=%v) = %v, want %v", c.rel, c.isDir, got, c.want)
+		}
+	}
+}
+
+func TestCollectWalksWithIgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.md"), "a")
+	writeFile(t, filepath.Join(dir, "b.txt"), "b")
+	writeFile(t, filepath.Join(dir, "image.png"), "\x89PNG")
+	writeFile(t, filepath.Join(dir, "tmp", "scratch.md"), "x")
+	writeFile(t, filepath.Join(dir, "sub", "c.md"), "c")
+	writeFile(t, filepath.Join(dir, "sub", "secret.md"), "s")
+	writeFile(t, filepath.Join(dir, IgnoreFileName), "tmp/\n")
+	writeFile(t, filepath.Join(dir, "sub", IgnoreFileName), "secret.md\n")
+	writeFile(t, filepath.Join(dir, ".docloom", "project.json"), "{}")
+	writeFile(t, filepath.Join(dir, ".docloom", ".history", "log.json"), "[]")
+
+	c := Collect([]string{dir}, Options{Exclude: []string{"*.txt"}})
+	var got []string
+	for _, f := range c.Files {
+		rel, _ := filepath.Rel(dir, f)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "a.md,sub/c.md" {
+		t.Fatalf("unexpected files: %v", got)
+	}
+	if len(c.Unsupported) != 1 {
+		t.Fatalf("expected 1 unsupported, got %v", c.Unsupported)
+	}
+	// tmp/ directory, b.txt (exclude) and sub/secret.md (nested ignore)
+	if len(c.Ignored) != 3 {
+		t.Fatalf("expected 3 ignored, got %v", c.Ignored)
+	}
+}
+
+func TestCollectIncludeAndMissing(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.md"), "a")
+	writeFile(t, filepath.Join(dir, "b.txt"), "b")
+	c := Collect([]string{dir, filepath.Join(dir, "nope-*.md")}, Options{Include: []string{"*.md"}})
+	if len(c.Files) != 1 || filepath.Base(c.Files[0]) != "a.md" {
+		t.Fatalf("unexpected files: %v", c.Files)
+	}
+	if len(c.Failed) != 1 {
+		t.Fatalf("expected missing glob to be reported, got %v", c.Failed)
+	}
+}
+
+func TestParseAllBoundedAndOrdered(t *testing.T) {
+	paths := []string{"a", "b", "c", "d", "e", "f"}
+	var inFlight, peak int32
+	res := ParseAll(context.Background(), paths, 2, func(p string) (string, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+				break
+			}
+		}
+		defer atomic.AddInt32(&inFlight, -1)
+		if p == "c" {
+			return "", errors.New("boom")
+		}
+		return strings.ToUpper(p), nil
+	})
+	if peak > 2 {
+		t.Fatalf("expected at most 2 concurrent parses, saw %d", peak)
+	}
+	for i, r := range res {
+		if r.Path != paths[i] {
+			t.Fatalf("result %d out of order: %s", i, r.Path)
+		}
+	}
+	if res[2].Err == nil || res[0].Content != "A" {
+		t.Fatalf("unexpected results: %+v", res)
+	}
+}
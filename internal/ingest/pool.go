@@ -0,0 +1,57 @@
+package ingest
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// Result holds the parse outcome for one file.
+type Result struct {
+	Path    string
+	Content string
+	Err     error
+}
+
+// DefaultWorkers returns a conservative worker count for parsing.
+func DefaultWorkers() int {
+	n := runtime.NumCPU()
+	if n > 8 {
+		n = 8
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// ParseAll runs parse over paths using at most workers goroutines. Results are
+// returned in input order. A cancelled context marks remaining files as failed.
+func ParseAll(ctx context.Context, paths []string, workers int, parse func(string) (string, error)) []Result {
+	if workers <= 0 {
+		workers = DefaultWorkers()
+	}
+	results := make([]Result, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					results[i] = Result{Path: paths[i], Err: err}
+					continue
+				}
+				content, err := parse(paths[i])
+				results[i] = Result{Path: paths[i], Content: content, Err: err}
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,228 @@
+// Package injection screens document text for content that tries to steer
+// the model: instruction-like imperatives aimed at an AI, hidden Unicode
+// (zero-width and bidi override characters) and text a source format hides
+// from readers.
+package injection
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Finding kinds.
+const (
+	KindInstruction   = "instruction"
+	KindHiddenUnicode = "hidden-unicode"
+	KindHiddenText    = "hidden-text"
+)
+
+// MaxFindings caps how many findings are kept per document.
+const MaxFindings = 20
+
+// excerptWidth is the number of runes of context kept around a match.
+const excerptWidth = 40
+
+// Finding is one suspicious span. Offset is the byte offset in the scanned
+// text (-1 for hidden text, which has no position in the parsed content).
+type Finding struct {
+	Kind    string `json:"kind"`
+	Offset  int    `json:"offset"`
+	Excerpt string `json:"excerpt"`
+}
+
+// instructionPatterns match phrases addressed to a model rather than a
+// human reader. They are matched case-insensitively.
+var instructionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(ignore|disregard|forget|skip)\s+(all\s+|any\s+|the\s+|your\s+|of\s+)*(previous|prior|above|earlier|preceding|former|original|system)\s+(instructions?|prompts?|directions?|rules|context|messages?)\b`),
+	regexp.MustCompile(`(?i)\b(ignore|disregard|forget)\s+(everything|all)\s+(above|before|you\s+were\s+told)\b`),
+	regexp.MustCompile(`(?i)\boverride\s+(your|the|all|any)\s+(instructions|rules|guidelines|safety|system\s+prompt)\b`),
+	regexp.MustCompile(`(?i)\b(reveal|print|show|repeat|output)\s+(your|the)\s+(system\s+prompt|hidden\s+instructions|initial\s+instructions)\b`),
+	regexp.MustCompile(`(?i)\b(new|updated|revised|real)\s+(system\s+)?instructions\s*:`),
+	regexp.MustCompile(`(?i)\byou\s+are\s+now\s+(a|an|in|the|no\s+longer)\b`),
+	regexp.MustCompile(`(?i)\b(do\s+not|don'?t|never)\s+(tell|inform|mention\s+(this\s+)?to|reveal\s+(this\s+)?to|alert)\s+the\s+user\b`),
+	regexp.MustCompile(`(?i)\b(ai|llm|language\s+model|assistant|chatbot|gpt|claude)\s*[,:]\s*(you\s+)?(must|should|will|are\s+instructed\s+to)\b`),
+	regexp.MustCompile(`(?i)\b(if|when)\s+you\s+are\s+an?\s+(ai|llm|language\s+model|assistant)\b`),
+	regexp.MustCompile(`(?i)^\s*system\s*:\s*\S`),
+	regexp.MustCompile(`(?i)<\|?(im_start|system|endoftext)\|?>`),
+}
+
+// Scan returns findings for instruction-like phrases and hidden Unicode in
+// text, ordered by offset and capped at MaxFindings.
+func Scan(text string) []Finding {
+	var out []Finding
+	seen := map[int]bool{}
+	for _, line := range lineOffsets(text) {
+		for _, re := range instructionPatterns {
+			for _, m := range re.FindAllStringIndex(line.text, -1) {
+				at := line.offset + m[0]
+				if seen[at] {
+					continue
+				}
+				seen[at] = true
+				out = append(out, Finding{Kind: KindInstruction, Offset: at, Excerpt: excerpt(text, at, line.offset+m[1])})
+			}
+		}
+	}
+	out = append(out, scanHiddenUnicode(text)...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Offset < out[j].Offset })
+	return Limit(out)
+}
+
+// ScanHidden returns a finding for each span of text the source format hides
+// from readers, such as DOCX runs marked w:vanish.
+func ScanHidden(spans []string) []Finding {
+	var out []Finding
+	for _, s := range spans {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		out = append(out, Finding{Kind: KindHiddenText, Offset: -1, Excerpt: clip(visible(s))})
+	}
+	return Limit(out)
+}
+
+// Limit truncates findings to MaxFindings.
+func Limit(findings []Finding) []Finding {
+	if len(findings) > MaxFindings {
+		return findings[:MaxFindings]
+	}
+	return findings
+}
+
+// Summary renders findings as per-kind counts, e.g. "2 instruction, 1 hidden-unicode".
+func Summary(findings []Finding) string {
+	counts := map[string]int{}
+	var kinds []string
+	for _, f := range findings {
+		if counts[f.Kind] == 0 {
+			kinds = append(kinds, f.Kind)
+		}
+		counts[f.Kind]++
+	}
+	parts := make([]string, len(kinds))
+	for i, k := range kinds {
+		parts[i] = fmt.Sprintf("%d %s", counts[k], k)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// IsHidden reports whether r is a zero-width, bidi control or tag character
+// that renders invisibly.
+func IsHidden(r rune) bool {
+	switch {
+	case r == 0x200B, r == 0x200C, r == 0x200D, r == 0x2060, r == 0x180E, r == 0xFEFF:
+		return true // zero-width space, (non-)joiners, word joiner, mongolian separator, BOM
+	case r >= 0x202A && r <= 0x202E:
+		return true // bidi embeddings and overrides
+	case r >= 0x2066 && r <= 0x2069:
+		return true // bidi isolates
+	case r >= 0xE0000 && r <= 0xE007F:
+		return true // tag characters
+	}
+	return false
+}
+
+// scanHiddenUnicode reports each run of hidden characters once, listing the
+// code points it contains. A byte order mark at the very start is ignored.
+func scanHiddenUnicode(text string) []Finding {
+	type count struct {
+		r rune
+		n int
+	}
+	var out []Finding
+	start := -1
+	var run []count
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		codes := make([]string, len(run))
+		for i, c := range run {
+			codes[i] = fmt.Sprintf("U+%04X", c.r)
+			if c.n > 1 {
+				codes[i] += fmt.Sprintf("×%d", c.n)
+			}
+		}
+		out = append(out, Finding{Kind: KindHiddenUnicode, Offset: start, Excerpt: strings.Join(codes, " ") + " near " + excerpt(text, start, end)})
+		start, run = -1, nil
+	}
+	for i, r := range text {
+		if !IsHidden(r) || (i == 0 && r == 0xFEFF) {
+			flush(i)
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		if n := len(run); n > 0 && run[n-1].r == r {
+			run[n-1].n++
+		} else {
+			run = append(run, count{r: r, n: 1})
+		}
+	}
+	flush(len(text))
+	return out
+}
+
+type line struct {
+	offset int
+	text   string
+}
+
+func lineOffsets(text string) []line {
+	var out []line
+	offset := 0
+	for _, l := range strings.SplitAfter(text, "\n") {
+		out = append(out, line{offset: offset, text: l})
+		offset += len(l)
+	}
+	return out
+}
+
+// excerpt returns text[start:end] with some context on either side, hidden
+// characters made visible and whitespace collapsed.
+func excerpt(text string, start, end int) string {
+	from, to := start, end
+	for n := 0; n < excerptWidth && from > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:from])
+		from -= size
+	}
+	for n := 0; n < excerptWidth && to < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[to:])
+		to += size
+	}
+	s := visible(text[from:to])
+	if from > 0 {
+		s = "…" + s
+	}
+	if to < len(text) {
+		s += "…"
+	}
+	return s
+}
+
+// visible replaces hidden characters with their code points and collapses whitespace.
+func visible(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if IsHidden(r) {
+			fmt.Fprintf(&b, "<U+%04X>", r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func clip(s string) string {
+	const max = 3 * excerptWidth
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:max]) + "…"
+}
@@ -9,6 +9,8 @@ import (
 
 type csvParser struct{}
 
+func (csvParser) Name() string { return "csv" }
+
 func (csvParser) CanParse(filename string) bool {
 	name := strings.ToLower(filename)
 	return strings.HasSuffix(name, ".csv") || strings.HasSuffix(name, ".tsv")
@@ -24,7 +26,11 @@ func (csvParser) Parse(_ []byte) (string, error) {
 
 // ParseCSVFile provides CSV parsing from an absolute file path to a compact summary.
 func ParseCSVFile(path string) (string, error) {
-	rep, err := analysis.AnalyzeCSV(path, analysis.DefaultOptions())
+	return parseCSVFile(path, analysis.DefaultOptions())
+}
+
+func parseCSVFile(path string, opt analysis.Options) (string, error) {
+	rep, err := analysis.AnalyzeCSV(path, opt)
 	if err != nil {
 		return "", err
 	}
@@ -4,51 +4,108 @@ import (
 	"archive/zip"
 	"bytes"
 	"fmt"
+	"html"
 	"io"
 	"regexp"
 	"strings"
+
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
 )
 
 type docxParser struct{}
 
+func (docxParser) Name() string { return "docx" }
+
 func (docxParser) CanParse(filename string) bool {
 	return strings.HasSuffix(strings.ToLower(filename), ".docx")
 }
 
 func (docxParser) Parse(content []byte) (string, error) {
+	docXML, err := docxDocumentXML(content)
+	if err != nil {
+		return "", err
+	}
+	// Remove XML tags. This is simplistic but OK for MVP.
+	re := regexp.MustCompile(`<[^>]+>`) // matches tags
+	text := re.ReplaceAllString(string(docXML), "")
+	// Normalize whitespace
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.TrimSpace(text)
+	for strings.Contains(text, "\n\n\n") {
+		text = strings.ReplaceAll(text, "\n\n\n", "\n\n")
+	}
+	return text, nil
+}
+
+// docxDocumentXML extracts word/document.xml from a DOCX archive.
+func docxDocumentXML(content []byte) ([]byte, error) {
 	// DOCX is a zip archive; extract word/document.xml and strip XML tags as a naive text extraction
 	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
 	if err != nil {
-		return "", fmt.Errorf("open docx: %w", err)
+		return nil, fmt.Errorf("open docx: %w", err)
 	}
-	var docXML []byte
 	for _, f := range zr.File {
 		if f.Name == "word/document.xml" {
 			rc, err := f.Open()
 			if err != nil {
-				return "", fmt.Errorf("open document.xml: %w", err)
+				return nil, fmt.Errorf("open document.xml: %w", err)
 			}
 			b, err := io.ReadAll(rc)
 			_ = rc.Close()
 			if err != nil {
-				return "", fmt.Errorf("read document.xml: %w", err)
+				return nil, fmt.Errorf("read document.xml: %w", err)
+			}
+			if len(b) > 0 {
+				return b, nil
 			}
-			docXML = b
 			break
 		}
 	}
-	if len(docXML) == 0 {
-		return "", fmt.Errorf("document.xml not found in DOCX")
+	return nil, fmt.Errorf("document.xml not found in DOCX")
+}
+
+var (
+	docxRunRe    = regexp.MustCompile(`(?s)<w:r(?:\s[^>]*)?>.*?</w:r>`)
+	docxVanishRe = regexp.MustCompile(`<w:vanish(?:\s+w:val="(?:true|1|on)")?\s*/>`)
+	docxTextRe   = regexp.MustCompile(`(?s)<w:t(?:\s[^>]*)?>(.*?)</w:t>`)
+)
+
+// HiddenText returns the text of runs that a DOCX file at path marks as
+// hidden (w:vanish). Hidden runs with no visible text between them are
+// joined into one span. Other formats have no hidden text.
+func HiddenText(path string) ([]string, error) {
+	if !(docxParser{}).CanParse(path) {
+		return nil, nil
+	}
+	content, err := vault.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
-	// Remove XML tags. This is simplistic but OK for MVP.
-	re := regexp.MustCompile(`<[^>]+>`) // matches tags
-	text := re.ReplaceAllString(string(docXML), "")
-	// Normalize whitespace
-	text = strings.ReplaceAll(text, "\r\n", "\n")
-	text = strings.ReplaceAll(text, "\r", "\n")
-	text = strings.TrimSpace(text)
-	for strings.Contains(text, "\n\n\n") {
-		text = strings.ReplaceAll(text, "\n\n\n", "\n\n")
+	docXML, err := docxDocumentXML(content)
+	if err != nil {
+		return nil, err
 	}
-	return text, nil
+	var spans []string
+	prevEnd := -1
+	for _, loc := range docxRunRe.FindAllIndex(docXML, -1) {
+		run := docXML[loc[0]:loc[1]]
+		if !docxVanishRe.Match(run) {
+			continue
+		}
+		var text strings.Builder
+		for _, m := range docxTextRe.FindAllSubmatch(run, -1) {
+			text.WriteString(html.UnescapeString(string(m[1])))
+		}
+		if text.Len() == 0 {
+			continue
+		}
+		if prevEnd >= 0 && !docxTextRe.Match(docXML[prevEnd:loc[0]]) {
+			spans[len(spans)-1] += text.String()
+		} else {
+			spans = append(spans, text.String())
+		}
+		prevEnd = loc[1]
+	}
+	return spans, nil
 }
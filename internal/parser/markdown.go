@@ -7,6 +7,8 @@ import (
 
 type markdownParser struct{}
 
+func (markdownParser) Name() string { return "markdown" }
+
 func (markdownParser) CanParse(filename string) bool {
 	name := strings.ToLower(filename)
 	return strings.HasSuffix(name, ".md") || strings.HasSuffix(name, ".markdown")
@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/KaramelBytes/docloom-cli/internal/analysis"
+)
+
+// Version is recorded in document provenance. Bump it when parser output
+// changes so documents parsed by an older docloom can be told apart.
+const Version = "1"
+
+// AnalyzeName names the dataset analyzer behind 'docloom analyze' summaries.
+const AnalyzeName = "analyze"
+
+// Options tune how a file is parsed. The zero value parses as ParseFile does.
+// They are recorded in document provenance so a file can be re-parsed the
+// same way later.
+type Options struct {
+	// SheetName and SheetIndex (1-based) select the XLSX worksheet.
+	SheetName  string `json:"sheet_name,omitempty"`
+	SheetIndex int    `json:"sheet_index,omitempty"`
+	// Analysis configures the CSV/TSV/XLSX analyzer; nil uses analysis.DefaultOptions.
+	Analysis *analysis.Options `json:"analysis,omitempty"`
+}
+
+// IsZero reports whether o holds only defaults.
+func (o Options) IsZero() bool {
+	return o.SheetName == "" && o.SheetIndex == 0 && o.Analysis == nil
+}
+
+func (o Options) analysis() analysis.Options {
+	if o.Analysis == nil {
+		return analysis.DefaultOptions()
+	}
+	return *o.Analysis
+}
+
+func (o Options) sheetIndex() int {
+	if o.SheetIndex <= 0 {
+		return 1
+	}
+	return o.SheetIndex
+}
+
+// AnalyzeFile produces the dataset summary written by 'docloom analyze':
+// the analyzer's Markdown report for a CSV/TSV or XLSX file.
+func AnalyzeFile(path string, opts Options) (string, error) {
+	if strings.HasSuffix(strings.ToLower(path), ".xlsx") {
+		rep, err := analysis.AnalyzeXLSX(path, opts.analysis(), opts.SheetName, opts.sheetIndex())
+		if err != nil {
+			return "", err
+		}
+		return rep.Markdown(), nil
+	}
+	rep, err := analysis.AnalyzeCSV(path, opts.analysis())
+	if err != nil {
+		return "", err
+	}
+	return rep.Markdown(), nil
+}
+
+// DatasetOptions builds the options recorded for an analyzed dataset; the
+// sheet selection only applies to XLSX files.
+func DatasetOptions(path, sheetName string, sheetIndex int, opt analysis.Options) Options {
+	o := Options{Analysis: &opt}
+	if strings.HasSuffix(strings.ToLower(path), ".xlsx") {
+		o.SheetName, o.SheetIndex = sheetName, sheetIndex
+	}
+	return o
+}
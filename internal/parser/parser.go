@@ -3,13 +3,17 @@ package parser
 import (
 	"errors"
 	"fmt"
-	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/KaramelBytes/docloom-cli/internal/utils"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
 )
 
 // Parser defines a document parser implementation.
 type Parser interface {
+	// Name identifies the parser in document provenance.
+	Name() string
 	CanParse(filename string) bool
 	Parse(content []byte) (string, error)
 }
@@ -23,7 +27,12 @@ func Register(p Parser) {
 
 // ParseFile selects a parser based on filename and returns parsed text content.
 func ParseFile(path string) (string, error) {
-	data, err := os.ReadFile(path)
+	return ParseFileWithOptions(path, Options{})
+}
+
+// ParseFileWithOptions is ParseFile with options for the tabular parsers.
+func ParseFileWithOptions(path string, opts Options) (string, error) {
+	data, err := vault.ReadFile(path)
 	if err != nil {
 		return "", fmt.Errorf("read file: %w", err)
 	}
@@ -32,9 +41,9 @@ func ParseFile(path string) (string, error) {
 			// Special-case parsers that need file path context
 			switch tp := p.(type) {
 			case csvParser:
-				return ParseCSVFile(path)
+				return parseCSVFile(path, opts.analysis())
 			case xlsxParser:
-				return ParseXLSXFile(path, "", 1)
+				return ParseXLSXFileWithOptions(path, opts.SheetName, opts.sheetIndex(), opts.analysis())
 			default:
 				return tp.Parse(data)
 			}
@@ -44,6 +53,19 @@ func ParseFile(path string) (string, error) {
 	return string(data), nil
 }
 
+// PlainTextName names the fallback used for files without a registered parser.
+const PlainTextName = "plain"
+
+// Name returns the name of the parser ParseFile uses for path.
+func Name(path string) string {
+	for _, p := range registry {
+		if p.CanParse(path) {
+			return p.Name()
+		}
+	}
+	return PlainTextName
+}
+
 // EstimateTokens delegates to utils.CountTokens for now.
 func EstimateTokens(text string) int {
 	return utils.CountTokens(text)
@@ -60,3 +82,25 @@ func init() {
 
 // ErrUnsupported indicates a format is not supported yet.
 var ErrUnsupported = errors.New("unsupported document format")
+
+// plainTextExtensions lists formats without a dedicated parser that are still
+// safe to ingest through the plain-text fallback.
+var plainTextExtensions = map[string]struct{}{
+	".yaml": {}, ".yml": {}, ".json": {}, ".toml": {}, ".ini": {},
+	".xml": {}, ".html": {}, ".htm": {}, ".rst": {}, ".adoc": {},
+	".log": {}, ".go": {}, ".py": {}, ".js": {}, ".ts": {}, ".java": {},
+	".rs": {}, ".sh": {}, ".sql": {},
+}
+
+// Supported reports whether path has a registered parser or a known text extension.
+// ParseFile itself accepts anything; Supported is used when walking directories so
+// binaries and other unknown files are skipped instead of ingested as text.
+func Supported(path string) bool {
+	for _, p := range registry {
+		if p.CanParse(path) {
+			return true
+		}
+	}
+	_, ok := plainTextExtensions[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
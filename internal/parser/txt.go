@@ -4,6 +4,8 @@ import "strings"
 
 type txtParser struct{}
 
+func (txtParser) Name() string { return "text" }
+
 func (txtParser) CanParse(filename string) bool {
 	return strings.HasSuffix(strings.ToLower(filename), ".txt")
 }
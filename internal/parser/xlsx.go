@@ -10,6 +10,8 @@ import (
 
 type xlsxParser struct{}
 
+func (xlsxParser) Name() string { return "xlsx" }
+
 func (xlsxParser) CanParse(filename string) bool {
 	return strings.HasSuffix(strings.ToLower(filename), ".xlsx")
 }
@@ -20,7 +22,12 @@ func (xlsxParser) Parse(_ []byte) (string, error) {
 
 // ParseXLSXFile analyzes the first sheet and returns a compact summary.
 func ParseXLSXFile(path string, sheetName string, sheetIndex int) (string, error) {
-	rep, err := analysis.AnalyzeXLSX(path, analysis.DefaultOptions(), sheetName, sheetIndex)
+	return ParseXLSXFileWithOptions(path, sheetName, sheetIndex, analysis.DefaultOptions())
+}
+
+// ParseXLSXFileWithOptions is ParseXLSXFile with explicit analysis options.
+func ParseXLSXFileWithOptions(path string, sheetName string, sheetIndex int, opt analysis.Options) (string, error) {
+	rep, err := analysis.AnalyzeXLSX(path, opt, sheetName, sheetIndex)
 	if err != nil {
 		return "", err
 	}
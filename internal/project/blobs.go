@@ -0,0 +1,240 @@
+package project
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
+)
+
+// BlobDirName holds gzip-compressed document content addressed by SHA-256,
+// as blobs/<first two hex digits>/<hash>.gz. Blobs are immutable, so
+// identical content is stored once and clones can share files via hard links.
+const BlobDirName = "blobs"
+
+// ContentHash returns the blob address for content.
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *Project) blobPath(hash string) string {
+	return filepath.Join(p.rootDir, BlobDirName, hash[:2], hash+".gz")
+}
+
+func (p *Project) writeBlob(hash, content string) error {
+	path := p.blobPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create blob dir: %w", err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(content)); err != nil {
+		return fmt.Errorf("compress blob: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("compress blob: %w", err)
+	}
+	return vault.WriteFile(path, buf.Bytes())
+}
+
+func (p *Project) readBlob(hash string) (string, error) {
+	if len(hash) < 2 {
+		return "", fmt.Errorf("invalid content hash %q", hash)
+	}
+	data, err := vault.ReadFile(p.blobPath(hash))
+	if err != nil {
+		return "", fmt.Errorf("read blob %s: %w", hash, err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("read blob %s: %w", hash, err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("read blob %s: %w", hash, err)
+	}
+	if ContentHash(string(b)) != hash {
+		return "", fmt.Errorf("blob %s is corrupt (checksum mismatch)", hash)
+	}
+	return string(b), nil
+}
+
+// LoadContent returns a document's text, reading it from the blob store the
+// first time it is needed.
+func (p *Project) LoadContent(d *Document) (string, error) {
+	if d.Content != "" || d.ContentHash == "" {
+		return d.Content, nil
+	}
+	text, err := p.readBlob(d.ContentHash)
+	if err != nil {
+		return "", fmt.Errorf("load content of %s: %w", d.Name, err)
+	}
+	d.Content = text
+	return text, nil
+}
+
+// LoadAllContent loads the text of every document.
+func (p *Project) LoadAllContent() error {
+	for _, d := range p.Documents {
+		if _, err := p.LoadContent(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InlineContentCount reports documents whose content is still stored inline in
+// project.json (projects written before the blob store). Save migrates them.
+func (p *Project) InlineContentCount() int {
+	n := 0
+	for _, d := range p.Documents {
+		if d.ContentHash == "" && d.Content != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// storeContent writes loaded document content to the blob store and records
+// its hash. Documents whose content was never loaded are left untouched.
+func (p *Project) storeContent() error {
+	for _, d := range p.Documents {
+		if d.Content == "" && d.ContentHash != "" {
+			continue
+		}
+		hash := ContentHash(d.Content)
+		if err := p.writeBlob(hash, d.Content); err != nil {
+			return err
+		}
+		d.ContentHash = hash
+	}
+	return nil
+}
+
+// persisted returns the form written to project.json: documents carry hashes
+// and no inline content.
+func (p *Project) persisted() *Project {
+	cp := *p
+	cp.Documents = make(map[string]*Document, len(p.Documents))
+	for id, d := range p.Documents {
+		dc := *d
+		dc.Content = ""
+		cp.Documents[id] = &dc
+	}
+	return &cp
+}
+
+// contentHashes returns the blob addresses of the project's documents.
+func (p *Project) contentHashes() map[string]bool {
+	hashes := make(map[string]bool, len(p.Documents))
+	for _, d := range p.Documents {
+		if d.ContentHash != "" {
+			hashes[d.ContentHash] = true
+		}
+	}
+	return hashes
+}
+
+func union(a, b map[string]bool) map[string]bool {
+	out := make(map[string]bool, len(a)+len(b))
+	for h := range a {
+		out[h] = true
+	}
+	for h := range b {
+		out[h] = true
+	}
+	return out
+}
+
+// gcBlobs removes the candidate blobs referenced neither by the project nor
+// by a retained history snapshot. Candidates are the hashes a save dropped or
+// pruned snapshots released, so a save costs O(documents), not O(history).
+func (p *Project) gcBlobs(candidates map[string]bool) error {
+	live := p.contentHashes()
+	var dead []string
+	for h := range candidates {
+		if !live[h] {
+			dead = append(dead, h)
+		}
+	}
+	if len(dead) == 0 {
+		return nil
+	}
+	refs, err := p.historyRefs()
+	if err != nil {
+		return err
+	}
+	for _, h := range dead {
+		if refs[h] > 0 || len(h) < 2 {
+			continue
+		}
+		if err := os.Remove(p.blobPath(h)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// sweepBlobs walks the whole blob store and removes every blob referenced
+// neither by the project nor by a retained history snapshot. It recounts the
+// snapshot references from scratch and repairs .history/refs.json.
+func (p *Project) sweepBlobs() error {
+	live := p.contentHashes()
+	refs, err := p.scanHistoryRefs()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(p.historyDir()); err == nil {
+		if err := p.writeHistoryRefs(refs); err != nil {
+			return err
+		}
+	}
+	root := filepath.Join(p.rootDir, BlobDirName)
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		hash, ok := strings.CutSuffix(d.Name(), ".gz")
+		if ok && !live[hash] && refs[hash] == 0 {
+			return os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// Compact saves the project, migrating inline content to the blob store, and
+// sweeps the whole store for unreferenced blobs, such as those left by an
+// interrupted save.
+func (p *Project) Compact() error {
+	if p.rootDir == "" {
+		return errors.New("project root directory not set")
+	}
+	return p.withLock(func() error {
+		if err := p.save(); err != nil {
+			return err
+		}
+		if err := p.sweepBlobs(); err != nil {
+			return fmt.Errorf("clean blob store: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,258 @@
+package project
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KaramelBytes/docloom-cli/internal/utils"
+)
+
+// Per-document truncation strategies used when a prompt limit applies.
+const (
+	TruncateHead     = "head"      // keep the beginning
+	TruncateHeadTail = "head-tail" // keep the beginning and the end
+	TruncateSections = "sections"  // keep the first part of every section
+)
+
+// Allocation modes for distributing a prompt budget across documents.
+const (
+	AllocateBySize     = "size"     // shares proportional to document size, scaled by priority
+	AllocateByPriority = "priority" // shares weighted by document priority only
+)
+
+// minDocShare is the smallest useful allocation; documents that would get less
+// are dropped (lowest priority first) and their budget redistributed.
+const minDocShare = 64
+
+// ValidTruncation reports whether s names a known truncation strategy ("" means default).
+func ValidTruncation(s string) bool {
+	switch s {
+	case "", TruncateHead, TruncateHeadTail, TruncateSections:
+		return true
+	}
+	return false
+}
+
+// TruncationMarker marks a span removed from a document.
+func TruncationMarker(tokens int) string {
+	return fmt.Sprintf("[... truncated %d tokens ...]", tokens)
+}
+
+// allocateBudget distributes budget tokens across documents. Pinned documents
+// are served first; the rest share what remains by weight. Documents whose
+// share would fall below minDocShare are dropped in trim order.
+func allocateBudget(ordered []*Document, demand map[string]int, budget int, mode string) (map[string]int, []*Document) {
+	alloc := make(map[string]int, len(ordered))
+	for _, d := range ordered {
+		if !d.Pinned {
+			continue
+		}
+		give := demand[d.ID]
+		if give > budget {
+			give = budget
+		}
+		if give < minDocShare {
+			give = minDocShare
+		}
+		alloc[d.ID] = give
+		budget -= give
+	}
+	if budget < 0 {
+		budget = 0
+	}
+
+	active := map[string]bool{}
+	for _, d := range ordered {
+		if !d.Pinned {
+			active[d.ID] = true
+		}
+	}
+	weight := func(d *Document) float64 {
+		// low=1, normal=2, high=4, ...
+		w := 2.0
+		for i := 0; i < d.Priority; i++ {
+			w *= 2
+		}
+		for i := 0; i > d.Priority; i-- {
+			w /= 2
+		}
+		if mode == AllocateByPriority || demand[d.ID] <= 0 {
+			return w
+		}
+		return w * float64(demand[d.ID])
+	}
+
+	var dropped []*Document
+	drops := trimOrder(ordered)
+	for {
+		shares := waterFill(ordered, active, demand, budget, weight)
+		starved := false
+		for id, s := range shares {
+			if s < minDocShare && s < demand[id] {
+				starved = true
+				break
+			}
+		}
+		if !starved {
+			for id, s := range shares {
+				alloc[id] = s
+			}
+			return alloc, dropped
+		}
+		// Drop the next document in trim order and try again.
+		for len(drops) > 0 && !active[drops[0].ID] {
+			drops = drops[1:]
+		}
+		if len(drops) == 0 {
+			for id, s := range shares {
+				alloc[id] = s
+			}
+			return alloc, dropped
+		}
+		delete(active, drops[0].ID)
+		dropped = append(dropped, drops[0])
+		drops = drops[1:]
+	}
+}
+
+// waterFill gives each active document min(demand, weighted share) and
+// redistributes what smaller documents leave unused.
+func waterFill(ordered []*Document, active map[string]bool, demand map[string]int, budget int, weight func(*Document) float64) map[string]int {
+	shares := map[string]int{}
+	open := make([]*Document, 0, len(active))
+	for _, d := range ordered {
+		if active[d.ID] {
+			open = append(open, d)
+		}
+	}
+	remaining := budget
+	for len(open) > 0 {
+		total := 0.0
+		for _, d := range open {
+			total += weight(d)
+		}
+		var next []*Document
+		satisfied := false
+		for _, d := range open {
+			share := int(float64(remaining) * weight(d) / total)
+			if demand[d.ID] <= share {
+				shares[d.ID] = demand[d.ID]
+				satisfied = true
+				continue
+			}
+			next = append(next, d)
+		}
+		if !satisfied {
+			for _, d := range open {
+				shares[d.ID] = int(float64(remaining) * weight(d) / total)
+			}
+			break
+		}
+		remaining = budget
+		for _, s := range shares {
+			remaining -= s
+		}
+		open = next
+	}
+	return shares
+}
+
+// truncateContent shrinks content to roughly limit tokens using strategy and
+// marks removed spans. It returns the text and the number of tokens removed.
+func truncateContent(content string, limit int, strategy string) (string, int) {
+	total := utils.CountTokens(content)
+	if total <= limit {
+		return content, 0
+	}
+	keep := limit - utils.CountTokens(TruncationMarker(total)) - 1
+	if keep < 0 {
+		keep = 0
+	}
+	switch strategy {
+	case TruncateHeadTail:
+		head := utils.TruncateToTokenLimit(content, keep/2)
+		tail := utils.TruncateTailToTokenLimit(content, keep-keep/2)
+		removed := total - utils.CountTokens(head) - utils.CountTokens(tail)
+		return head + "\n" + TruncationMarker(removed) + "\n" + tail, removed
+	case TruncateSections:
+		if out, removed, ok := truncateSections(content, keep); ok {
+			return out, removed
+		}
+		return truncateHead(content, keep, total)
+	default:
+		return truncateHead(content, keep, total)
+	}
+}
+
+func truncateHead(content string, keep, total int) (string, int) {
+	head := utils.TruncateToTokenLimit(content, keep)
+	removed := total - utils.CountTokens(head)
+	return head + "\n" + TruncationMarker(removed), removed
+}
+
+// truncateSections keeps the first part of every Markdown section (or
+// paragraph, when there are no headings) so the whole outline survives. It
+// reports false when sections are too many or too few for this to help.
+func truncateSections(content string, keep int) (string, int, bool) {
+	sections := splitSections(content)
+	if len(sections) <= 1 {
+		return "", 0, false
+	}
+	per := keep / len(sections)
+	markerCost := utils.CountTokens(TruncationMarker(1000)) + 1
+	if per < 2*markerCost {
+		return "", 0, false
+	}
+	var out []string
+	removed := 0
+	for _, sec := range sections {
+		t := utils.CountTokens(sec)
+		if t <= per {
+			out = append(out, sec)
+			continue
+		}
+		budget := per - markerCost
+		if budget < 0 {
+			budget = 0
+		}
+		head := utils.TruncateToTokenLimit(sec, budget)
+		r := t - utils.CountTokens(head)
+		removed += r
+		out = append(out, strings.TrimRight(head, "\n")+"\n"+TruncationMarker(r))
+	}
+	return strings.Join(out, "\n\n"), removed, true
+}
+
+func splitSections(content string) []string {
+	lines := strings.Split(content, "\n")
+	var sections []string
+	var cur []string
+	hasHeading := false
+	for _, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "#") {
+			hasHeading = true
+			if sec := strings.TrimSpace(strings.Join(cur, "\n")); sec != "" {
+				sections = append(sections, sec)
+			}
+			cur = nil
+		}
+		cur = append(cur, l)
+	}
+	if sec := strings.TrimSpace(strings.Join(cur, "\n")); sec != "" {
+		sections = append(sections, sec)
+	}
+	if !hasHeading {
+		return splitParagraphs(content)
+	}
+	return sections
+}
+
+func splitParagraphs(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -1,14 +1,40 @@
 package project
 
-import "time"
+import (
+	"time"
+
+	"github.com/KaramelBytes/docloom-cli/internal/injection"
+)
 
 // Document holds metadata and cached content for a project document.
 type Document struct {
-	ID          string    `json:"id"`
-	Path        string    `json:"path"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Content     string    `json:"content"`
+	ID          string `json:"id"`
+	Path        string `json:"path"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Content is the parsed text. It is loaded lazily from the blob store (see
+	// LoadContent); older project.json files carry it inline.
+	Content string `json:"content,omitempty"`
+	// ContentHash addresses the content in the project's blob store.
+	ContentHash string    `json:"content_hash,omitempty"`
 	Tokens      int       `json:"tokens"`
 	AddedAt     time.Time `json:"added_at"`
+	// Order controls placement in the prompt (ascending); 0 means unordered.
+	Order int `json:"order,omitempty"`
+	// Priority decides what is trimmed first under a prompt limit (higher is kept longer).
+	Priority int `json:"priority,omitempty"`
+	// Pinned documents are never trimmed.
+	Pinned bool `json:"pinned,omitempty"`
+	// Truncation is the strategy used when the document must be shortened: head|head-tail|sections.
+	Truncation string `json:"truncation,omitempty"`
+	// Tags group documents for selection at generate time (see Selection).
+	Tags []string `json:"tags,omitempty"`
+	// Fingerprint is the hex SimHash of the content used for near-duplicate detection.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Provenance records the parser, options and source checksum (see Refresh).
+	Provenance *Provenance `json:"provenance,omitempty"`
+	// Screening lists spans that look like prompt injection (see Screen).
+	Screening []injection.Finding `json:"screening,omitempty"`
+	// Project names the origin project in a merged workspace (see Merge).
+	Project string `json:"-"`
 }
@@ -0,0 +1,472 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KaramelBytes/docloom-cli/internal/utils"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
+)
+
+// HistoryDirName holds project snapshots inside the project directory.
+const HistoryDirName = ".history"
+
+// DefaultHistoryKeep is the retention used when history is enabled without a limit.
+const DefaultHistoryKeep = 20
+
+// Revision is one entry in a project's history log.
+type Revision struct {
+	Rev       string    `json:"rev"`
+	CreatedAt time.Time `json:"created_at"`
+	Documents int       `json:"documents"`
+}
+
+// snapshot is the stored form of a revision. Document content lives in the
+// project's blob store, so unchanged text costs nothing per snapshot.
+type snapshot struct {
+	Project  *Project          `json:"project"`
+	Contents map[string]string `json:"contents"`
+}
+
+func (p *Project) historyDir() string { return filepath.Join(p.rootDir, HistoryDirName) }
+
+// HistoryEnabled reports whether Save records snapshots.
+func (p *Project) HistoryEnabled() bool { return p.Config != nil && p.Config.HistoryKeep > 0 }
+
+// recordSnapshot stores the current state as a revision unless it matches the
+// latest one, then applies the retention policy. It expects storeContent to
+// have run so every document has a ContentHash. It returns the content hashes
+// no retained snapshot references any more.
+func (p *Project) recordSnapshot() (map[string]bool, error) {
+	dir := p.historyDir()
+	if err := os.MkdirAll(filepath.Join(dir, "revs"), 0o755); err != nil {
+		return nil, err
+	}
+	cp := p.persisted()
+	cp.UpdatedAt = time.Time{}
+	snap := snapshot{Project: cp, Contents: make(map[string]string, len(p.Documents))}
+	for id, d := range p.Documents {
+		snap.Contents[id] = d.ContentHash
+	}
+	data, err := utils.PrettyJSON(snap)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	rev := hex.EncodeToString(sum[:])[:12]
+
+	log, err := p.History()
+	if err != nil {
+		return nil, err
+	}
+	if len(log) > 0 && log[len(log)-1].Rev == rev {
+		return nil, nil
+	}
+	refs, err := p.historyRefs()
+	if err != nil {
+		return nil, err
+	}
+	revPath := filepath.Join(dir, "revs", rev+".json")
+	if _, err := os.Stat(revPath); errors.Is(err, fs.ErrNotExist) {
+		// Count references before the file exists: after a crash the counts
+		// may be too high (a leak 'project compact' repairs), never too low.
+		for h := range distinct(snap.Contents) {
+			refs[h]++
+		}
+		if err := p.writeHistoryRefs(refs); err != nil {
+			return nil, err
+		}
+		if err := vault.WriteFile(revPath, data); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	log = append(log, Revision{Rev: rev, CreatedAt: p.UpdatedAt, Documents: len(p.Documents)})
+	if keep := p.Config.HistoryKeep; len(log) > keep {
+		log = log[len(log)-keep:]
+	}
+	if err := p.writeHistoryLog(log); err != nil {
+		return nil, err
+	}
+	return p.pruneHistory(log, refs)
+}
+
+// ClearHistory deletes every snapshot and the blobs only they referenced.
+// After RegenerateIDs the snapshots still hold the old document IDs, so
+// rolling back to one would bring them back.
+func (p *Project) ClearHistory() error {
+	if p.rootDir == "" {
+		return errors.New("project root directory not set")
+	}
+	return p.withLock(func() error {
+		if err := os.RemoveAll(p.historyDir()); err != nil {
+			return fmt.Errorf("remove history: %w", err)
+		}
+		if err := p.sweepBlobs(); err != nil {
+			return fmt.Errorf("clean blob store: %w", err)
+		}
+		return nil
+	})
+}
+
+func distinct(contents map[string]string) map[string]bool {
+	out := make(map[string]bool, len(contents))
+	for _, h := range contents {
+		if h != "" {
+			out[h] = true
+		}
+	}
+	return out
+}
+
+// historyRefs returns how many retained snapshots reference each content
+// hash, from .history/refs.json. Projects whose history predates the file
+// are scanned once.
+func (p *Project) historyRefs() (map[string]int, error) {
+	b, err := vault.ReadFile(filepath.Join(p.historyDir(), "refs.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return p.scanHistoryRefs()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read history refs: %w", err)
+	}
+	refs := map[string]int{}
+	if err := json.Unmarshal(b, &refs); err != nil {
+		return nil, fmt.Errorf("parse history refs: %w", err)
+	}
+	return refs, nil
+}
+
+func (p *Project) writeHistoryRefs(refs map[string]int) error {
+	b, err := utils.PrettyJSON(refs)
+	if err != nil {
+		return err
+	}
+	return vault.WriteFile(filepath.Join(p.historyDir(), "refs.json"), b)
+}
+
+// scanHistoryRefs counts content references by reading every retained snapshot.
+func (p *Project) scanHistoryRefs() (map[string]int, error) {
+	refs := map[string]int{}
+	revs, err := os.ReadDir(filepath.Join(p.historyDir(), "revs"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return refs, nil
+		}
+		return nil, err
+	}
+	for _, e := range revs {
+		if filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		snap, err := readSnapshot(filepath.Join(p.historyDir(), "revs", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for h := range distinct(snap.Contents) {
+			refs[h]++
+		}
+	}
+	return refs, nil
+}
+
+// History returns revisions from oldest to newest.
+func (p *Project) History() ([]Revision, error) {
+	b, err := vault.ReadFile(filepath.Join(p.historyDir(), "log.json"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	var log []Revision
+	if err := json.Unmarshal(b, &log); err != nil {
+		return nil, fmt.Errorf("parse history: %w", err)
+	}
+	return log, nil
+}
+
+func (p *Project) writeHistoryLog(log []Revision) error {
+	b, err := utils.PrettyJSON(log)
+	if err != nil {
+		return err
+	}
+	return vault.WriteFile(filepath.Join(p.historyDir(), "log.json"), b)
+}
+
+// pruneHistory removes revisions no longer in the log and releases their
+// content references. It returns the hashes no snapshot references any more;
+// the blob garbage collector reclaims those the project does not use either.
+func (p *Project) pruneHistory(log []Revision, refs map[string]int) (map[string]bool, error) {
+	dir := p.historyDir()
+	live := map[string]bool{}
+	for _, r := range log {
+		live[r.Rev+".json"] = true
+	}
+	revs, err := os.ReadDir(filepath.Join(dir, "revs"))
+	if err != nil {
+		return nil, err
+	}
+	released := map[string]bool{}
+	removed := false
+	for _, e := range revs {
+		if live[e.Name()] {
+			continue
+		}
+		removed = true
+		path := filepath.Join(dir, "revs", e.Name())
+		snap, err := readSnapshot(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+		for h := range distinct(snap.Contents) {
+			if refs[h]--; refs[h] <= 0 {
+				delete(refs, h)
+				released[h] = true
+			}
+		}
+	}
+	if !removed {
+		return nil, nil
+	}
+	return released, p.writeHistoryRefs(refs)
+}
+
+func readSnapshot(path string) (*snapshot, error) {
+	b, err := vault.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw struct {
+		Project  json.RawMessage   `json:"project"`
+		Contents map[string]string `json:"contents"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parse snapshot %s: %w", filepath.Base(path), err)
+	}
+	// Snapshots may predate the current schema.
+	p, err := Decode(raw.Project)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", filepath.Base(path), err)
+	}
+	return &snapshot{Project: p, Contents: raw.Contents}, nil
+}
+
+// resolveRevision accepts a full revision, a unique prefix, or "latest".
+func (p *Project) resolveRevision(ref string) (string, error) {
+	log, err := p.History()
+	if err != nil {
+		return "", err
+	}
+	if len(log) == 0 {
+		return "", errors.New("project has no history (enable it with 'docloom project history --enable')")
+	}
+	if ref == "latest" {
+		return log[len(log)-1].Rev, nil
+	}
+	var match string
+	for _, r := range log {
+		if strings.HasPrefix(r.Rev, ref) {
+			if match != "" && match != r.Rev {
+				return "", fmt.Errorf("revision %q is ambiguous", ref)
+			}
+			match = r.Rev
+		}
+	}
+	if match == "" {
+		return "", fmt.Errorf("unknown revision %q", ref)
+	}
+	return match, nil
+}
+
+// Revision loads the project as it was at rev, with document content restored.
+func (p *Project) Revision(ref string) (*Project, error) {
+	rev, err := p.resolveRevision(ref)
+	if err != nil {
+		return nil, err
+	}
+	dir := p.historyDir()
+	snap, err := readSnapshot(filepath.Join(dir, "revs", rev+".json"))
+	if err != nil {
+		return nil, err
+	}
+	old := snap.Project
+	old.rootDir = p.rootDir
+	for id, d := range old.Documents {
+		if h, ok := snap.Contents[id]; ok {
+			d.ContentHash = h
+		}
+		if _, err := old.LoadContent(d); err != nil {
+			return nil, fmt.Errorf("revision %s: %w", rev, err)
+		}
+	}
+	return old, nil
+}
+
+// Rollback restores project metadata, instructions and documents from rev
+// and saves, which records the restored state as a new revision. History
+// settings are kept from the current project.
+func (p *Project) Rollback(ref string) error {
+	old, err := p.Revision(ref)
+	if err != nil {
+		return err
+	}
+	cfg := p.Config
+	created := p.CreatedAt
+	lock, readOnly, saved := p.lock, p.readOnly, p.savedHashes
+	*p = *old
+	p.lock, p.readOnly, p.savedHashes = lock, readOnly, saved
+	if cfg != nil {
+		p.Config.HistoryKeep = cfg.HistoryKeep
+	}
+	p.CreatedAt = created
+	return p.Save()
+}
+
+// ProjectDiff summarizes changes between two revisions.
+type ProjectDiff struct {
+	// Instructions is a line diff of the default instructions ("-", "+", " " prefixes).
+	Instructions []string
+	// InstructionSets lists named sets that were added, removed or changed.
+	InstructionSets []string
+	Added           []string
+	Removed         []string
+	Changed         []string
+}
+
+// Empty reports whether the revisions are equivalent for the compared fields.
+func (d *ProjectDiff) Empty() bool {
+	return len(d.InstructionSets) == 0 && len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 &&
+		!d.InstructionsChanged()
+}
+
+// InstructionsChanged reports whether the default instructions differ.
+func (d *ProjectDiff) InstructionsChanged() bool {
+	for _, l := range d.Instructions {
+		if !strings.HasPrefix(l, " ") {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff compares two revisions of the project.
+func (p *Project) Diff(fromRef, toRef string) (*ProjectDiff, error) {
+	a, err := p.Revision(fromRef)
+	if err != nil {
+		return nil, err
+	}
+	b, err := p.Revision(toRef)
+	if err != nil {
+		return nil, err
+	}
+	return diffProjects(a, b), nil
+}
+
+func diffProjects(a, b *Project) *ProjectDiff {
+	d := &ProjectDiff{Instructions: lineDiff(a.Instructions, b.Instructions)}
+	for _, name := range unionKeys(a.InstructionSets, b.InstructionSets) {
+		sa, oka := a.InstructionSets[name]
+		sb, okb := b.InstructionSets[name]
+		switch {
+		case !oka:
+			d.InstructionSets = append(d.InstructionSets, "+ "+name)
+		case !okb:
+			d.InstructionSets = append(d.InstructionSets, "- "+name)
+		case sa.Text != sb.Text:
+			d.InstructionSets = append(d.InstructionSets, "~ "+name)
+		}
+	}
+	for _, id := range unionKeys(a.Documents, b.Documents) {
+		da, oka := a.Documents[id]
+		db, okb := b.Documents[id]
+		switch {
+		case !oka:
+			d.Added = append(d.Added, db.Name)
+		case !okb:
+			d.Removed = append(d.Removed, da.Name)
+		case da.Content != db.Content || da.Description != db.Description:
+			d.Changed = append(d.Changed, db.Name)
+		}
+	}
+	return d
+}
+
+func unionKeys[V any](a, b map[string]V) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range []map[string]V{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lineDiff returns a minimal line diff based on the longest common subsequence.
+func lineDiff(a, b string) []string {
+	x, y := splitLines(a), splitLines(b)
+	n, m := len(x), len(y)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var out []string
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case x[i] == y[j]:
+			out = append(out, "  "+x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "- "+x[i])
+			i++
+		default:
+			out = append(out, "+ "+y[j])
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		out = append(out, "- "+x[i])
+	}
+	for ; j < m; j++ {
+		out = append(out, "+ "+y[j])
+	}
+	return out
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
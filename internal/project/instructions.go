@@ -0,0 +1,80 @@
+package project
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultInstructionSet names the instructions stored in Project.Instructions.
+const DefaultInstructionSet = "default"
+
+// InstructionSet is a named task's instructions. Template and TemplateVars
+// record how Text was rendered from the template library, if it was.
+type InstructionSet struct {
+	Text         string            `json:"text"`
+	Template     string            `json:"template,omitempty"`
+	TemplateVars map[string]string `json:"template_vars,omitempty"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+var instructionSetNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+func isDefaultSet(name string) bool {
+	return name == "" || name == DefaultInstructionSet
+}
+
+// SetInstructionSet stores instructions under name. The default set is kept in
+// the top-level Instructions fields so older tools keep reading it.
+func (p *Project) SetInstructionSet(name string, set InstructionSet) error {
+	set.Text = strings.TrimSpace(set.Text)
+	if len(set.TemplateVars) == 0 {
+		set.TemplateVars = nil
+	}
+	if isDefaultSet(name) {
+		p.Instructions = set.Text
+		p.InstructionTemplate = set.Template
+		p.TemplateVars = set.TemplateVars
+		p.UpdatedAt = time.Now()
+		return nil
+	}
+	if !instructionSetNameRe.MatchString(name) {
+		return fmt.Errorf("invalid instruction set name %q (use letters, digits, '.', '_' or '-')", name)
+	}
+	if p.InstructionSets == nil {
+		p.InstructionSets = make(map[string]*InstructionSet)
+	}
+	set.UpdatedAt = time.Now()
+	p.InstructionSets[name] = &set
+	p.UpdatedAt = set.UpdatedAt
+	return nil
+}
+
+// LookupInstructions returns the instruction set with the given name; an
+// empty name selects the default set.
+func (p *Project) LookupInstructions(name string) (*InstructionSet, error) {
+	if isDefaultSet(name) {
+		return &InstructionSet{
+			Text:         p.Instructions,
+			Template:     p.InstructionTemplate,
+			TemplateVars: p.TemplateVars,
+			UpdatedAt:    p.UpdatedAt,
+		}, nil
+	}
+	if set, ok := p.InstructionSets[name]; ok {
+		return set, nil
+	}
+	return nil, fmt.Errorf("unknown instruction set %q (available: %s)", name, strings.Join(p.InstructionSetNames(), ", "))
+}
+
+// InstructionSetNames lists instruction sets, default first, then by name.
+func (p *Project) InstructionSetNames() []string {
+	names := make([]string, 0, len(p.InstructionSets)+1)
+	for n := range p.InstructionSets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return append([]string{DefaultInstructionSet}, names...)
+}
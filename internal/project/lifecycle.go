@@ -0,0 +1,256 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Directories under the projects directory that hold non-active projects.
+// Their leading dot keeps them out of project listings and bundles.
+const (
+	TrashDirName   = ".trash"
+	ArchiveDirName = ".archive"
+)
+
+// ValidateName rejects project names that cannot be used as a directory.
+func ValidateName(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid project name %q", name)
+	}
+	return nil
+}
+
+func ensureAbsent(dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("project already exists at %s", dir)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("stat project directory: %w", err)
+	}
+	return nil
+}
+
+// Rename moves a project to a new name. Document paths inside the project
+// directory (such as dataset_summaries/) are rewritten; CreatedAt is kept.
+func Rename(projectsDir, oldName, newName string) (*Project, error) {
+	if err := ValidateName(newName); err != nil {
+		return nil, err
+	}
+	src := filepath.Join(projectsDir, oldName)
+	dst := filepath.Join(projectsDir, newName)
+	p, err := LoadProjectForUpdate(src)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Close()
+	if err := ensureAbsent(dst); err != nil {
+		return nil, err
+	}
+	releaseForMove(p)
+	if err := os.Rename(src, dst); err != nil {
+		return nil, fmt.Errorf("rename project: %w", err)
+	}
+	p.rootDir = dst
+	p.Name = newName
+	p.rebase(src)
+	if err := p.Save(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Clone deep-copies a project, including its index and dataset summaries,
+// under a new name. The copy gets fresh timestamps; document paths inside the
+// source directory are rewritten to the copy. The clone is saved.
+func Clone(projectsDir, srcName, dstName string) (*Project, error) {
+	if err := ValidateName(dstName); err != nil {
+		return nil, err
+	}
+	src := filepath.Join(projectsDir, srcName)
+	dst := filepath.Join(projectsDir, dstName)
+	// Hold the source lock so the copy sees a consistent project.
+	orig, err := LoadProjectForUpdate(src)
+	if err != nil {
+		return nil, err
+	}
+	defer orig.Close()
+	if err := ensureAbsent(dst); err != nil {
+		return nil, err
+	}
+	if err := copyDir(src, dst); err != nil {
+		_ = os.RemoveAll(dst)
+		return nil, fmt.Errorf("copy project: %w", err)
+	}
+	p, err := LoadProject(dst)
+	if err != nil {
+		return nil, err
+	}
+	p.Name = dstName
+	p.rebase(src)
+	p.CreatedAt = time.Now()
+	if err := p.Save(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// releaseForMove is called before moving a locked project's directory. The
+// lock file moves with the directory, so holding it keeps other writers out
+// until the move is done; only Windows, which cannot rename a directory
+// holding an open file, releases it first (a later Save re-locks the project
+// at its new location).
+func releaseForMove(p *Project) {
+	if runtime.GOOS == "windows" {
+		_ = p.Close()
+	}
+}
+
+// RegenerateIDs assigns new document IDs, updating relationships, and returns
+// the old-to-new mapping so callers can remap dependent files such as the
+// index. History snapshots keep the old IDs; see ClearHistory.
+func (p *Project) RegenerateIDs() map[string]string {
+	mapping := make(map[string]string, len(p.Documents))
+	docs := make(map[string]*Document, len(p.Documents))
+	for old, d := range p.Documents {
+		id := uuid.NewString()
+		mapping[old] = id
+		d.ID = id
+		docs[id] = d
+	}
+	p.Documents = docs
+	for i := range p.Relationships {
+		if id, ok := mapping[p.Relationships[i].From]; ok {
+			p.Relationships[i].From = id
+		}
+		if id, ok := mapping[p.Relationships[i].To]; ok {
+			p.Relationships[i].To = id
+		}
+	}
+	p.UpdatedAt = time.Now()
+	return mapping
+}
+
+// rebase rewrites document paths that pointed inside oldRoot to the project's
+// current directory.
+func (p *Project) rebase(oldRoot string) {
+	oldAbs, err := filepath.Abs(oldRoot)
+	if err != nil {
+		oldAbs = oldRoot
+	}
+	for _, d := range p.Documents {
+		abs, err := filepath.Abs(d.Path)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(oldAbs, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		d.Path = filepath.Join(p.rootDir, rel)
+	}
+}
+
+const trashStampLayout = "20060102T150405.000000000"
+
+// Trash moves a project into <projectsDir>/.trash/<name>-<timestamp> and
+// returns the new location.
+func Trash(projectsDir, name string) (string, error) {
+	src := filepath.Join(projectsDir, name)
+	p, err := LoadProjectForUpdate(src)
+	if err != nil {
+		return "", err
+	}
+	defer p.Close()
+	trash := filepath.Join(projectsDir, TrashDirName)
+	if err := os.MkdirAll(trash, 0o755); err != nil {
+		return "", fmt.Errorf("create trash: %w", err)
+	}
+	dst := filepath.Join(trash, name+"-"+time.Now().UTC().Format(trashStampLayout))
+	releaseForMove(p)
+	if err := os.Rename(src, dst); err != nil {
+		return "", fmt.Errorf("move project to trash: %w", err)
+	}
+	return dst, nil
+}
+
+// RestoreFromTrash moves the most recently trashed copy of name back into
+// place.
+func RestoreFromTrash(projectsDir, name string) (*Project, error) {
+	trash := filepath.Join(projectsDir, TrashDirName)
+	entries, err := os.ReadDir(trash)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("read trash: %w", err)
+	}
+	var matches []string
+	for _, e := range entries {
+		stamp, ok := strings.CutPrefix(e.Name(), name+"-")
+		if !ok || !e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(trashStampLayout, stamp); err == nil {
+			matches = append(matches, e.Name())
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no trashed project named %q", name)
+	}
+	sort.Strings(matches)
+	dst := filepath.Join(projectsDir, name)
+	if err := ensureAbsent(dst); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(filepath.Join(trash, matches[len(matches)-1]), dst); err != nil {
+		return nil, fmt.Errorf("restore project: %w", err)
+	}
+	return LoadProject(dst)
+}
+
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(path, ".tmp") || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		// Blobs are immutable, so the copy can share them.
+		if strings.HasPrefix(rel, BlobDirName+string(filepath.Separator)) && os.Link(path, target) == nil {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,90 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultTokenLimit caps a project's document tokens when no model context
+// window is known.
+const DefaultTokenLimit = 200000
+
+// DefaultWarnRatio is the share of the limit at which adds start warning.
+const DefaultWarnRatio = 0.8
+
+// ErrSizeLimit is returned when an add would take the project past its limit.
+var ErrSizeLimit = errors.New("project size limit exceeded")
+
+// SizeLimits bounds the total document tokens of a project. Callers derive
+// them from the effective model (see SetSizeLimits); projects without limits
+// use DefaultTokenLimit.
+type SizeLimits struct {
+	// Max is the hard cap on document tokens; 0 means no cap.
+	Max int
+	// Warn is the total above which adds print a warning; 0 disables it.
+	Warn int
+	// Source explains where Max comes from, e.g. a model's context window.
+	Source string
+	// Force downgrades exceeding Max to a warning.
+	Force bool
+}
+
+// DefaultSizeLimits are used until SetSizeLimits is called.
+func DefaultSizeLimits() SizeLimits {
+	return SizeLimits{
+		Max:    DefaultTokenLimit,
+		Warn:   int(DefaultTokenLimit * DefaultWarnRatio),
+		Source: "default limit",
+	}
+}
+
+// SetSizeLimits sets the limits enforced by AddDocument, AddParsed and ReplaceParsed.
+func (p *Project) SetSizeLimits(l SizeLimits) { p.limits = &l }
+
+// SizeLimits returns the limits in effect.
+func (p *Project) SizeLimits() SizeLimits {
+	if p.limits == nil {
+		return DefaultSizeLimits()
+	}
+	return *p.limits
+}
+
+// TotalTokens is the estimated token count of all documents.
+func (p *Project) TotalTokens() int {
+	n := 0
+	for _, d := range p.Documents {
+		n += d.Tokens
+	}
+	return n
+}
+
+// checkSize enforces the size limits for a change of delta tokens, warning
+// above the warning level and failing above the cap unless forced.
+func (p *Project) checkSize(delta int) error {
+	l := p.SizeLimits()
+	totalTokens := p.TotalTokens()
+	projectedTotal := totalTokens + delta
+	if l.Max > 0 && projectedTotal > l.Max {
+		if !l.Force {
+			return fmt.Errorf("%w: adding %d tokens would bring the project to %d, over its limit of %d tokens (%s). "+
+				"Use --force, mark the project retrieval-only, or raise the limit with 'docloom project limits'",
+				ErrSizeLimit, delta, projectedTotal, l.Max, l.Source)
+		}
+		fmt.Printf("⚠ WARNING: Total document content will be ~%d tokens, over the limit of %d (%s); added because of --force.\n",
+			projectedTotal, l.Max, l.Source)
+		return nil
+	}
+	if l.Warn > 0 && projectedTotal > l.Warn {
+		fmt.Printf("⚠ WARNING: Total document content will be ~%d tokens (above the warning level of %d; limit %s).\n",
+			projectedTotal, l.Warn, limitLabel(l))
+		fmt.Printf("   Consider: (1) Using --retrieval mode, (2) Reducing --max-rows for tabular files, or (3) Removing documents\n")
+	}
+	return nil
+}
+
+func limitLabel(l SizeLimits) string {
+	if l.Max <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d, %s", l.Max, l.Source)
+}
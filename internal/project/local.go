@@ -0,0 +1,51 @@
+package project
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// LocalDirName is the directory of a project kept inside a repository next to
+// the documents it describes (see 'docloom init --here'). Document paths of
+// such projects are stored relative to the directory that contains it, so the
+// project can be committed and checked out anywhere.
+const LocalDirName = ".docloom"
+
+// IsLocal reports whether the project lives in a LocalDirName directory.
+func (p *Project) IsLocal() bool {
+	return p.rootDir != "" && filepath.Base(p.rootDir) == LocalDirName
+}
+
+// BaseDir is the directory relative document paths are resolved against:
+// the parent of a local project's directory, or "" for other projects.
+func (p *Project) BaseDir() string {
+	if !p.IsLocal() {
+		return ""
+	}
+	return filepath.Dir(absPath(p.rootDir))
+}
+
+// SourcePath returns the location of the document's source file.
+func (p *Project) SourcePath(d *Document) string {
+	base := p.BaseDir()
+	if base == "" || d.Path == "" || filepath.IsAbs(d.Path) {
+		return d.Path
+	}
+	return filepath.Join(base, filepath.FromSlash(d.Path))
+}
+
+// storedPath is the form of path recorded in project.json: relative with
+// forward slashes for files under a local project's base directory, absolute
+// for other files of local projects, and unchanged otherwise.
+func (p *Project) storedPath(path string) string {
+	base := p.BaseDir()
+	if base == "" {
+		return path
+	}
+	abs := absPath(path)
+	rel, err := filepath.Rel(base, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return abs
+	}
+	return filepath.ToSlash(rel)
+}
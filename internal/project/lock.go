@@ -0,0 +1,83 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/KaramelBytes/docloom-cli/internal/utils"
+)
+
+// LockFileName is the advisory lock guarding project.json. Writers hold it
+// from load to save so concurrent commands cannot lose each other's updates.
+const LockFileName = projectFileName + ".lock"
+
+// LockTimeout bounds how long writers wait for another process to release
+// the project lock before failing with a *utils.LockedError.
+var LockTimeout = utils.DefaultLockTimeout
+
+// ErrReadOnly is returned by Save for projects opened with LoadProjectReadOnly.
+var ErrReadOnly = errors.New("project is open read-only")
+
+func lockPath(dir string) string { return filepath.Join(dir, LockFileName) }
+
+// LoadProjectForUpdate takes the project lock and then loads project.json.
+// The lock is held until Close, so a load-modify-save cycle is atomic with
+// respect to other docloom processes.
+func LoadProjectForUpdate(dir string) (*Project, error) {
+	if _, err := LoadProject(dir); err != nil {
+		return nil, err
+	}
+	l, err := utils.AcquireLock(lockPath(dir), LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	// Re-read under the lock to observe the last writer's state.
+	p, err := LoadProject(dir)
+	if err != nil {
+		_ = l.Release()
+		return nil, err
+	}
+	p.lock = l
+	return p, nil
+}
+
+// LoadProjectReadOnly loads project.json without taking the lock. Saves are
+// refused. Readers never observe partial files because writes are atomic renames.
+func LoadProjectReadOnly(dir string) (*Project, error) {
+	p, err := LoadProject(dir)
+	if err != nil {
+		return nil, err
+	}
+	p.readOnly = true
+	return p, nil
+}
+
+// Close releases the project lock if one is held. It is safe to call on any project.
+func (p *Project) Close() error {
+	if p == nil || p.lock == nil {
+		return nil
+	}
+	err := p.lock.Release()
+	p.lock = nil
+	return err
+}
+
+// withLock runs fn under the project lock, reusing it when already held.
+func (p *Project) withLock(fn func() error) error {
+	if p.readOnly {
+		return ErrReadOnly
+	}
+	if p.lock != nil {
+		return fn()
+	}
+	if err := utils.EnsureProjectDir(p.rootDir); err != nil {
+		return fmt.Errorf("ensure dir: %w", err)
+	}
+	l, err := utils.AcquireLock(lockPath(p.rootDir), LockTimeout)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	return fn()
+}
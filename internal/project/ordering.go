@@ -0,0 +1,180 @@
+package project
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Priority levels. Higher values are kept longer when a prompt limit applies.
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// ParsePriority accepts low|normal|high or an integer.
+func ParsePriority(s string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "normal":
+		return PriorityNormal, nil
+	case "low":
+		return PriorityLow, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid priority %q (use low|normal|high or an integer)", s)
+	}
+	return n, nil
+}
+
+// PriorityLabel renders a priority for display.
+func PriorityLabel(n int) string {
+	switch n {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	}
+	return strconv.Itoa(n)
+}
+
+// OrderedDocuments returns documents in prompt order: explicit Order ascending,
+// then documents without an order (older projects) by name and ID.
+func (p *Project) OrderedDocuments() []*Document {
+	docs := make([]*Document, 0, len(p.Documents))
+	for _, d := range p.Documents {
+		docs = append(docs, d)
+	}
+	key := func(d *Document) int {
+		if d.Order <= 0 {
+			return math.MaxInt
+		}
+		return d.Order
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		ki, kj := key(docs[i]), key(docs[j])
+		if ki != kj {
+			return ki < kj
+		}
+		if docs[i].Name != docs[j].Name {
+			return docs[i].Name < docs[j].Name
+		}
+		return docs[i].ID < docs[j].ID
+	})
+	return docs
+}
+
+// nextOrder returns the order value for a newly added document.
+func (p *Project) nextOrder() int {
+	max := 0
+	for _, d := range p.Documents {
+		if d.Order > max {
+			max = d.Order
+		}
+	}
+	return max + 1
+}
+
+// Reorder moves the referenced documents, in the given sequence, to the start
+// of the prompt (or to the end when atEnd is set). Other documents keep their
+// relative order. Orders are renumbered 1..N.
+func (p *Project) Reorder(refs []string, atEnd bool) error {
+	var moved []*Document
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		d, err := p.ResolveDocument(ref)
+		if err != nil {
+			return err
+		}
+		if seen[d.ID] {
+			continue
+		}
+		seen[d.ID] = true
+		moved = append(moved, d)
+	}
+	var rest []*Document
+	for _, d := range p.OrderedDocuments() {
+		if !seen[d.ID] {
+			rest = append(rest, d)
+		}
+	}
+	seq := append(append([]*Document{}, moved...), rest...)
+	if atEnd {
+		seq = append(append([]*Document{}, rest...), moved...)
+	}
+	for i, d := range seq {
+		d.Order = i + 1
+	}
+	p.UpdatedAt = time.Now()
+	return nil
+}
+
+// SetPinned marks documents as pinned (always included) or unpinned.
+func (p *Project) SetPinned(refs []string, pinned bool) error {
+	for _, ref := range refs {
+		d, err := p.ResolveDocument(ref)
+		if err != nil {
+			return err
+		}
+		d.Pinned = pinned
+	}
+	p.UpdatedAt = time.Now()
+	return nil
+}
+
+// SetPriority sets the priority of the referenced documents.
+func (p *Project) SetPriority(refs []string, priority int) error {
+	for _, ref := range refs {
+		d, err := p.ResolveDocument(ref)
+		if err != nil {
+			return err
+		}
+		d.Priority = priority
+	}
+	p.UpdatedAt = time.Now()
+	return nil
+}
+
+// SetTruncation sets the truncation strategy of the referenced documents.
+func (p *Project) SetTruncation(refs []string, strategy string) error {
+	if !ValidTruncation(strategy) {
+		return fmt.Errorf("unknown truncation strategy %q (use head|head-tail|sections)", strategy)
+	}
+	for _, ref := range refs {
+		d, err := p.ResolveDocument(ref)
+		if err != nil {
+			return err
+		}
+		d.Truncation = strategy
+	}
+	p.UpdatedAt = time.Now()
+	return nil
+}
+
+// trimOrder returns unpinned documents in the order they should be dropped when
+// a prompt limit applies: lowest priority first, then latest in prompt order.
+func trimOrder(ordered []*Document) []*Document {
+	pos := make(map[string]int, len(ordered))
+	var out []*Document
+	for i, d := range ordered {
+		pos[d.ID] = i
+		if !d.Pinned {
+			out = append(out, d)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Priority != out[j].Priority {
+			return out[i].Priority < out[j].Priority
+		}
+		return pos[out[i].ID] > pos[out[j].ID]
+	})
+	return out
+}
@@ -1,18 +1,16 @@
 package project
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
-	"sort"
-	"strings"
 	"time"
 
 	"github.com/KaramelBytes/docloom-cli/internal/parser"
 	"github.com/KaramelBytes/docloom-cli/internal/utils"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
 	"github.com/google/uuid"
 )
 
@@ -22,22 +20,48 @@ const (
 
 // Project represents a DocLoom project persisted on disk.
 type Project struct {
-	Name         string               `json:"name"`
-	Description  string               `json:"description"`
-	Instructions string               `json:"instructions"`
-	Documents    map[string]*Document `json:"documents"`
-	Config       *ProjectConfig       `json:"config"`
-	CreatedAt    time.Time            `json:"created_at"`
-	UpdatedAt    time.Time            `json:"updated_at"`
+	// SchemaVersion is the project.json format (see Schema).
+	SchemaVersion int    `json:"schema_version"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Instructions  string `json:"instructions"`
+	// InstructionTemplate and TemplateVars record how Instructions were rendered
+	// from the template library so runs can be reproduced.
+	InstructionTemplate string            `json:"instruction_template,omitempty"`
+	TemplateVars        map[string]string `json:"template_vars,omitempty"`
+	// InstructionSets holds named tasks besides the default set (see LookupInstructions).
+	InstructionSets map[string]*InstructionSet `json:"instruction_sets,omitempty"`
+	Documents       map[string]*Document       `json:"documents"`
+	// Relationships are directed edges between documents rendered in the prompt.
+	Relationships []Relationship `json:"relationships,omitempty"`
+	Config        *ProjectConfig `json:"config"`
+	// PromptTemplate is the default prompt layout for generate (see LoadLayout).
+	PromptTemplate string    `json:"prompt_template,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
 
 	// Not serialized: on-disk location of the project.json
 	rootDir string `json:"-"`
+	// lock is held between LoadProjectForUpdate and Close; readOnly refuses saves.
+	lock     *utils.FileLock
+	readOnly bool
+	// limits bound document tokens on add (see SetSizeLimits).
+	limits *SizeLimits
+	// savedHashes are the content hashes of the last load or save; blobs
+	// dropped since then are the only garbage collection candidates.
+	savedHashes map[string]bool
 }
 
 type ProjectConfig struct {
 	Model       string  `json:"model"`
 	MaxTokens   int     `json:"max_tokens"`
 	Temperature float64 `json:"temperature"`
+	// HistoryKeep enables snapshots on Save and caps how many are retained (0 disables).
+	HistoryKeep int `json:"history_keep,omitempty"`
+	// TokenLimit overrides the document token cap derived from the model (0 inherits).
+	TokenLimit int `json:"token_limit,omitempty"`
+	// RetrievalOnly projects are queried through retrieval and have no full-context cap.
+	RetrievalOnly bool `json:"retrieval_only,omitempty"`
 }
 
 // NewProject constructs an in-memory project. Call Save() to persist.
@@ -57,160 +81,297 @@ func NewProject(name, description, rootDir string) *Project {
 // LoadProject loads a project.json from the provided directory.
 func LoadProject(dir string) (*Project, error) {
 	path := filepath.Join(dir, projectFileName)
-	b, err := os.ReadFile(path)
+	b, err := vault.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return nil, fmt.Errorf("project not found at %s: %w", path, err)
 		}
 		return nil, fmt.Errorf("read project: %w", err)
 	}
-	var p Project
-	if err := json.Unmarshal(b, &p); err != nil {
-		return nil, fmt.Errorf("parse project: %w", err)
+	p, err := Decode(b)
+	if err != nil {
+		return nil, err
 	}
 	p.rootDir = dir
-	return &p, nil
+	p.savedHashes = p.contentHashes()
+	return p, nil
 }
 
 // RootDir returns the on-disk project directory path.
 func (p *Project) RootDir() string { return p.rootDir }
 
-// Save writes project.json using atomic write.
+// Save writes project.json using atomic write. Document content goes to the
+// blob store and project.json keeps only hashes; inline content from older
+// projects is migrated here. When history is enabled the saved state is also
+// recorded as a snapshot. Save takes the project lock for the write unless
+// the project was loaded with LoadProjectForUpdate.
 func (p *Project) Save() error {
 	if p.rootDir == "" {
 		return errors.New("project root directory not set")
 	}
-	if err := utils.EnsureProjectDir(p.rootDir); err != nil {
-		return fmt.Errorf("ensure dir: %w", err)
-	}
+	return p.withLock(p.save)
+}
+
+func (p *Project) save() error {
+	p.SchemaVersion = Schema.Current()
 	p.UpdatedAt = time.Now()
-	data, err := utils.PrettyJSON(p)
+	migrating := p.InlineContentCount() > 0
+	if err := p.storeContent(); err != nil {
+		return fmt.Errorf("store content: %w", err)
+	}
+	data, err := utils.PrettyJSON(p.persisted())
 	if err != nil {
 		return err
 	}
-	return utils.SafeWriteFile(filepath.Join(p.rootDir, projectFileName), data)
+	if err := vault.WriteFile(filepath.Join(p.rootDir, projectFileName), data); err != nil {
+		return err
+	}
+	candidates := p.savedHashes
+	if p.HistoryEnabled() {
+		released, err := p.recordSnapshot()
+		if err != nil {
+			return fmt.Errorf("record history: %w", err)
+		}
+		candidates = union(candidates, released)
+	}
+	// Migrated inline content can leave blobs nothing tracks; sweep them all.
+	if migrating {
+		err = p.sweepBlobs()
+	} else {
+		err = p.gcBlobs(candidates)
+	}
+	if err != nil {
+		return fmt.Errorf("clean blob store: %w", err)
+	}
+	p.savedHashes = p.contentHashes()
+	return nil
 }
 
 // AddDocument reads a file and adds it to the project metadata and cache.
 func (p *Project) AddDocument(path, description string) error {
-	// Normalize path for comparison
-	absPath, err := filepath.Abs(path)
+	if err := p.checkDuplicate(path); err != nil {
+		return err
+	}
+	parsed, err := parser.ParseFile(path)
 	if err != nil {
-		absPath = path
+		return fmt.Errorf("parse document: %w", err)
+	}
+	_, err = p.AddParsed(path, description, parsed)
+	return err
+}
+
+// AddParsed registers a document whose content was already parsed from path.
+// It applies the same duplicate and size checks as AddDocument, which lets
+// callers parse many files concurrently and register them sequentially.
+func (p *Project) AddParsed(path, description, parsed string) (*Document, error) {
+	if err := p.checkDuplicate(path); err != nil {
+		return nil, err
 	}
 
-	// Check for duplicate paths
-	for id, existing := range p.Documents {
-		existingAbs, _ := filepath.Abs(existing.Path)
-		if existingAbs == absPath {
-			return fmt.Errorf("document already exists in project: %s\n  ID: %s\n  Description: %s\n  Use 'docloom list --docs -p <project>' to view all documents",
-									existing.Name, id, existing.Description)
-						}
-					}
-				
-					// Calculate current total tokens
-					totalTokens := 0
-					for _, doc := range p.Documents {
-						totalTokens += doc.Tokens
-					}
-				
-					// Parse new document
-					parsed, err := parser.ParseFile(path)
-					if err != nil {
-						return fmt.Errorf("parse document: %w", err)
-					}
-				
-					newTokens := parser.EstimateTokens(parsed)
-					projectedTotal := totalTokens + newTokens
-				
-					// Enforce hard limit for projects targeting local LLMs
-					const maxRecommendedTokens = 100000
-					const maxCriticalTokens = 200000
-				
-					if projectedTotal > maxCriticalTokens {
-						return fmt.Errorf("cannot add document: would exceed maximum project size (%d tokens). Current: %d, New: %d. Consider using --retrieval mode or creating separate projects",
-							maxCriticalTokens, totalTokens, newTokens)
-					}
-				
-					if projectedTotal > maxRecommendedTokens {
-						fmt.Printf("⚠ WARNING: Total document content will be ~%d tokens (exceeds recommended %d).\n",
-							projectedTotal, maxRecommendedTokens)
-						fmt.Printf("   Consider: (1) Using --retrieval mode, (2) Reducing --max-rows for tabular files, or (3) Removing documents\n")
-					}
-				
-					info, err := os.Stat(path)
-					if err != nil {
-						return fmt.Errorf("stat document: %w", err)
-					}
-					name := filepath.Base(path)
-					id := uuid.NewString()
+	newTokens := parser.EstimateTokens(parsed)
+	if err := p.checkSize(newTokens); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("stat document: %w", err)
+	}
+	prov, err := newProvenance(path, parser.Name(path), parser.Options{})
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(path)
+	id := uuid.NewString()
 	d := &Document{
 		ID:          id,
-		Path:        path,
+		Path:        p.storedPath(path),
 		Name:        name,
 		Description: description,
 		Content:     parsed,
-		Tokens:      parser.EstimateTokens(parsed),
+		Tokens:      newTokens,
 		AddedAt:     info.ModTime(),
+		Order:       p.nextOrder(),
+		Provenance:  prov,
 	}
+	if h, ok := SimHash(parsed); ok {
+		d.Fingerprint = formatFingerprint(h)
+	}
+	p.Screen(d)
 	if p.Documents == nil {
 		p.Documents = make(map[string]*Document)
 	}
 	p.Documents[id] = d
 	p.UpdatedAt = time.Now()
+	return d, nil
+}
+
+// ErrDuplicateDocument is returned when a path is already registered in the project.
+var ErrDuplicateDocument = errors.New("document already exists in project")
+
+// checkDuplicate returns ErrDuplicateDocument (wrapped with details) if path is already registered.
+func (p *Project) checkDuplicate(path string) error {
+	// Normalize path for comparison
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	for id, existing := range p.Documents {
+		existingAbs, _ := filepath.Abs(p.SourcePath(existing))
+		if existingAbs == absPath {
+			return fmt.Errorf("%w: %s\n  ID: %s\n  Description: %s\n  Use 'docloom list --docs -p <project>' to view all documents",
+				ErrDuplicateDocument, existing.Name, id, existing.Description)
+		}
+	}
 	return nil
 }
 
+// SetInstructions replaces the default instruction set with literal text.
 func (p *Project) SetInstructions(instructions string) {
-	p.Instructions = strings.TrimSpace(instructions)
-	p.UpdatedAt = time.Now()
+	_ = p.SetInstructionSet(DefaultInstructionSet, InstructionSet{Text: instructions})
+}
+
+// SetTemplateInstructions sets the default instructions rendered from a
+// library template and records the template name and variables used.
+func (p *Project) SetTemplateInstructions(rendered, template string, vars map[string]string) {
+	_ = p.SetInstructionSet(DefaultInstructionSet, InstructionSet{Text: rendered, Template: template, TemplateVars: vars})
+}
+
+// PromptOptions tunes prompt assembly.
+type PromptOptions struct {
+	// TokenLimit, when > 0, fits the prompt into this many tokens by giving each
+	// document a share of the budget left after instructions and the task.
+	TokenLimit int
+	// Allocation selects how document shares are weighted: "size" (default) or "priority".
+	Allocation string
+	// Layout names the prompt template (built-in, project-local, or a file path).
+	// Empty uses the project's PromptTemplate, then the built-in default.
+	Layout string
+	// Retrieved chunks are rendered in the layout's retrieved-context section.
+	Retrieved []RetrievedChunk
+	// Task names the instruction set to render; empty uses the default set.
+	Task string
+	// Selection limits which documents are rendered; empty keeps all.
+	Selection Selection
+	// FenceUntrusted wraps document content and retrieved chunks in delimited
+	// untrusted blocks and tells the model not to follow instructions inside them.
+	FenceUntrusted bool
+}
+
+// TruncatedDocument records how much of a document was cut to fit a limit.
+type TruncatedDocument struct {
+	Document *Document
+	Removed  int
+}
+
+// PromptResult is the outcome of BuildPromptWithOptions.
+type PromptResult struct {
+	Text   string
+	Tokens int
+	// Dropped lists documents left out to honour TokenLimit.
+	Dropped []*Document
+	// Truncated lists documents shortened to honour TokenLimit.
+	Truncated []TruncatedDocument
 }
 
 // BuildPrompt assembles the final prompt text and returns the text with total token estimate.
 func (p *Project) BuildPrompt() (string, int, error) {
+	res, err := p.BuildPromptWithOptions(PromptOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+	return res.Text, res.Tokens, nil
+}
+
+// BuildPromptWithOptions assembles the prompt with documents in their explicit
+// order. When a token limit applies, instructions and the task section are
+// always kept and the remaining budget is split across documents, each cut
+// with its own truncation strategy. Pinned documents are never dropped.
+func (p *Project) BuildPromptWithOptions(opts PromptOptions) (*PromptResult, error) {
 	if p == nil {
-		return "", 0, errors.New("project is nil")
+		return nil, errors.New("project is nil")
 	}
 	if len(p.Documents) == 0 {
-		return "", 0, errors.New("no documents added to project")
-	}
-
-	var sb strings.Builder
-	// Header and instructions
-	sb.WriteString("[INSTRUCTIONS]\n")
-	sb.WriteString(p.Instructions)
-	sb.WriteString("\n\n")
-	// Relationships placeholder (future)
-	sb.WriteString("[DOCUMENT RELATIONSHIPS]\n")
-	sb.WriteString("(none)\n\n")
-	// Reference documents
-	sb.WriteString("[REFERENCE DOCUMENTS]\n")
-
-	// deterministic order for stable prompts
-	ids := make([]string, 0, len(p.Documents))
-	for id := range p.Documents {
-		ids = append(ids, id)
-	}
-	sort.Strings(ids)
-	for _, id := range ids {
-		d := p.Documents[id]
-		sb.WriteString("--- Document: ")
-		sb.WriteString(d.Name)
-		if d.Description != "" {
-			sb.WriteString(" (")
-			sb.WriteString(d.Description)
-			sb.WriteString(")")
+		return nil, errors.New("no documents added to project")
+	}
+
+	instructions, err := p.LookupInstructions(opts.Task)
+	if err != nil {
+		return nil, err
+	}
+	ordered, err := p.SelectDocuments(opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range ordered {
+		if _, err := p.LoadContent(d); err != nil {
+			return nil, err
 		}
-		sb.WriteString(" ---\n")
-		sb.WriteString(d.Content)
-		sb.WriteString("\n\n")
+	}
+	layout := opts.Layout
+	if layout == "" {
+		layout = p.PromptTemplate
+	}
+	tmpl, err := p.LoadLayout(layout)
+	if err != nil {
+		return nil, err
+	}
+	render := func(ordered []*Document, contents map[string]string) (string, error) {
+		return renderLayout(tmpl, p.layoutData(instructions.Text, ordered, contents, opts.Retrieved, opts.FenceUntrusted))
 	}
 
-	// Task reiteration
-	sb.WriteString("[TASK]\n")
-	sb.WriteString("Follow the instructions above using the reference documents.\n")
+	prompt, err := render(ordered, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := &PromptResult{Text: prompt, Tokens: utils.CountTokens(prompt)}
+	limit := opts.TokenLimit
+	if opts.TokenLimit <= 0 || res.Tokens <= limit {
+		return res, nil
+	}
 
-	prompt := sb.String()
-	tokens := utils.CountTokens(prompt)
-	return prompt, tokens, nil
+	empty := make(map[string]string, len(ordered))
+	demand := make(map[string]int, len(ordered))
+	for _, d := range ordered {
+		empty[d.ID] = ""
+		demand[d.ID] = utils.CountTokens(d.Content)
+	}
+	skeleton, err := render(ordered, empty)
+	if err != nil {
+		return nil, err
+	}
+	budget := limit - utils.CountTokens(skeleton)
+	// Token estimates are not perfectly additive; shave any overshoot and retry.
+	for attempt := 0; attempt < 3; attempt++ {
+		alloc, dropped := allocateBudget(ordered, demand, budget, opts.Allocation)
+		skip := make(map[string]bool, len(dropped))
+		for _, d := range dropped {
+			skip[d.ID] = true
+		}
+		contents := make(map[string]string, len(ordered))
+		var truncated []TruncatedDocument
+		for _, d := range ordered {
+			if skip[d.ID] {
+				continue
+			}
+			text, removed := truncateContent(d.Content, alloc[d.ID], d.Truncation)
+			contents[d.ID] = text
+			if removed > 0 {
+				truncated = append(truncated, TruncatedDocument{Document: d, Removed: removed})
+			}
+		}
+		prompt, err = render(ordered, contents)
+		if err != nil {
+			return nil, err
+		}
+		res.Text = prompt
+		res.Tokens = utils.CountTokens(prompt)
+		res.Dropped = dropped
+		res.Truncated = truncated
+		if res.Tokens <= limit {
+			break
+		}
+		budget -= res.Tokens - limit
+	}
+	return res, nil
 }
@@ -0,0 +1,207 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/KaramelBytes/docloom-cli/internal/parser"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
+)
+
+// Provenance records how a document's content was produced, so it can be
+// re-parsed the same way and checked against its source later.
+type Provenance struct {
+	// Source is the parsed file when it is not the document's own file, such
+	// as the dataset behind an analysis summary. Stored like Document.Path.
+	Source        string          `json:"source,omitempty"`
+	Parser        string          `json:"parser"`
+	ParserVersion string          `json:"parser_version"`
+	Options       *parser.Options `json:"options,omitempty"`
+	SHA256        string          `json:"sha256"`
+	Size          int64           `json:"size"`
+	ModTime       time.Time       `json:"mtime"`
+}
+
+// newProvenance fingerprints the file at path parsed by parserName with opts.
+func newProvenance(path, parserName string, opts parser.Options) (*Provenance, error) {
+	sum, size, mod, err := fileDigest(path)
+	if err != nil {
+		return nil, err
+	}
+	prov := &Provenance{
+		Parser:        parserName,
+		ParserVersion: parser.Version,
+		SHA256:        sum,
+		Size:          size,
+		ModTime:       mod,
+	}
+	if !opts.IsZero() {
+		o := opts
+		prov.Options = &o
+	}
+	return prov, nil
+}
+
+func fileDigest(path string) (sum string, size int64, mod time.Time, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, time.Time{}, fmt.Errorf("open source: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", 0, time.Time{}, fmt.Errorf("stat source: %w", err)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", 0, time.Time{}, fmt.Errorf("hash source: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), info.Size(), info.ModTime(), nil
+}
+
+// OriginPath is the file a document's content is parsed from: its
+// provenance source when recorded, otherwise the document's own file.
+func (p *Project) OriginPath(d *Document) string {
+	if d.Provenance != nil && d.Provenance.Source != "" {
+		return p.SourcePath(&Document{Path: d.Provenance.Source})
+	}
+	return p.SourcePath(d)
+}
+
+// OriginModTime is the modification time of the origin file when the
+// document was last parsed. Documents without provenance fall back to AddedAt.
+func (d *Document) OriginModTime() time.Time {
+	if d.Provenance != nil {
+		return d.Provenance.ModTime
+	}
+	return d.AddedAt
+}
+
+// parseOptions returns the recorded parser options.
+func (d *Document) parseOptions() parser.Options {
+	if d.Provenance == nil || d.Provenance.Options == nil {
+		return parser.Options{}
+	}
+	return *d.Provenance.Options
+}
+
+// Reparse parses the document's origin again with the recorded parser and
+// options. It does not modify the document.
+func (p *Project) Reparse(d *Document) (string, error) {
+	src := p.OriginPath(d)
+	if d.Provenance != nil && d.Provenance.Parser == parser.AnalyzeName {
+		return parser.AnalyzeFile(src, d.parseOptions())
+	}
+	return parser.ParseFileWithOptions(src, d.parseOptions())
+}
+
+// AddDerived adds the file at path, generated from source with opts by the
+// dataset analyzer, and records source as its provenance so a refresh
+// regenerates it from the dataset.
+func (p *Project) AddDerived(path, description, source string, opts parser.Options) (*Document, error) {
+	parsed, err := parser.ParseFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("parse document: %w", err)
+	}
+	d, err := p.AddParsed(path, description, parsed)
+	if err != nil {
+		return nil, err
+	}
+	prov, err := newProvenance(source, parser.AnalyzeName, opts)
+	if err != nil {
+		return nil, err
+	}
+	prov.Source = p.storedPath(source)
+	d.Provenance = prov
+	return d, nil
+}
+
+// Refresh re-parses the document's origin with its recorded parser options
+// and updates content, tokens and provenance in place. Documents derived by
+// the dataset analyzer also have their summary file rewritten.
+func (p *Project) Refresh(d *Document) error {
+	parsed, err := p.Reparse(d)
+	if err != nil {
+		return fmt.Errorf("parse document: %w", err)
+	}
+	newTokens := parser.EstimateTokens(parsed)
+	if err := p.checkSize(newTokens - d.Tokens); err != nil {
+		return err
+	}
+	src := p.OriginPath(d)
+	name := parser.Name(src)
+	derived := d.Provenance != nil && d.Provenance.Source != ""
+	if derived {
+		name = d.Provenance.Parser
+		if err := vault.WriteFile(p.SourcePath(d), []byte(parsed)); err != nil {
+			return fmt.Errorf("write %s: %w", d.Name, err)
+		}
+	}
+	prov, err := newProvenance(src, name, d.parseOptions())
+	if err != nil {
+		return err
+	}
+	if derived {
+		prov.Source = d.Provenance.Source
+	}
+	info, err := os.Stat(p.SourcePath(d))
+	if err != nil {
+		return fmt.Errorf("stat document: %w", err)
+	}
+	d.setContent(parsed, newTokens)
+	d.AddedAt = info.ModTime()
+	d.Provenance = prov
+	p.Screen(d)
+	p.UpdatedAt = time.Now()
+	return nil
+}
+
+// DriftStatus compares a document's origin file with its provenance.
+type DriftStatus string
+
+const (
+	// DriftNone means the source content is unchanged.
+	DriftNone DriftStatus = "unchanged"
+	// DriftTouched means the modification time changed but not the content.
+	DriftTouched DriftStatus = "touched"
+	// DriftModified means the source content changed since it was parsed.
+	DriftModified DriftStatus = "modified"
+	// DriftMissing means the source file cannot be read.
+	DriftMissing DriftStatus = "missing"
+	// DriftUnknown means no provenance was recorded to compare with.
+	DriftUnknown DriftStatus = "unknown"
+)
+
+// Drift is the result of CheckDrift.
+type Drift struct {
+	Status  DriftStatus
+	SHA256  string
+	Size    int64
+	ModTime time.Time
+	Err     error
+}
+
+// CheckDrift hashes the document's origin and compares it with the
+// recorded provenance.
+func (p *Project) CheckDrift(d *Document) Drift {
+	sum, size, mod, err := fileDigest(p.OriginPath(d))
+	if err != nil {
+		return Drift{Status: DriftMissing, Err: err}
+	}
+	dr := Drift{SHA256: sum, Size: size, ModTime: mod}
+	switch {
+	case d.Provenance == nil || d.Provenance.SHA256 == "":
+		dr.Status = DriftUnknown
+	case sum != d.Provenance.SHA256:
+		dr.Status = DriftModified
+	case !mod.Equal(d.Provenance.ModTime):
+		dr.Status = DriftTouched
+	default:
+		dr.Status = DriftNone
+	}
+	return dr
+}
@@ -0,0 +1,154 @@
+package project
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Supported relationship kinds between documents.
+const (
+	RelSupersedes  = "supersedes"
+	RelImplements  = "implements"
+	RelReferences  = "references"
+	RelContradicts = "contradicts"
+	RelDataFor     = "data-for"
+)
+
+// Relations lists the relationship kinds accepted by AddRelationship.
+var Relations = []string{RelSupersedes, RelImplements, RelReferences, RelContradicts, RelDataFor}
+
+// Relationship is a directed edge between two documents, e.g. "spec-v2 supersedes spec-v1".
+type Relationship struct {
+	From      string    `json:"from"`
+	Relation  string    `json:"relation"`
+	To        string    `json:"to"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ValidRelation reports whether rel is a known relationship kind.
+func ValidRelation(rel string) bool {
+	for _, r := range Relations {
+		if r == rel {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveDocument finds a document by exact ID, unique ID prefix, or unique
+// name; documents of a merged workspace also match "<project>/<name>".
+func (p *Project) ResolveDocument(ref string) (*Document, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil, fmt.Errorf("document reference is empty")
+	}
+	if d, ok := p.Documents[ref]; ok {
+		return d, nil
+	}
+	var matches []*Document
+	for _, d := range p.Documents {
+		if d.Name == ref || strings.HasPrefix(d.ID, ref) || (d.Project != "" && qualifiedName(d) == ref) {
+			matches = append(matches, d)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("document not found: %s", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("document reference %q is ambiguous (%d matches); use the document ID", ref, len(matches))
+	}
+}
+
+// AddRelationship records "from rel to". Duplicate edges are ignored.
+func (p *Project) AddRelationship(fromRef, rel, toRef string) (Relationship, error) {
+	rel = strings.ToLower(strings.TrimSpace(rel))
+	if !ValidRelation(rel) {
+		return Relationship{}, fmt.Errorf("unknown relation %q (use %s)", rel, strings.Join(Relations, "|"))
+	}
+	from, err := p.ResolveDocument(fromRef)
+	if err != nil {
+		return Relationship{}, err
+	}
+	to, err := p.ResolveDocument(toRef)
+	if err != nil {
+		return Relationship{}, err
+	}
+	if from.ID == to.ID {
+		return Relationship{}, fmt.Errorf("a document cannot relate to itself")
+	}
+	for _, r := range p.Relationships {
+		if r.From == from.ID && r.Relation == rel && r.To == to.ID {
+			return r, nil
+		}
+	}
+	r := Relationship{From: from.ID, Relation: rel, To: to.ID, CreatedAt: time.Now()}
+	p.Relationships = append(p.Relationships, r)
+	p.UpdatedAt = time.Now()
+	return r, nil
+}
+
+// RemoveRelationship deletes the matching edge and reports whether one was removed.
+func (p *Project) RemoveRelationship(fromRef, rel, toRef string) (bool, error) {
+	from, err := p.ResolveDocument(fromRef)
+	if err != nil {
+		return false, err
+	}
+	to, err := p.ResolveDocument(toRef)
+	if err != nil {
+		return false, err
+	}
+	rel = strings.ToLower(strings.TrimSpace(rel))
+	kept := p.Relationships[:0]
+	removed := false
+	for _, r := range p.Relationships {
+		if r.From == from.ID && r.Relation == rel && r.To == to.ID {
+			removed = true
+			continue
+		}
+		kept = append(kept, r)
+	}
+	p.Relationships = kept
+	if removed {
+		p.UpdatedAt = time.Now()
+	}
+	return removed, nil
+}
+
+// RemoveDocument deletes a document and any relationships that reference it.
+func (p *Project) RemoveDocument(ref string) (*Document, error) {
+	d, err := p.ResolveDocument(ref)
+	if err != nil {
+		return nil, err
+	}
+	delete(p.Documents, d.ID)
+	kept := p.Relationships[:0]
+	for _, r := range p.Relationships {
+		if r.From == d.ID || r.To == d.ID {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	p.Relationships = kept
+	p.UpdatedAt = time.Now()
+	return d, nil
+}
+
+// RelationshipLines renders relationships as "name relation name" lines in a
+// stable order. Edges pointing at unknown documents are skipped.
+func (p *Project) RelationshipLines() []string {
+	lines := make([]string, 0, len(p.Relationships))
+	for _, r := range p.Relationships {
+		from, ok1 := p.Documents[r.From]
+		to, ok2 := p.Documents[r.To]
+		if !ok1 || !ok2 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s", from.Name, r.Relation, to.Name))
+	}
+	sort.Strings(lines)
+	return lines
+}
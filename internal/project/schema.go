@@ -0,0 +1,50 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/KaramelBytes/docloom-cli/internal/schema"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
+)
+
+// Schema holds the project.json migrations. Append new migrations here when
+// the format changes; LoadProject upgrades older files and Save writes the
+// current version.
+var Schema = schema.NewRegistry(projectFileName,
+	schema.Migration{
+		From:        1,
+		Description: "ensure config and documents are objects",
+		Apply: func(doc map[string]any) error {
+			if _, err := schema.Object(doc, "config"); err != nil {
+				return err
+			}
+			_, err := schema.Object(doc, "documents")
+			return err
+		},
+	},
+)
+
+// Decode parses project.json data, upgrading older schema versions. Files
+// from a newer docloom are refused with a schema.NewerVersionError.
+func Decode(data []byte) (*Project, error) {
+	data, _, err := Schema.Migrate(data)
+	if err != nil {
+		return nil, err
+	}
+	var p Project
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse project: %w", err)
+	}
+	return &p, nil
+}
+
+// CheckSchema reports the migrations pending for the project.json in dir.
+func CheckSchema(dir string) (schema.Status, error) {
+	b, err := vault.ReadFile(filepath.Join(dir, projectFileName))
+	if err != nil {
+		return schema.Status{}, fmt.Errorf("read project: %w", err)
+	}
+	return Schema.Check(b)
+}
@@ -0,0 +1,46 @@
+package project
+
+import (
+	"github.com/KaramelBytes/docloom-cli/internal/injection"
+	"github.com/KaramelBytes/docloom-cli/internal/parser"
+)
+
+// Screen scans the document's content for prompt-injection patterns and
+// records the findings on it. Text hidden in a DOCX source is included when
+// the source is readable.
+func (p *Project) Screen(d *Document) {
+	findings := injection.Scan(d.Content)
+	// The source was just parsed, so a read failure here only means the
+	// hidden-text check is skipped.
+	if hidden, err := parser.HiddenText(p.SourcePath(d)); err == nil {
+		findings = append(findings, injection.ScanHidden(hidden)...)
+	}
+	d.Screening = injection.Limit(findings)
+}
+
+// ScreenSelected rescans the content of the selected documents, keeping any
+// hidden-text findings recorded when they were added, and returns those with
+// findings in prompt order. Findings are updated in memory only.
+func (p *Project) ScreenSelected(sel Selection) ([]*Document, error) {
+	docs, err := p.SelectDocuments(sel)
+	if err != nil {
+		return nil, err
+	}
+	var flagged []*Document
+	for _, d := range docs {
+		if _, err := p.LoadContent(d); err != nil {
+			return nil, err
+		}
+		findings := injection.Scan(d.Content)
+		for _, f := range d.Screening {
+			if f.Kind == injection.KindHiddenText {
+				findings = append(findings, f)
+			}
+		}
+		d.Screening = injection.Limit(findings)
+		if len(d.Screening) > 0 {
+			flagged = append(flagged, d)
+		}
+	}
+	return flagged, nil
+}
@@ -0,0 +1,251 @@
+package project
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/KaramelBytes/docloom-cli/internal/parser"
+)
+
+// DefaultSimilarityThreshold is the SimHash similarity above which two
+// documents are reported as near-duplicates.
+const DefaultSimilarityThreshold = 0.9
+
+// shingleSize is the number of words hashed together by SimHash.
+const shingleSize = 3
+
+// SimHash returns a 64-bit SimHash of text over lower-cased word shingles.
+// ok is false when text has no words, since such fingerprints say nothing.
+func SimHash(text string) (hash uint64, ok bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return 0, false
+	}
+	var weights [64]int
+	add := func(shingle string) {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(shingle))
+		x := h.Sum64()
+		for i := range weights {
+			if x&(1<<uint(i)) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+	if len(words) < shingleSize {
+		add(strings.Join(words, " "))
+	}
+	for i := 0; i+shingleSize <= len(words); i++ {
+		add(strings.Join(words[i:i+shingleSize], " "))
+	}
+	for i, w := range weights {
+		if w > 0 {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash, true
+}
+
+// Similarity is the share of equal bits between two SimHash fingerprints (0..1).
+func Similarity(a, b uint64) float64 {
+	return 1 - float64(bits.OnesCount64(a^b))/64
+}
+
+// fingerprint returns the document's SimHash, computing and caching it for
+// documents added before fingerprints were recorded.
+func (p *Project) fingerprint(d *Document) (uint64, bool, error) {
+	if d.Fingerprint != "" {
+		h, err := strconv.ParseUint(d.Fingerprint, 16, 64)
+		if err == nil {
+			return h, true, nil
+		}
+	}
+	text, err := p.LoadContent(d)
+	if err != nil {
+		return 0, false, err
+	}
+	h, ok := SimHash(text)
+	if ok {
+		d.Fingerprint = formatFingerprint(h)
+	}
+	return h, ok, nil
+}
+
+func formatFingerprint(h uint64) string { return fmt.Sprintf("%016x", h) }
+
+// NearDuplicate is a document similar to some content, with its similarity.
+type NearDuplicate struct {
+	Document   *Document
+	Similarity float64
+}
+
+// MostSimilar returns the document most similar to content when its
+// similarity reaches threshold. ok is false when nothing is that close.
+func (p *Project) MostSimilar(content string, threshold float64) (NearDuplicate, bool, error) {
+	h, ok := SimHash(content)
+	if !ok {
+		return NearDuplicate{}, false, nil
+	}
+	var best NearDuplicate
+	for _, d := range p.OrderedDocuments() {
+		dh, ok, err := p.fingerprint(d)
+		if err != nil {
+			return NearDuplicate{}, false, err
+		}
+		if !ok {
+			continue
+		}
+		if s := Similarity(h, dh); s >= threshold && s > best.Similarity {
+			best = NearDuplicate{Document: d, Similarity: s}
+		}
+	}
+	return best, best.Document != nil, nil
+}
+
+// DuplicateCluster groups documents that are transitively near-duplicates.
+// Members are sorted by tokens, largest first; Similarity holds each
+// member's similarity to the first one.
+type DuplicateCluster struct {
+	Documents  []*Document
+	Similarity []float64
+}
+
+// Tokens is the combined token cost of the cluster.
+func (c DuplicateCluster) Tokens() int {
+	n := 0
+	for _, d := range c.Documents {
+		n += d.Tokens
+	}
+	return n
+}
+
+// Reclaimable is the token cost saved by keeping only the largest member.
+func (c DuplicateCluster) Reclaimable() int {
+	if len(c.Documents) == 0 {
+		return 0
+	}
+	return c.Tokens() - c.Documents[0].Tokens
+}
+
+// DuplicateClusters groups documents whose pairwise similarity reaches
+// threshold. Clusters are ordered by reclaimable tokens, largest first.
+func (p *Project) DuplicateClusters(threshold float64) ([]DuplicateCluster, error) {
+	docs := p.OrderedDocuments()
+	hashes := make([]uint64, len(docs))
+	valid := make([]bool, len(docs))
+	for i, d := range docs {
+		h, ok, err := p.fingerprint(d)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i], valid[i] = h, ok
+	}
+	parent := make([]int, len(docs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range docs {
+		for j := i + 1; j < len(docs); j++ {
+			if valid[i] && valid[j] && Similarity(hashes[i], hashes[j]) >= threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+	groups := map[int][]int{}
+	for i := range docs {
+		root := find(i)
+		groups[root] = append(groups[root], i)
+	}
+	var clusters []DuplicateCluster
+	for _, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		sort.SliceStable(members, func(a, b int) bool { return docs[members[a]].Tokens > docs[members[b]].Tokens })
+		c := DuplicateCluster{}
+		for _, m := range members {
+			c.Documents = append(c.Documents, docs[m])
+			c.Similarity = append(c.Similarity, Similarity(hashes[members[0]], hashes[m]))
+		}
+		clusters = append(clusters, c)
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if a, b := clusters[i].Reclaimable(), clusters[j].Reclaimable(); a != b {
+			return a > b
+		}
+		return clusters[i].Documents[0].Name < clusters[j].Documents[0].Name
+	})
+	return clusters, nil
+}
+
+// ReplaceParsed swaps the content of an existing document for a newly parsed
+// file while keeping its ID, position, tags, priority and relationships, so
+// a new revision takes the old one's place. An empty description keeps the
+// old one.
+func (p *Project) ReplaceParsed(old *Document, path, description, parsed string) (*Document, error) {
+	for _, d := range p.Documents {
+		if d.ID != old.ID && absPath(p.SourcePath(d)) == absPath(path) {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateDocument, d.Name)
+		}
+	}
+	newTokens := parser.EstimateTokens(parsed)
+	if err := p.checkSize(newTokens - old.Tokens); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("stat document: %w", err)
+	}
+	prov, err := newProvenance(path, parser.Name(path), parser.Options{})
+	if err != nil {
+		return nil, err
+	}
+	old.Path = p.storedPath(path)
+	old.Name = filepath.Base(path)
+	if description != "" {
+		old.Description = description
+	}
+	old.setContent(parsed, newTokens)
+	old.AddedAt = info.ModTime()
+	old.Provenance = prov
+	p.Screen(old)
+	p.UpdatedAt = time.Now()
+	return old, nil
+}
+
+// setContent replaces the document's content and the values derived from it.
+func (d *Document) setContent(parsed string, tokens int) {
+	d.Content = parsed
+	d.ContentHash = ""
+	d.Tokens = tokens
+	d.Fingerprint = ""
+	if h, ok := SimHash(parsed); ok {
+		d.Fingerprint = formatFingerprint(h)
+	}
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,165 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NormalizeTag lowercases and validates a tag. Tags may contain letters,
+// digits and - _ . : / so they stay easy to pass as comma-separated flags.
+func NormalizeTag(tag string) (string, error) {
+	t := strings.ToLower(strings.TrimSpace(tag))
+	if t == "" {
+		return "", errors.New("tag is empty")
+	}
+	for _, r := range t {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', strings.ContainsRune("-_.:/", r):
+		default:
+			return "", fmt.Errorf("invalid tag %q (use letters, digits, - _ . : /)", tag)
+		}
+	}
+	return t, nil
+}
+
+// HasTag reports whether the document carries tag (already normalized).
+func (d *Document) HasTag(tag string) bool {
+	for _, t := range d.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTags normalizes and adds tags, keeping the list sorted. It returns the
+// tags that were newly added.
+func (d *Document) AddTags(tags ...string) ([]string, error) {
+	var added []string
+	for _, raw := range tags {
+		t, err := NormalizeTag(raw)
+		if err != nil {
+			return nil, err
+		}
+		if !d.HasTag(t) {
+			d.Tags = append(d.Tags, t)
+			added = append(added, t)
+		}
+	}
+	sort.Strings(d.Tags)
+	return added, nil
+}
+
+// RemoveTags removes tags and returns the ones that were present.
+func (d *Document) RemoveTags(tags ...string) []string {
+	drop := map[string]bool{}
+	for _, raw := range tags {
+		if t, err := NormalizeTag(raw); err == nil {
+			drop[t] = true
+		}
+	}
+	var removed []string
+	kept := d.Tags[:0]
+	for _, t := range d.Tags {
+		if drop[t] {
+			removed = append(removed, t)
+			continue
+		}
+		kept = append(kept, t)
+	}
+	d.Tags = kept
+	if len(d.Tags) == 0 {
+		d.Tags = nil
+	}
+	return removed
+}
+
+// Selection narrows the documents used for a prompt or for retrieval. Docs
+// (IDs, ID prefixes or names) and Tags each add matching documents; when
+// both are empty every document is a candidate. ExcludeTags then removes
+// documents carrying any of the listed tags.
+type Selection struct {
+	Docs        []string
+	Tags        []string
+	ExcludeTags []string
+}
+
+// Empty reports whether the selection keeps every document.
+func (s Selection) Empty() bool {
+	return len(s.Docs) == 0 && len(s.Tags) == 0 && len(s.ExcludeTags) == 0
+}
+
+// SelectDocuments returns the selected documents in prompt order. Unknown
+// document references are errors, as is a selection that matches nothing.
+func (p *Project) SelectDocuments(sel Selection) ([]*Document, error) {
+	ordered := p.OrderedDocuments()
+	if sel.Empty() {
+		return ordered, nil
+	}
+	normalize := func(tags []string) (map[string]bool, error) {
+		set := map[string]bool{}
+		for _, raw := range tags {
+			t, err := NormalizeTag(raw)
+			if err != nil {
+				return nil, err
+			}
+			set[t] = true
+		}
+		return set, nil
+	}
+	include, err := normalize(sel.Tags)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := normalize(sel.ExcludeTags)
+	if err != nil {
+		return nil, err
+	}
+	named := map[string]bool{}
+	for _, ref := range sel.Docs {
+		d, err := p.ResolveDocument(ref)
+		if err != nil {
+			return nil, err
+		}
+		named[d.ID] = true
+	}
+	all := len(sel.Docs) == 0 && len(sel.Tags) == 0
+	var out []*Document
+	for _, d := range ordered {
+		keep := all || named[d.ID]
+		for _, t := range d.Tags {
+			if include[t] {
+				keep = true
+			}
+			if exclude[t] {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			out = append(out, d)
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no documents match the selection (--docs/--tags/--exclude-tags)")
+	}
+	return out, nil
+}
+
+// SelectedIDs returns the IDs chosen by sel, or nil when sel keeps everything.
+func (p *Project) SelectedIDs(sel Selection) (map[string]bool, error) {
+	if sel.Empty() {
+		return nil, nil
+	}
+	docs, err := p.SelectDocuments(sel)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool, len(docs))
+	for _, d := range docs {
+		ids[d.ID] = true
+	}
+	return ids, nil
+}
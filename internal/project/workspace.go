@@ -0,0 +1,102 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Merge combines several projects into one read-only, in-memory project for
+// queries that span them. The first project supplies instructions, instruction
+// sets, model config and the prompt layout (custom layouts resolve from its
+// directory). Documents keep their prompt order, grouped by project, and are
+// labelled with their project of origin; their IDs are namespaced with
+// WorkspaceID so a project and its clone can be queried together. Content is
+// loaded up front because each project keeps its own blob store.
+func Merge(name string, projects ...*Project) (*Project, error) {
+	if len(projects) == 0 {
+		return nil, errors.New("no projects to merge")
+	}
+	primary := projects[0]
+	m := NewProject(name, "", primary.rootDir)
+	m.Instructions = primary.Instructions
+	m.InstructionTemplate = primary.InstructionTemplate
+	m.TemplateVars = primary.TemplateVars
+	m.InstructionSets = primary.InstructionSets
+	m.PromptTemplate = primary.PromptTemplate
+	if primary.Config != nil {
+		cfg := *primary.Config
+		m.Config = &cfg
+	}
+	m.readOnly = true
+
+	seen := make(map[string]bool, len(projects))
+	order := 0
+	for _, p := range projects {
+		if seen[p.Name] {
+			return nil, fmt.Errorf("project %s listed more than once", p.Name)
+		}
+		seen[p.Name] = true
+		for _, d := range p.OrderedDocuments() {
+			text, err := p.LoadContent(d)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", p.Name, err)
+			}
+			c := *d
+			c.ID = WorkspaceID(p.Name, d.ID)
+			c.Content = text
+			c.Tags = append([]string(nil), d.Tags...)
+			c.Project = p.Name
+			order++
+			c.Order = order
+			m.Documents[c.ID] = &c
+		}
+		for _, r := range p.Relationships {
+			r.From, r.To = WorkspaceID(p.Name, r.From), WorkspaceID(p.Name, r.To)
+			m.Relationships = append(m.Relationships, r)
+		}
+	}
+	return m, nil
+}
+
+// WorkspaceID is the ID Merge gives document id of project source.
+func WorkspaceID(source, id string) string {
+	return source + ":" + id
+}
+
+// SourceIDs maps merged document IDs back to the IDs used inside project
+// source, dropping those of other projects. A nil set (no selection) stays nil.
+func SourceIDs(ids map[string]bool, source string) map[string]bool {
+	if ids == nil {
+		return nil
+	}
+	out := map[string]bool{}
+	for id := range ids {
+		if orig, ok := strings.CutPrefix(id, WorkspaceID(source, "")); ok {
+			out[orig] = true
+		}
+	}
+	return out
+}
+
+// Sources lists the origin projects of a merged project in document order;
+// it is empty for a regular project.
+func (p *Project) Sources() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, d := range p.OrderedDocuments() {
+		if d.Project != "" && !seen[d.Project] {
+			seen[d.Project] = true
+			names = append(names, d.Project)
+		}
+	}
+	return names
+}
+
+// qualifiedName labels a document with its origin project when it has one.
+func qualifiedName(d *Document) string {
+	if d.Project == "" {
+		return d.Name
+	}
+	return d.Project + "/" + d.Name
+}
@@ -0,0 +1,140 @@
+package redact
+
+import (
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Built-in detector names.
+const (
+	DetectorSecret  = "secret"
+	DetectorEmail   = "email"
+	DetectorIBAN    = "iban"
+	DetectorCard    = "card"
+	DetectorPhone   = "phone"
+	DetectorEntropy = "entropy"
+)
+
+// builtins run in this order; earlier detectors win overlapping matches.
+var builtins = []Detector{
+	{Name: DetectorSecret, Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{Name: DetectorSecret, Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: DetectorSecret, Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+	{Name: DetectorSecret, Pattern: regexp.MustCompile(`\bsk-(?:or-v1-|ant-|proj-)?[A-Za-z0-9_-]{20,}`)},
+	{Name: DetectorSecret, Pattern: regexp.MustCompile(`\b(?:sk|rk|pk)_(?:live|test)_[0-9A-Za-z]{16,}`)},
+	{Name: DetectorSecret, Pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{Name: DetectorSecret, Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{Name: DetectorSecret, Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{Name: DetectorSecret, Pattern: regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret|token|passw(?:or)?d|client[_-]?secret)["']?\s*[:=]\s*["']?([^\s"',;]{8,})`), Group: 1},
+	{Name: DetectorEmail, Pattern: regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}\b`)},
+	{Name: DetectorIBAN, Pattern: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`), Valid: validIBAN},
+	{Name: DetectorCard, Pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), Valid: validCard},
+	{Name: DetectorPhone, Pattern: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{2,4}\)[ .-]?|\d{2,4}[ .-])\d{3,4}[ .-]?\d{3,4}`), Valid: validPhone, Isolated: true},
+	{Name: DetectorEntropy, Pattern: regexp.MustCompile(`[A-Za-z0-9+/_=-]{24,}`), Valid: highEntropy},
+}
+
+// BuiltinNames lists the built-in detectors in precedence order.
+func BuiltinNames() []string {
+	var names []string
+	for _, d := range builtins {
+		if len(names) == 0 || names[len(names)-1] != d.Name {
+			names = append(names, d.Name)
+		}
+	}
+	return names
+}
+
+func isBuiltin(name string) bool {
+	for _, d := range builtins {
+		if d.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// validCard applies the Luhn checksum to 13-19 digit numbers.
+func validCard(s string) bool {
+	d := digits(s)
+	if len(d) < 13 || len(d) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(d) - 1; i >= 0; i-- {
+		n := int(d[i] - '0')
+		if double {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// validIBAN checks the ISO 13616 mod-97 checksum.
+func validIBAN(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	rearranged := s[4:] + s[:4]
+	var b strings.Builder
+	for _, r := range rearranged {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			b.WriteString(big.NewInt(int64(r - 'A' + 10)).String())
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(b.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+func validPhone(s string) bool {
+	n := len(digits(s))
+	return n >= 9 && n <= 15
+}
+
+// highEntropy accepts long tokens mixing letters and digits whose Shannon
+// entropy suggests a random key rather than a word or identifier.
+func highEntropy(s string) bool {
+	var letters, nums bool
+	counts := map[rune]int{}
+	for _, r := range s {
+		counts[r]++
+		switch {
+		case unicode.IsLetter(r):
+			letters = true
+		case unicode.IsDigit(r):
+			nums = true
+		}
+	}
+	if !letters || !nums || strings.HasPrefix(s, PlaceholderPrefix[1:]) {
+		return false
+	}
+	entropy := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= 4.0
+}
@@ -0,0 +1,264 @@
+// Package redact replaces sensitive values in text with placeholders before
+// it leaves the machine, and restores them in model responses.
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// PlaceholderPrefix starts every placeholder, e.g. [REDACTED_EMAIL_1].
+const PlaceholderPrefix = "[REDACTED_"
+
+// Detector finds one kind of sensitive value.
+type Detector struct {
+	// Name labels the placeholders and the report (e.g. "email").
+	Name    string
+	Pattern *regexp.Regexp
+	// Group selects a submatch to redact instead of the whole match, so
+	// "api_key=..." keeps its key name.
+	Group int
+	// Valid filters candidate matches (e.g. the Luhn check); nil accepts all.
+	Valid func(match string) bool
+	// Isolated rejects matches that are part of a longer run of digit
+	// groups, such as a slice of an account number.
+	Isolated bool
+}
+
+// Options configure a Redactor.
+type Options struct {
+	// Detectors names the built-in detectors to run; empty runs all of them.
+	Detectors []string
+	// Rules are custom regular expressions keyed by name, such as customer IDs.
+	Rules map[string]string
+}
+
+// Finding summarizes the values one detector redacted.
+type Finding struct {
+	Detector    string
+	Occurrences int
+	Distinct    int
+	// Examples are masked samples of the redacted values.
+	Examples []string
+}
+
+// Redactor redacts text with stable placeholders: the same value always gets
+// the same placeholder, so a response referring to it can be restored.
+type Redactor struct {
+	detectors   []Detector
+	placeholder map[string]string // original -> placeholder
+	original    map[string]string // placeholder -> original
+	next        map[string]int
+	findings    map[string]*Finding
+}
+
+// New returns a Redactor running the selected built-in detectors and the
+// custom rules. Custom rules take precedence over built-ins on overlaps.
+func New(opts Options) (*Redactor, error) {
+	r := &Redactor{
+		placeholder: map[string]string{},
+		original:    map[string]string{},
+		next:        map[string]int{},
+		findings:    map[string]*Finding{},
+	}
+	names := make([]string, 0, len(opts.Rules))
+	for name := range opts.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		re, err := regexp.Compile(opts.Rules[name])
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %s: %w", name, err)
+		}
+		r.detectors = append(r.detectors, Detector{Name: name, Pattern: re})
+	}
+	selected := map[string]bool{}
+	for _, name := range opts.Detectors {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !isBuiltin(name) {
+			return nil, fmt.Errorf("unknown redaction detector %q (use %s)", name, strings.Join(BuiltinNames(), "|"))
+		}
+		selected[name] = true
+	}
+	for _, d := range builtins {
+		if len(selected) == 0 || selected[d.Name] {
+			r.detectors = append(r.detectors, d)
+		}
+	}
+	return r, nil
+}
+
+type match struct {
+	start, end int
+	rank       int
+}
+
+// Redact returns text with every detected value replaced by its placeholder.
+func (r *Redactor) Redact(text string) string {
+	var matches []match
+	for rank, d := range r.detectors {
+		for _, loc := range d.Pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := loc[0], loc[1]
+			if d.Group > 0 {
+				if 2*d.Group+1 >= len(loc) || loc[2*d.Group] < 0 {
+					continue
+				}
+				start, end = loc[2*d.Group], loc[2*d.Group+1]
+			}
+			if start == end || !atBoundary(text, start, end) || d.Isolated && !isolated(text, start, end) {
+				continue
+			}
+			if d.Valid != nil && !d.Valid(text[start:end]) {
+				continue
+			}
+			matches = append(matches, match{start: start, end: end, rank: rank})
+		}
+	}
+	if len(matches) == 0 {
+		return text
+	}
+	// Earlier detectors win overlaps, then longer matches.
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		return matches[i].end-matches[i].start > matches[j].end-matches[j].start
+	})
+	var kept []match
+	for _, m := range matches {
+		overlaps := false
+		for _, k := range kept {
+			if m.start < k.end && k.start < m.end {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			kept = append(kept, m)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].start < kept[j].start })
+
+	var b strings.Builder
+	last := 0
+	for _, m := range kept {
+		b.WriteString(text[last:m.start])
+		b.WriteString(r.placeholderFor(r.detectors[m.rank].Name, text[m.start:m.end]))
+		last = m.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func (r *Redactor) placeholderFor(name, value string) string {
+	f := r.findings[name]
+	if f == nil {
+		f = &Finding{Detector: name}
+		r.findings[name] = f
+	}
+	f.Occurrences++
+	if ph, ok := r.placeholder[value]; ok {
+		return ph
+	}
+	f.Distinct++
+	if len(f.Examples) < 3 {
+		f.Examples = append(f.Examples, Mask(value))
+	}
+	label := placeholderLabel(name)
+	r.next[label]++
+	ph := fmt.Sprintf("%s%s_%d]", PlaceholderPrefix, label, r.next[label])
+	r.placeholder[value] = ph
+	r.original[ph] = value
+	return ph
+}
+
+func placeholderLabel(name string) string {
+	return strings.Map(func(c rune) rune {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			return unicode.ToUpper(c)
+		}
+		return '_'
+	}, name)
+}
+
+// Restore replaces placeholders in text with the values they stand for.
+func (r *Redactor) Restore(text string) string {
+	if len(r.original) == 0 || !strings.Contains(text, PlaceholderPrefix) {
+		return text
+	}
+	pairs := make([]string, 0, 2*len(r.original))
+	for ph, val := range r.original {
+		pairs = append(pairs, ph, val)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// Mapping returns placeholder -> original value for everything redacted so far.
+func (r *Redactor) Mapping() map[string]string {
+	out := make(map[string]string, len(r.original))
+	for k, v := range r.original {
+		out[k] = v
+	}
+	return out
+}
+
+// Report lists what was redacted, by detector name.
+func (r *Redactor) Report() []Finding {
+	out := make([]Finding, 0, len(r.findings))
+	for _, f := range r.findings {
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Detector < out[j].Detector })
+	return out
+}
+
+// Count is the number of values redacted so far.
+func (r *Redactor) Count() int {
+	n := 0
+	for _, f := range r.findings {
+		n += f.Occurrences
+	}
+	return n
+}
+
+// Mask shortens a value for reports, keeping only its ends.
+func Mask(value string) string {
+	rs := []rune(value)
+	if len(rs) <= 6 {
+		return strings.Repeat("*", len(rs))
+	}
+	return string(rs[:2]) + strings.Repeat("*", len(rs)-4) + string(rs[len(rs)-2:])
+}
+
+// atBoundary rejects matches that continue into surrounding letters or
+// digits, such as a phone-like run inside a longer number.
+func atBoundary(text string, start, end int) bool {
+	isWord := func(b byte) bool {
+		return b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+	}
+	if start > 0 && isWord(text[start-1]) && isWord(text[start]) {
+		return false
+	}
+	if end < len(text) && isWord(text[end]) && isWord(text[end-1]) {
+		return false
+	}
+	return true
+}
+
+// isolated reports whether no digit group continues the match across a
+// single separator on either side.
+func isolated(text string, start, end int) bool {
+	isDigit := func(b byte) bool { return b >= '0' && b <= '9' }
+	isSep := func(b byte) bool { return b == ' ' || b == '-' || b == '.' }
+	if start >= 2 && isSep(text[start-1]) && isDigit(text[start-2]) {
+		return false
+	}
+	if end+1 < len(text) && isSep(text[end]) && isDigit(text[end+1]) {
+		return false
+	}
+	return true
+}
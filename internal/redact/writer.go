@@ -0,0 +1,44 @@
+package redact
+
+import (
+	"io"
+	"strings"
+)
+
+// RestoreWriter restores placeholders in streamed text. A placeholder split
+// across writes is held back until it is complete.
+type RestoreWriter struct {
+	r       *Redactor
+	w       io.Writer
+	pending string
+}
+
+// NewRestoreWriter wraps w; call Flush when the stream ends.
+func NewRestoreWriter(r *Redactor, w io.Writer) *RestoreWriter {
+	return &RestoreWriter{r: r, w: w}
+}
+
+func (rw *RestoreWriter) Write(p []byte) (int, error) {
+	rw.pending += string(p)
+	cut := len(rw.pending)
+	if i := strings.LastIndex(rw.pending, "["); i >= 0 && !strings.Contains(rw.pending[i:], "]") {
+		tail := rw.pending[i:]
+		if strings.HasPrefix(PlaceholderPrefix, tail) || strings.HasPrefix(tail, PlaceholderPrefix) {
+			cut = i
+		}
+	}
+	out := rw.r.Restore(rw.pending[:cut])
+	rw.pending = rw.pending[cut:]
+	if _, err := io.WriteString(rw.w, out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes any held-back text.
+func (rw *RestoreWriter) Flush() error {
+	out := rw.r.Restore(rw.pending)
+	rw.pending = ""
+	_, err := io.WriteString(rw.w, out)
+	return err
+}
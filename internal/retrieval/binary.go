@@ -0,0 +1,487 @@
+package retrieval
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
+)
+
+// Index storage formats.
+const (
+	FormatBinary = "binary"
+	FormatJSON   = "json"
+)
+
+// Vector encodings of the binary format. float32 stores vectors as built;
+// float16 halves the vector block and int8 quarters it (one scale per
+// vector), at a small cost in similarity precision.
+const (
+	QuantFloat32 = "float32"
+	QuantFloat16 = "float16"
+	QuantInt8    = "int8"
+)
+
+// binaryMagic starts index.bin; binaryVersion is its layout version.
+var binaryMagic = []byte("DLIDXBIN")
+
+const binaryVersion = 1
+
+// Layout of index.bin (integers little-endian):
+//
+//	magic "DLIDXBIN" | uint32 layout version | uint32 header length
+//	header JSON (binaryHeader)
+//	text block: chunk texts back to back, 8-byte aligned
+//	vector block: one slot of Dim values per record, 64-byte aligned
+//	  float32: 4 bytes per value; float16: 2 bytes per value;
+//	  int8: one float32 scale per record, then 1 byte per value
+//
+// Records without a vector keep a zeroed slot.
+type binaryHeader struct {
+	SchemaVersion int               `json:"schema_version"`
+	DocHashes     map[string]string `json:"doc_hashes"`
+	Meta          IndexMeta         `json:"meta"`
+	Quantization  string            `json:"quantization"`
+	Dim           int               `json:"dim"`
+	TextLength    int               `json:"text_length"`
+	Records       []binaryRecord    `json:"records"`
+}
+
+type binaryRecord struct {
+	DocID     string `json:"doc_id"`
+	DocName   string `json:"doc_name"`
+	ChunkID   int    `json:"chunk_id"`
+	ChunkHash string `json:"chunk_hash,omitempty"`
+	// TextOffset and TextLength locate the chunk text in the text block.
+	TextOffset int  `json:"text_offset"`
+	TextLength int  `json:"text_length"`
+	HasVector  bool `json:"has_vector,omitempty"`
+}
+
+func BinaryIndexPath(projectRoot string) string {
+	return filepath.Join(projectRoot, "index.bin")
+}
+
+// ParseFormat normalizes an index format; empty selects FormatBinary.
+func ParseFormat(s string) (string, error) {
+	switch f := strings.ToLower(strings.TrimSpace(s)); f {
+	case "", FormatBinary:
+		return FormatBinary, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("invalid index format %q (use binary or json)", s)
+}
+
+// ParseQuantization normalizes a vector encoding; empty stays empty (keep the
+// current encoding) and "none" means float32.
+func ParseQuantization(s string) (string, error) {
+	switch q := strings.ToLower(strings.TrimSpace(s)); q {
+	case "":
+		return "", nil
+	case "none", QuantFloat32:
+		return QuantFloat32, nil
+	case QuantFloat16, QuantInt8:
+		return q, nil
+	}
+	return "", fmt.Errorf("invalid index quantization %q (use float32, float16 or int8)", s)
+}
+
+// StoredFormat reports which index file the project has: FormatBinary,
+// FormatJSON, or "" when there is none.
+func StoredFormat(projectRoot string) string {
+	if _, err := os.Stat(BinaryIndexPath(projectRoot)); err == nil {
+		return FormatBinary
+	}
+	if _, err := os.Stat(IndexPath(projectRoot)); err == nil {
+		return FormatJSON
+	}
+	return ""
+}
+
+// Open loads the project's index from index.bin, falling back to an older
+// index.json. Close releases a memory-mapped index.
+func Open(projectRoot string) (*Index, error) {
+	idx, err := LoadBinary(BinaryIndexPath(projectRoot))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Load(IndexPath(projectRoot))
+	}
+	return idx, err
+}
+
+// Store writes the index under projectRoot in idx.Format (binary when empty)
+// and removes the file of the other format, so a JSON index is migrated by
+// its first binary save and --index-format json converts back.
+func (idx *Index) Store(projectRoot string) error {
+	format, err := ParseFormat(idx.Format)
+	if err != nil {
+		return err
+	}
+	keep, drop := BinaryIndexPath(projectRoot), IndexPath(projectRoot)
+	if format == FormatJSON {
+		keep, drop = drop, keep
+		err = idx.Save(keep)
+	} else {
+		err = idx.SaveBinary(keep)
+	}
+	if err != nil {
+		return err
+	}
+	idx.Format = format
+	if err := os.Remove(drop); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Close unmaps a memory-mapped vector block. Vectors of the index, and of
+// records copied from it, must not be used afterwards.
+func (idx *Index) Close() error {
+	if idx == nil || idx.release == nil {
+		return nil
+	}
+	err := idx.release()
+	idx.release = nil
+	for i := range idx.Records {
+		idx.Records[i].Vector = nil
+	}
+	return err
+}
+
+// SaveBinary writes the index to path in the binary format using
+// idx.Quantization (float32 when empty).
+func (idx *Index) SaveBinary(path string) error {
+	if idx == nil {
+		return fmt.Errorf("nil index")
+	}
+	quant, err := ParseQuantization(idx.Quantization)
+	if err != nil {
+		return err
+	}
+	if quant == "" {
+		quant = QuantFloat32
+	}
+	if idx.DocHashes == nil {
+		idx.DocHashes = map[string]string{}
+	}
+	idx.SchemaVersion = Schema.Current()
+
+	h := binaryHeader{
+		SchemaVersion: idx.SchemaVersion,
+		DocHashes:     idx.DocHashes,
+		Meta:          idx.Meta,
+		Quantization:  quant,
+		Records:       make([]binaryRecord, len(idx.Records)),
+	}
+	var text bytes.Buffer
+	for i, r := range idx.Records {
+		if n := len(r.Vector); n > 0 {
+			if h.Dim == 0 {
+				h.Dim = n
+			} else if n != h.Dim {
+				return fmt.Errorf("record %s#%d has %d dimensions, expected %d", r.DocName, r.ChunkID, n, h.Dim)
+			}
+		}
+		h.Records[i] = binaryRecord{
+			DocID: r.DocID, DocName: r.DocName, ChunkID: r.ChunkID, ChunkHash: r.ChunkHash,
+			TextOffset: text.Len(), TextLength: len(r.Text), HasVector: len(r.Vector) > 0,
+		}
+		text.WriteString(r.Text)
+	}
+	h.TextLength = text.Len()
+	head, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(binaryMagic)
+	binary.Write(&buf, binary.LittleEndian, uint32(binaryVersion))
+	binary.Write(&buf, binary.LittleEndian, uint32(len(head)))
+	buf.Write(head)
+	pad(&buf, 8)
+	buf.Write(text.Bytes())
+	pad(&buf, 64)
+	writeVectors(&buf, idx.Records, h.Dim, quant)
+	if err := vault.WriteFile(path, buf.Bytes()); err != nil {
+		return err
+	}
+	idx.Quantization = quant
+	return nil
+}
+
+// LoadBinary reads an index.bin. Unencrypted float32 vectors are used in
+// place from a read-only memory mapping (see Close); quantized vectors are
+// expanded to float32 once.
+func LoadBinary(path string) (*Index, error) {
+	data, release, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if vault.Sealed(data) {
+		if err := release(); err != nil {
+			return nil, err
+		}
+		if data, err = vault.ReadFile(path); err != nil {
+			return nil, err
+		}
+		release = nil
+	} else if err := vault.CheckPlain(path); err != nil {
+		release()
+		return nil, err
+	}
+	idx, mapped, err := decodeBinary(data)
+	if err != nil {
+		if release != nil {
+			release()
+		}
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if mapped && release != nil {
+		idx.release = release
+	} else if release != nil {
+		if err := release(); err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+// decodeBinary parses an index.bin image. mapped reports whether record
+// vectors point into data.
+func decodeBinary(data []byte) (idx *Index, mapped bool, err error) {
+	head, body, err := binaryHeaderBytes(data)
+	if err != nil {
+		return nil, false, err
+	}
+	head, _, err = Schema.Migrate(head)
+	if err != nil {
+		return nil, false, err
+	}
+	var h binaryHeader
+	if err := json.Unmarshal(head, &h); err != nil {
+		return nil, false, err
+	}
+	n := len(h.Records)
+	textStart := align(body, 8)
+	vecStart := align(textStart+h.TextLength, 64)
+	size, err := vectorBlockSize(n, h.Dim, h.Quantization)
+	if err != nil {
+		return nil, false, err
+	}
+	if h.TextLength < 0 || vecStart+size > len(data) {
+		return nil, false, errors.New("truncated index")
+	}
+	texts := string(data[textStart : textStart+h.TextLength])
+
+	vectors, mapped := decodeVectors(data[vecStart:vecStart+size], n, h.Dim, h.Quantization)
+	idx = &Index{
+		SchemaVersion: h.SchemaVersion,
+		DocHashes:     h.DocHashes,
+		Meta:          h.Meta,
+		Records:       make([]Record, n),
+		Format:        FormatBinary,
+		Quantization:  h.Quantization,
+	}
+	if idx.DocHashes == nil {
+		idx.DocHashes = map[string]string{}
+	}
+	for i, r := range h.Records {
+		if r.TextOffset < 0 || r.TextLength < 0 || r.TextOffset+r.TextLength > len(texts) {
+			return nil, false, fmt.Errorf("record %d text out of range", i)
+		}
+		idx.Records[i] = Record{DocID: r.DocID, DocName: r.DocName, ChunkID: r.ChunkID, ChunkHash: r.ChunkHash, Text: texts[r.TextOffset : r.TextOffset+r.TextLength]}
+		if r.HasVector && h.Dim > 0 {
+			idx.Records[i].Vector = vectors[i*h.Dim : (i+1)*h.Dim : (i+1)*h.Dim]
+		}
+	}
+	return idx, mapped, nil
+}
+
+// binaryHeaderBytes checks the preamble and returns the header JSON and the
+// offset just past it.
+func binaryHeaderBytes(data []byte) ([]byte, int, error) {
+	if len(data) < 16 || !bytes.HasPrefix(data, binaryMagic) {
+		return nil, 0, errors.New("not a binary index")
+	}
+	if v := binary.LittleEndian.Uint32(data[8:]); v != binaryVersion {
+		return nil, 0, fmt.Errorf("unsupported binary index layout %d; upgrade docloom", v)
+	}
+	n := int(binary.LittleEndian.Uint32(data[12:]))
+	if 16+n > len(data) {
+		return nil, 0, errors.New("truncated index header")
+	}
+	return data[16 : 16+n], 16 + n, nil
+}
+
+func vectorBlockSize(n, dim int, quant string) (int, error) {
+	switch quant {
+	case QuantFloat32:
+		return n * dim * 4, nil
+	case QuantFloat16:
+		return n * dim * 2, nil
+	case QuantInt8:
+		return n*4 + n*dim, nil
+	}
+	return 0, fmt.Errorf("unsupported vector quantization %q", quant)
+}
+
+func writeVectors(buf *bytes.Buffer, records []Record, dim int, quant string) {
+	if dim == 0 {
+		return
+	}
+	b := make([]byte, 4)
+	slot := func(r Record) []float32 {
+		if len(r.Vector) == 0 {
+			return make([]float32, dim)
+		}
+		return r.Vector
+	}
+	switch quant {
+	case QuantFloat32:
+		for _, r := range records {
+			for _, v := range slot(r) {
+				binary.LittleEndian.PutUint32(b, math.Float32bits(v))
+				buf.Write(b)
+			}
+		}
+	case QuantFloat16:
+		for _, r := range records {
+			for _, v := range slot(r) {
+				binary.LittleEndian.PutUint16(b, toFloat16(v))
+				buf.Write(b[:2])
+			}
+		}
+	case QuantInt8:
+		scales := make([]float32, len(records))
+		for i, r := range records {
+			var max float32
+			for _, v := range r.Vector {
+				if a := float32(math.Abs(float64(v))); a > max {
+					max = a
+				}
+			}
+			scales[i] = max / 127
+			binary.LittleEndian.PutUint32(b, math.Float32bits(scales[i]))
+			buf.Write(b)
+		}
+		for i, r := range records {
+			for _, v := range slot(r) {
+				var q float64
+				if scales[i] > 0 {
+					q = math.Round(float64(v / scales[i]))
+				}
+				buf.WriteByte(byte(int8(math.Max(-127, math.Min(127, q)))))
+			}
+		}
+	}
+}
+
+// decodeVectors returns the n*dim vector values in block. float32 blocks are
+// used in place when the host is little-endian and the block aligned.
+func decodeVectors(block []byte, n, dim int, quant string) ([]float32, bool) {
+	count := n * dim
+	if count == 0 {
+		return nil, false
+	}
+	if quant == QuantFloat32 && littleEndian && uintptr(unsafe.Pointer(&block[0]))%4 == 0 {
+		return unsafe.Slice((*float32)(unsafe.Pointer(&block[0])), count), true
+	}
+	out := make([]float32, 0, count)
+	switch quant {
+	case QuantFloat32:
+		for i := 0; i < count; i++ {
+			out = append(out, math.Float32frombits(binary.LittleEndian.Uint32(block[i*4:])))
+		}
+	case QuantFloat16:
+		for i := 0; i < count; i++ {
+			out = append(out, fromFloat16(binary.LittleEndian.Uint16(block[i*2:])))
+		}
+	case QuantInt8:
+		values := block[n*4:]
+		for i := 0; i < n; i++ {
+			scale := math.Float32frombits(binary.LittleEndian.Uint32(block[i*4:]))
+			for _, q := range values[i*dim : (i+1)*dim] {
+				out = append(out, float32(int8(q))*scale)
+			}
+		}
+	}
+	return out, false
+}
+
+var littleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+func align(n, to int) int {
+	return (n + to - 1) / to * to
+}
+
+func pad(buf *bytes.Buffer, to int) {
+	for buf.Len()%to != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+// toFloat16 converts f to IEEE 754 half precision, rounding to nearest even.
+func toFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xff) - 127 + 15
+	mant := bits & 0x7fffff
+	switch {
+	case bits>>23&0xff == 0xff: // Inf, NaN
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp >= 0x1f: // overflow
+		return sign | 0x7c00
+	case exp <= 0: // subnormal or zero
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		half := mant >> shift
+		rem, mid := mant&(1<<shift-1), uint32(1)<<(shift-1)
+		if rem > mid || (rem == mid && half&1 == 1) {
+			half++
+		}
+		return sign | uint16(half)
+	}
+	half := uint32(exp)<<10 | mant>>13
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && half&1 == 1) {
+		half++ // may carry into the exponent, rounding up to the next power of two or Inf
+	}
+	return sign | uint16(half)
+}
+
+// fromFloat16 converts an IEEE 754 half precision value to float32.
+func fromFloat16(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+	switch exp {
+	case 0:
+		v := float32(mant) / (1 << 24)
+		if sign != 0 {
+			v = -v
+		}
+		return v
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	}
+	return math.Float32frombits(sign | (exp+112)<<23 | mant<<13)
+}
@@ -0,0 +1,281 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
+)
+
+func sampleIndex(n, dim int) *Index {
+	rng := rand.New(rand.NewSource(1))
+	idx := &Index{DocHashes: map[string]string{"d1": "h1"}, Meta: IndexMeta{IndexVersion: 1, EmbedProvider: "openrouter", EmbedModel: "e1", EmbedDim: dim}}
+	for i := 0; i < n; i++ {
+		r := Record{DocID: "d1", DocName: "doc.md", ChunkID: i, ChunkHash: fmt.Sprintf("h%d", i), Text: fmt.Sprintf("chunk %d: ERR-%04d ünïcode text", i, i)}
+		if i%5 != 4 { // every fifth record has no vector (lexical only)
+			r.Vector = make([]float32, dim)
+			for j := range r.Vector {
+				r.Vector[j] = float32(rng.NormFloat64())
+			}
+		}
+		idx.Records = append(idx.Records, r)
+	}
+	return idx
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	for _, quant := range []string{QuantFloat32, QuantFloat16, QuantInt8} {
+		t.Run(quant, func(t *testing.T) {
+			dir := t.TempDir()
+			want := sampleIndex(10, 8)
+			want.Quantization = quant
+			if err := want.Store(dir); err != nil {
+				t.Fatalf("store: %v", err)
+			}
+			got, err := Open(dir)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			defer got.Close()
+			if got.Format != FormatBinary || got.Quantization != quant || got.Meta.EmbedModel != "e1" || got.DocHashes["d1"] != "h1" {
+				t.Fatalf("unexpected header: %+v %q %q", got.Meta, got.Format, got.Quantization)
+			}
+			if len(got.Records) != len(want.Records) {
+				t.Fatalf("expected %d records, got %d", len(want.Records), len(got.Records))
+			}
+			tolerance := map[string]float64{QuantFloat32: 0, QuantFloat16: 1e-3, QuantInt8: 2e-2}[quant]
+			for i, w := range want.Records {
+				g := got.Records[i]
+				if g.DocID != w.DocID || g.ChunkID != w.ChunkID || g.ChunkHash != w.ChunkHash || g.Text != w.Text {
+					t.Fatalf("record %d = %+v, want %+v", i, g, w)
+				}
+				if len(g.Vector) != len(w.Vector) {
+					t.Fatalf("record %d has %d dimensions, want %d", i, len(g.Vector), len(w.Vector))
+				}
+				if len(w.Vector) > 0 {
+					if sim := CosineSim(g.Vector, w.Vector); 1-sim > tolerance+1e-6 {
+						t.Fatalf("record %d similarity after %s round trip = %v", i, quant, sim)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBinaryIndexIsSmaller(t *testing.T) {
+	dir := t.TempDir()
+	idx := sampleIndex(50, 64)
+	idx.Format = FormatJSON
+	if err := idx.Store(dir); err != nil {
+		t.Fatal(err)
+	}
+	size := func(path string) int64 {
+		st, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st.Size()
+	}
+	jsonSize := size(IndexPath(dir))
+	var prev int64 = jsonSize
+	for _, quant := range []string{QuantFloat32, QuantFloat16, QuantInt8} {
+		idx.Format, idx.Quantization = FormatBinary, quant
+		if err := idx.Store(dir); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(IndexPath(dir)); !os.IsNotExist(err) {
+			t.Fatalf("index.json should be removed after a binary store, got %v", err)
+		}
+		n := size(BinaryIndexPath(dir))
+		if n >= prev {
+			t.Fatalf("%s index is %d bytes, not smaller than %d", quant, n, prev)
+		}
+		prev = n
+	}
+}
+
+func TestBuildIndexMigratesJSON(t *testing.T) {
+	dir := t.TempDir()
+	docs := map[string]struct{ Name, Content string }{
+		"d1": {Name: "a.md", Content: "alpha\n\nbeta"},
+	}
+	opts := BuildOptions{EmbedProvider: "openrouter", EmbedModel: "e1", ChunkMaxTokens: 2, Format: FormatJSON}
+	if _, err := BuildIndex(context.Background(), &fakeEmbedder{dim: 3}, dir, docs, opts); err != nil {
+		t.Fatal(err)
+	}
+	if StoredFormat(dir) != FormatJSON {
+		t.Fatalf("--index-format json should write index.json, found %q", StoredFormat(dir))
+	}
+
+	// The default format converts the JSON index without re-embedding.
+	opts.Format, opts.Quantization = "", QuantInt8
+	emb := &fakeEmbedder{dim: 3}
+	idx, err := BuildIndex(context.Background(), emb, dir, docs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emb.calls != 0 || StoredFormat(dir) != FormatBinary || idx.Quantization != QuantInt8 {
+		t.Fatalf("expected migration to an int8 index.bin without embedding: calls=%d format=%q quant=%q", emb.calls, StoredFormat(dir), idx.Quantization)
+	}
+	if _, err := os.Stat(IndexPath(dir)); !os.IsNotExist(err) {
+		t.Fatalf("index.json left behind: %v", err)
+	}
+
+	// An unchanged index keeps its encoding and is not rewritten.
+	before, err := os.Stat(BinaryIndexPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Quantization = ""
+	chunks := len(idx.Records)
+	idx, err = BuildIndex(context.Background(), emb, dir, docs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	after, err := os.Stat(BinaryIndexPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Quantization != QuantInt8 || !after.ModTime().Equal(before.ModTime()) || len(idx.Records) != chunks {
+		t.Fatalf("unchanged index was rewritten or re-encoded: quant=%q records=%d", idx.Quantization, len(idx.Records))
+	}
+	if hits := idx.Search([]float32{1, 0, 0}, 1, 0); len(hits) != 1 || hits[0].Score < 0.99 {
+		t.Fatalf("search on loaded binary index = %+v", hits)
+	}
+}
+
+func TestBinaryIndexInEncryptedProject(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "project.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Encrypt(dir, vault.Secret{Passphrase: "pw"}, []string{"project.json"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sampleIndex(5, 4).Store(dir); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(BinaryIndexPath(dir))
+	if err != nil || !vault.Sealed(raw) {
+		t.Fatalf("index.bin not sealed (%v)", err)
+	}
+	got, err := Open(dir)
+	if err != nil {
+		t.Fatalf("open sealed index: %v", err)
+	}
+	if len(got.Records) != 5 || len(got.Records[0].Vector) != 4 || got.release != nil {
+		t.Fatalf("unexpected sealed index: %d records, mapped=%v", len(got.Records), got.release != nil)
+	}
+}
+
+func TestFloat16Conversion(t *testing.T) {
+	cases := []struct {
+		in   float32
+		bits uint16
+	}{
+		{0, 0x0000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},
+		{1e6, 0x7c00},                   // overflow to +Inf
+		{5.960464477539063e-08, 0x0001}, // smallest subnormal
+		{float32(math.Inf(-1)), 0xfc00},
+	}
+	for _, c := range cases {
+		if got := toFloat16(c.in); got != c.bits {
+			t.Errorf("toFloat16(%v) = %#04x, want %#04x", c.in, got, c.bits)
+		}
+		if c.bits != 0x7c00 {
+			if back := fromFloat16(c.bits); back != c.in {
+				t.Errorf("fromFloat16(%#04x) = %v, want %v", c.bits, back, c.in)
+			}
+		}
+	}
+	if v := fromFloat16(toFloat16(0.1)); math.Abs(float64(v)-0.1) > 1e-4 {
+		t.Errorf("0.1 round trip = %v", v)
+	}
+}
+
+// Benchmarks compare loading and searching a 2000-chunk, 1536-dimension
+// index stored as JSON and in each binary encoding:
+//
+//	go test ./internal/retrieval -run '^$' -bench 'Load|Search' -benchmem
+const benchRecords, benchDim = 2000, 1536
+
+func benchIndexDir(b *testing.B, format, quant string) string {
+	b.Helper()
+	dir := b.TempDir()
+	idx := sampleIndex(benchRecords, benchDim)
+	idx.Format, idx.Quantization = format, quant
+	if err := idx.Store(dir); err != nil {
+		b.Fatal(err)
+	}
+	return dir
+}
+
+var benchFormats = []struct{ name, format, quant string }{
+	{"json", FormatJSON, ""},
+	{"binary-float32", FormatBinary, QuantFloat32},
+	{"binary-float16", FormatBinary, QuantFloat16},
+	{"binary-int8", FormatBinary, QuantInt8},
+}
+
+func BenchmarkLoad(b *testing.B) {
+	for _, f := range benchFormats {
+		b.Run(f.name, func(b *testing.B) {
+			dir := benchIndexDir(b, f.format, f.quant)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				idx, err := Open(dir)
+				if err != nil {
+					b.Fatal(err)
+				}
+				idx.Close()
+			}
+		})
+	}
+}
+
+func BenchmarkLoadAndSearch(b *testing.B) {
+	query := sampleIndex(1, benchDim).Records[0].Vector
+	for _, f := range benchFormats {
+		b.Run(f.name, func(b *testing.B) {
+			dir := benchIndexDir(b, f.format, f.quant)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				idx, err := Open(dir)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(idx.Search(query, 6, 0)) == 0 {
+					b.Fatal("no results")
+				}
+				idx.Close()
+			}
+		})
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	query := sampleIndex(1, benchDim).Records[0].Vector
+	for _, f := range benchFormats {
+		b.Run(f.name, func(b *testing.B) {
+			idx, err := Open(benchIndexDir(b, f.format, f.quant))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer idx.Close()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				idx.Search(query, 6, 0)
+			}
+		})
+	}
+}
@@ -4,13 +4,19 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"math"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"time"
+
+	"github.com/KaramelBytes/docloom-cli/internal/schema"
+	"github.com/KaramelBytes/docloom-cli/internal/utils"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
 )
 
 type Record struct {
@@ -20,13 +26,24 @@ type Record struct {
 	ChunkHash string    `json:"chunk_hash,omitempty"`
 	Text      string    `json:"text"`
 	Vector    []float32 `json:"vector"`
+	// Score is the query similarity filled in by search; it is not stored.
+	Score float64 `json:"-"`
 }
 
 type Index struct {
+	// SchemaVersion is the index.json format (see Schema).
+	SchemaVersion int `json:"schema_version"`
 	// Map document id to content hash for invalidation
 	DocHashes map[string]string `json:"doc_hashes"`
 	Records   []Record          `json:"records"`
 	Meta      IndexMeta         `json:"meta"`
+	// Format and Quantization select how Store writes the index (FormatBinary
+	// with QuantFloat32 when empty); loading sets them to the file's own.
+	Format       string `json:"-"`
+	Quantization string `json:"-"`
+
+	lexical *LexicalIndex
+	release func() error
 }
 
 type IndexMeta struct {
@@ -47,19 +64,20 @@ func (idx *Index) Save(path string) error {
 	if idx.DocHashes == nil {
 		idx.DocHashes = map[string]string{}
 	}
+	idx.SchemaVersion = Schema.Current()
 	b, err := json.MarshalIndent(idx, "", "  ")
 	if err != nil {
 		return err
 	}
-	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, b, 0o644); err != nil {
-		return err
-	}
-	return os.Rename(tmp, path)
+	return vault.WriteFile(path, b)
 }
 
 func Load(path string) (*Index, error) {
-	b, err := os.ReadFile(path)
+	b, err := vault.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, _, err = Schema.Migrate(b)
 	if err != nil {
 		return nil, err
 	}
@@ -67,20 +85,40 @@ func Load(path string) (*Index, error) {
 	if err := json.Unmarshal(b, &idx); err != nil {
 		return nil, err
 	}
-	if idx.DocHashes == nil {
-		idx.DocHashes = map[string]string{}
+	idx.Format = FormatJSON
+	return &idx, nil
+}
+
+// RemapDocIDs rewrites document IDs, e.g. after a project clone assigns fresh IDs.
+func (idx *Index) RemapDocIDs(mapping map[string]string) {
+	hashes := make(map[string]string, len(idx.DocHashes))
+	for id, h := range idx.DocHashes {
+		if n, ok := mapping[id]; ok {
+			id = n
+		}
+		hashes[id] = h
 	}
-	// Backfill meta defaults for older indexes
-	if idx.Meta.IndexVersion == 0 {
-		idx.Meta.IndexVersion = 1
+	idx.DocHashes = hashes
+	for i := range idx.Records {
+		if n, ok := mapping[idx.Records[i].DocID]; ok {
+			idx.Records[i].DocID = n
+		}
 	}
-	return &idx, nil
 }
 
 func IndexPath(projectRoot string) string {
 	return filepath.Join(projectRoot, "index.json")
 }
 
+// LockIndex takes the advisory lock guarding index.json, waiting up to timeout
+// for another process (utils.DefaultLockTimeout when zero).
+func LockIndex(projectRoot string, timeout time.Duration) (*utils.FileLock, error) {
+	if timeout <= 0 {
+		timeout = utils.DefaultLockTimeout
+	}
+	return utils.AcquireLock(IndexPath(projectRoot)+".lock", timeout)
+}
+
 // metaCompatible checks if previous index metadata can be reused under current options.
 func metaCompatible(prev, cur IndexMeta) bool {
 	if prev.IndexVersion != cur.IndexVersion {
@@ -157,18 +195,53 @@ type BuildOptions struct {
 	Include         []string
 	Exclude         []string
 	MaxChunksPerDoc int
+	// ReadOnly builds the index in memory without locking or saving index.json.
+	ReadOnly bool
+	// LockTimeout bounds the wait for the index lock (see LockIndex).
+	LockTimeout time.Duration
+	// Format is the storage format (FormatBinary when empty, so older
+	// index.json files migrate on the next build). Quantization is the
+	// binary vector encoding; empty keeps the current one.
+	Format       string
+	Quantization string
 }
 
 // BuildIndex creates or refreshes the index for given documents.
 // documents map key is doc id; value holds name and content.
+// A nil emb only chunks: new records have no vector (lexical search only)
+// and existing vectors are kept for a later vector build.
 func BuildIndex(ctx context.Context, emb Embedder, projectRoot string, documents map[string]struct{ Name, Content string }, opts BuildOptions) (*Index, error) {
-	path := IndexPath(projectRoot)
-	prev, _ := Load(path) // best effort
+	if !opts.ReadOnly {
+		// Held across load-embed-save so concurrent builds do not overwrite each other.
+		lock, err := LockIndex(projectRoot, opts.LockTimeout)
+		if err != nil {
+			return nil, err
+		}
+		defer lock.Release()
+	}
+	format, err := ParseFormat(opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	quant, err := ParseQuantization(opts.Quantization)
+	if err != nil {
+		return nil, err
+	}
+	prev, err := Open(projectRoot) // best effort, but never overwrite a newer index
+	if errors.Is(err, schema.ErrNewerVersion) {
+		return nil, err
+	}
 	if prev == nil {
 		prev = &Index{DocHashes: map[string]string{}}
 	}
+	if quant == "" {
+		quant = QuantFloat32
+		if prev.Format == FormatBinary {
+			quant = prev.Quantization
+		}
+	}
 	// Prepare fresh index state
-	idx := &Index{DocHashes: map[string]string{}, Records: nil}
+	idx := &Index{DocHashes: map[string]string{}, Records: nil, Format: format, Quantization: quant}
 	// Defaults
 	if opts.ChunkMaxTokens <= 0 {
 		opts.ChunkMaxTokens = 400
@@ -186,6 +259,11 @@ func BuildIndex(ctx context.Context, emb Embedder, projectRoot string, documents
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	}
+	if emb == nil {
+		idx.Meta.EmbedProvider = prev.Meta.EmbedProvider
+		idx.Meta.EmbedModel = prev.Meta.EmbedModel
+		idx.Meta.EmbedDim = prev.Meta.EmbedDim
+	}
 
 	type work struct {
 		docID, docName string
@@ -226,7 +304,7 @@ func BuildIndex(ctx context.Context, emb Embedder, projectRoot string, documents
 			if !opts.Force && metaCompatible(prev.Meta, idx.Meta) {
 				for j := range prevChunks {
 					pr := prevChunks[j]
-					if pr.ChunkID == i && pr.ChunkHash == ch && len(pr.Vector) > 0 {
+					if pr.ChunkID == i && pr.ChunkHash == ch && (emb == nil || len(pr.Vector) > 0) {
 						matched = &pr
 						break
 					}
@@ -239,17 +317,38 @@ func BuildIndex(ctx context.Context, emb Embedder, projectRoot string, documents
 			}
 		}
 	}
+	// An unchanged index is served as loaded, without rewriting it.
+	if len(toEmbed) == 0 && prev.unchanged(idx, len(reuse)) {
+		if _, err := os.Stat(LexicalPath(projectRoot)); err != nil && !opts.ReadOnly {
+			if err := prev.saveLexical(projectRoot); err != nil {
+				return nil, err
+			}
+		}
+		return prev, nil
+	}
+	// Reused vectors may point into prev's mapped file; copy them before releasing it.
+	if prev.release != nil {
+		for i := range reuse {
+			reuse[i].Vector = append([]float32(nil), reuse[i].Vector...)
+		}
+		prev.Close()
+	}
 	// If nothing to embed and we can reuse, just return reuse records
-	if len(toEmbed) == 0 {
+	if len(toEmbed) == 0 || emb == nil {
 		idx.Records = append(idx.Records, reuse...)
+		for _, cm := range toEmbed {
+			idx.Records = append(idx.Records, Record{DocID: cm.docID, DocName: cm.docName, ChunkID: cm.chunkID, ChunkHash: cm.hash, Text: cm.text})
+		}
 		sort.Slice(idx.Records, func(i, j int) bool {
 			if idx.Records[i].DocName == idx.Records[j].DocName {
 				return idx.Records[i].ChunkID < idx.Records[j].ChunkID
 			}
 			return idx.Records[i].DocName < idx.Records[j].DocName
 		})
-		if err := idx.Save(path); err != nil {
-			return nil, err
+		if !opts.ReadOnly {
+			if err := idx.save(projectRoot); err != nil {
+				return nil, err
+			}
 		}
 		return idx, nil
 	}
@@ -308,20 +407,53 @@ func BuildIndex(ctx context.Context, emb Embedder, projectRoot string, documents
 		}
 		return idx.Records[i].DocName < idx.Records[j].DocName
 	})
-	if err := idx.Save(path); err != nil {
-		return nil, err
+	if !opts.ReadOnly {
+		if err := idx.save(projectRoot); err != nil {
+			return nil, err
+		}
 	}
 	return idx, nil
 }
 
+// save stores the index and its lexical.json under projectRoot.
+func (idx *Index) save(projectRoot string) error {
+	if err := idx.Store(projectRoot); err != nil {
+		return err
+	}
+	return idx.saveLexical(projectRoot)
+}
+
+// unchanged reports whether idx, a loaded index whose records were all
+// reused (reused of them), already matches the rebuilt next in content and
+// storage format.
+func (idx *Index) unchanged(next *Index, reused int) bool {
+	if idx.Format == "" || idx.Format != next.Format || reused != len(idx.Records) {
+		return false
+	}
+	if idx.Format == FormatBinary && idx.Quantization != next.Quantization {
+		return false
+	}
+	return idx.SchemaVersion == Schema.Current() && maps.Equal(idx.DocHashes, next.DocHashes)
+}
+
 // Search returns top-k records above the minScore threshold, sorted by descending score.
 func (idx *Index) Search(query []float32, topK int, minScore float64) []Record {
+	return idx.SearchDocs(query, topK, minScore, nil)
+}
+
+// SearchDocs is Search restricted to records whose document ID is in docIDs;
+// a nil set searches every record. The index itself keeps all documents so a
+// narrow selection never discards embeddings.
+func (idx *Index) SearchDocs(query []float32, topK int, minScore float64, docIDs map[string]bool) []Record {
 	type scored struct {
 		rec   Record
 		score float64
 	}
 	scoredRecs := make([]scored, 0, len(idx.Records))
 	for _, r := range idx.Records {
+		if docIDs != nil && !docIDs[r.DocID] {
+			continue
+		}
 		s := CosineSim(query, r.Vector)
 		if s >= minScore {
 			scoredRecs = append(scoredRecs, scored{rec: r, score: s})
@@ -334,6 +466,7 @@ func (idx *Index) Search(query []float32, topK int, minScore float64) []Record {
 	out := make([]Record, len(scoredRecs))
 	for i, s := range scoredRecs {
 		out[i] = s.rec
+		out[i].Score = s.score
 	}
 	return out
 }
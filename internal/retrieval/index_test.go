@@ -46,9 +46,9 @@ func TestBuildIndex_SaveAndReuse(t *testing.T) {
 	if len(idx.Records) != 2 {
 		t.Fatalf("expected 2 records, got %d", len(idx.Records))
 	}
-	// index.json exists
-	if _, err := os.Stat(IndexPath(dir)); err != nil {
-		t.Fatalf("index.json not found: %v", err)
+	// index.bin exists
+	if _, err := os.Stat(BinaryIndexPath(dir)); err != nil {
+		t.Fatalf("index.bin not found: %v", err)
 	}
 
 	// Reuse: run again, expect no additional Embed calls
@@ -145,3 +145,50 @@ func TestIndexRoundtrip(t *testing.T) {
 		t.Fatalf("roundtrip mismatch")
 	}
 }
+
+func TestLoadMigratesLegacyIndex(t *testing.T) {
+	dir := t.TempDir()
+	p := IndexPath(dir)
+	legacy := `{"doc_hashes":null,"records":[{"doc_id":"d","doc_name":"n","chunk_id":0,"text":"x","vector":[0.5,0.25]}],"meta":{"embed_model":"m"}}`
+	if err := os.WriteFile(p, []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := Load(p)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if idx.Meta.IndexVersion != 1 || idx.DocHashes == nil || idx.Records[0].Vector[1] != 0.25 {
+		t.Fatalf("legacy index not migrated: %+v", idx)
+	}
+	if err := idx.Save(p); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := CheckSchema(dir); err != nil || !st.UpToDate() {
+		t.Fatalf("saved index should be current: %+v (%v)", st, err)
+	}
+
+	newer := `{"schema_version":99,"records":[]}`
+	if err := os.WriteFile(p, []byte(newer), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(p); err == nil || !strings.Contains(err.Error(), "upgrade docloom") {
+		t.Fatalf("expected refusal of newer index, got %v", err)
+	}
+	// Building must not overwrite a newer index either.
+	docs := map[string]struct{ Name, Content string }{"d": {Name: "n", Content: "x"}}
+	if _, err := BuildIndex(context.Background(), &fakeEmbedder{}, dir, docs, BuildOptions{}); err == nil {
+		t.Fatal("expected BuildIndex to refuse a newer index")
+	}
+}
+
+func TestSearchDocsFiltersByDocument(t *testing.T) {
+	idx := &Index{Records: []Record{
+		{DocID: "a", Text: "a0", Vector: []float32{1, 0}},
+		{DocID: "b", Text: "b0", Vector: []float32{1, 0.1}},
+	}}
+	all := idx.SearchDocs([]float32{1, 0}, 5, 0, nil)
+	only := idx.SearchDocs([]float32{1, 0}, 5, 0, map[string]bool{"b": true})
+	if len(all) != 2 || len(only) != 1 || only[0].DocID != "b" {
+		t.Fatalf("unexpected results: all=%v only=%v", all, only)
+	}
+}
@@ -0,0 +1,272 @@
+package retrieval
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
+)
+
+// Retrieval modes.
+const (
+	ModeVector  = "vector"
+	ModeLexical = "lexical"
+	ModeHybrid  = "hybrid"
+)
+
+// BM25 parameters and the reciprocal rank fusion constant.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	rrfK   = 60
+)
+
+// ParseMode normalizes a --retrieval-mode value; empty selects ModeVector.
+func ParseMode(s string) (string, error) {
+	switch m := strings.ToLower(strings.TrimSpace(s)); m {
+	case "":
+		return ModeVector, nil
+	case ModeVector, ModeLexical, ModeHybrid:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid retrieval mode %q (use vector, lexical or hybrid)", s)
+}
+
+// Posting is one chunk containing a term: Chunk is the position of the
+// record in Index.Records and Freq the term's count in its text.
+type Posting struct {
+	Chunk int `json:"c"`
+	Freq  int `json:"f"`
+}
+
+// LexicalIndex is a BM25 inverted index over an Index's records, stored as
+// lexical.json next to index.json.
+type LexicalIndex struct {
+	Version int `json:"version"`
+	// Fingerprint identifies the record texts, in order, the index was built from.
+	Fingerprint string               `json:"fingerprint"`
+	Lengths     []int                `json:"lengths"`
+	AvgLength   float64              `json:"avg_length"`
+	Postings    map[string][]Posting `json:"postings"`
+}
+
+func LexicalPath(projectRoot string) string {
+	return filepath.Join(projectRoot, "lexical.json")
+}
+
+// BuildLexical indexes the text of records.
+func BuildLexical(records []Record) *LexicalIndex {
+	lx := &LexicalIndex{
+		Version:     1,
+		Fingerprint: fingerprint(records),
+		Lengths:     make([]int, len(records)),
+		Postings:    map[string][]Posting{},
+	}
+	total := 0
+	for i, r := range records {
+		terms := Terms(r.Text)
+		lx.Lengths[i] = len(terms)
+		total += len(terms)
+		freq := map[string]int{}
+		for _, t := range terms {
+			freq[t]++
+		}
+		for t, n := range freq {
+			lx.Postings[t] = append(lx.Postings[t], Posting{Chunk: i, Freq: n})
+		}
+	}
+	if len(records) > 0 {
+		lx.AvgLength = float64(total) / float64(len(records))
+	}
+	return lx
+}
+
+func (lx *LexicalIndex) Save(path string) error {
+	b, err := json.Marshal(lx)
+	if err != nil {
+		return err
+	}
+	return vault.WriteFile(path, b)
+}
+
+func LoadLexical(path string) (*LexicalIndex, error) {
+	b, err := vault.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lx LexicalIndex
+	if err := json.Unmarshal(b, &lx); err != nil {
+		return nil, err
+	}
+	return &lx, nil
+}
+
+// Lexical returns the BM25 index for idx, loading lexical.json from
+// projectRoot when it matches the records and rebuilding it in memory otherwise.
+func (idx *Index) Lexical(projectRoot string) *LexicalIndex {
+	if idx.lexical != nil {
+		return idx.lexical
+	}
+	if lx, err := LoadLexical(LexicalPath(projectRoot)); err == nil && lx.Fingerprint == fingerprint(idx.Records) {
+		idx.lexical = lx
+	} else {
+		idx.lexical = BuildLexical(idx.Records)
+	}
+	return idx.lexical
+}
+
+// saveLexical rebuilds and writes lexical.json for the current records.
+func (idx *Index) saveLexical(projectRoot string) error {
+	idx.lexical = BuildLexical(idx.Records)
+	return idx.lexical.Save(LexicalPath(projectRoot))
+}
+
+// SearchLexical ranks records by BM25 against the query terms and returns the
+// top k with Score set to the BM25 score. A nil docIDs searches every record.
+func (idx *Index) SearchLexical(lx *LexicalIndex, query string, topK int, docIDs map[string]bool) []Record {
+	n := len(idx.Records)
+	if lx == nil || n == 0 || len(lx.Lengths) != n {
+		return nil
+	}
+	scores := map[int]float64{}
+	seen := map[string]bool{}
+	for _, t := range Terms(query) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		postings := lx.Postings[t]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (float64(n)-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			if docIDs != nil && !docIDs[idx.Records[p.Chunk].DocID] {
+				continue
+			}
+			tf := float64(p.Freq)
+			norm := 1 - bm25B
+			if lx.AvgLength > 0 {
+				norm += bm25B * float64(lx.Lengths[p.Chunk]) / lx.AvgLength
+			}
+			scores[p.Chunk] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+	ranked := make([]int, 0, len(scores))
+	for i := range scores {
+		ranked = append(ranked, i)
+	}
+	sort.Slice(ranked, func(a, b int) bool {
+		if scores[ranked[a]] == scores[ranked[b]] {
+			return ranked[a] < ranked[b]
+		}
+		return scores[ranked[a]] > scores[ranked[b]]
+	})
+	if topK > 0 && len(ranked) > topK {
+		ranked = ranked[:topK]
+	}
+	out := make([]Record, len(ranked))
+	for i, c := range ranked {
+		out[i] = idx.Records[c]
+		out[i].Score = scores[c]
+	}
+	return out
+}
+
+// SearchHybrid fuses the vector (cosine >= minScore) and BM25 rankings with
+// reciprocal rank fusion. Score is the fused score, sum of 1/(60+rank).
+func (idx *Index) SearchHybrid(lx *LexicalIndex, vector []float32, query string, topK int, minScore float64, docIDs map[string]bool) []Record {
+	depth := 0
+	if topK > 0 {
+		depth = topK * 4
+		if depth < 20 {
+			depth = 20
+		}
+	}
+	return Fuse(topK,
+		idx.SearchDocs(vector, depth, minScore, docIDs),
+		idx.SearchLexical(lx, query, depth, docIDs),
+	)
+}
+
+// Fuse merges rankings of the same records with reciprocal rank fusion and
+// returns the top k (all when topK <= 0) ordered by fused Score.
+func Fuse(topK int, rankings ...[]Record) []Record {
+	type key struct {
+		doc   string
+		chunk int
+	}
+	fused := map[key]*Record{}
+	var order []key
+	for _, ranking := range rankings {
+		for rank, r := range ranking {
+			k := key{r.DocID, r.ChunkID}
+			f, ok := fused[k]
+			if !ok {
+				rec := r
+				rec.Score = 0
+				f = &rec
+				fused[k] = f
+				order = append(order, k)
+			}
+			f.Score += 1 / float64(rrfK+rank+1)
+		}
+	}
+	out := make([]Record, len(order))
+	for i, k := range order {
+		out[i] = *fused[k]
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	if topK > 0 && len(out) > topK {
+		out = out[:topK]
+	}
+	return out
+}
+
+// Terms lowercases text and splits it into search terms. Identifiers joined
+// by '-', '_', '.' or '/' (part numbers, error codes, versions) are kept
+// whole and also indexed by their parts, so "ERR-4021" matches "err-4021",
+// "err" and "4021".
+func Terms(text string) []string {
+	var out []string
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	isJoin := func(r rune) bool { return r == '-' || r == '_' || r == '.' || r == '/' }
+	runes := []rune(strings.ToLower(text))
+	for i := 0; i < len(runes); {
+		if !isWord(runes[i]) {
+			i++
+			continue
+		}
+		start := i
+		parts := 1
+		for i < len(runes) && (isWord(runes[i]) || (isJoin(runes[i]) && i+1 < len(runes) && isWord(runes[i+1]) && i > start)) {
+			if isJoin(runes[i]) {
+				parts++
+			}
+			i++
+		}
+		token := string(runes[start:i])
+		out = append(out, token)
+		if parts > 1 {
+			out = append(out, strings.FieldsFunc(token, isJoin)...)
+		}
+	}
+	return out
+}
+
+// fingerprint hashes the record texts in order.
+func fingerprint(records []Record) string {
+	h := sha1.New()
+	for _, r := range records {
+		h.Write([]byte(r.Text))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
@@ -0,0 +1,105 @@
+package retrieval
+
+import (
+	"context"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestTermsKeepsIdentifiers(t *testing.T) {
+	got := Terms("Error ERR-4021 in v2.1, see the API.")
+	want := []string{"error", "err-4021", "err", "4021", "in", "v2.1", "v2", "1", "see", "the", "api"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Terms = %q, want %q", got, want)
+	}
+}
+
+func TestSearchLexicalFindsExactMatches(t *testing.T) {
+	idx := &Index{Records: []Record{
+		{DocID: "d1", DocName: "faq.md", ChunkID: 0, Text: "Restart the service when the dashboard is slow."},
+		{DocID: "d1", DocName: "faq.md", ChunkID: 1, Text: "Error ERR-4021 means the license server is unreachable."},
+		{DocID: "d2", DocName: "parts.md", ChunkID: 0, Text: "Part PN-7731 replaces PN-7730. Order PN-7731 from the EU depot."},
+	}}
+	lx := idx.Lexical(t.TempDir())
+
+	hits := idx.SearchLexical(lx, "what does err-4021 mean", 2, nil)
+	if len(hits) == 0 || hits[0].DocID != "d1" || hits[0].ChunkID != 1 {
+		t.Fatalf("expected ERR-4021 chunk first, got %+v", hits)
+	}
+	if hits[0].Score <= 0 {
+		t.Fatalf("expected a positive BM25 score, got %v", hits[0].Score)
+	}
+
+	hits = idx.SearchLexical(lx, "PN-7731", 0, nil)
+	if len(hits) != 1 || hits[0].DocName != "parts.md" {
+		t.Fatalf("expected only parts.md, got %+v", hits)
+	}
+	if hits := idx.SearchLexical(lx, "PN-7731", 0, map[string]bool{"d1": true}); len(hits) != 0 {
+		t.Fatalf("doc filter ignored: %+v", hits)
+	}
+}
+
+func TestFuseRewardsAgreement(t *testing.T) {
+	a := Record{DocID: "d", ChunkID: 0}
+	b := Record{DocID: "d", ChunkID: 1}
+	c := Record{DocID: "d", ChunkID: 2}
+	got := Fuse(2, []Record{a, b, c}, []Record{b, c})
+	if len(got) != 2 || got[0].ChunkID != 1 || got[1].ChunkID != 2 {
+		t.Fatalf("expected b then c, got %+v", got)
+	}
+	if want := 1.0/62 + 1.0/61; math.Abs(got[0].Score-want) > 1e-12 {
+		t.Fatalf("fused score = %v, want %v", got[0].Score, want)
+	}
+}
+
+func TestBuildIndexWithoutEmbedder(t *testing.T) {
+	dir := t.TempDir()
+	docs := map[string]struct{ Name, Content string }{
+		"d1": {Name: "codes.md", Content: "ERR-4021 license server unreachable"},
+	}
+	opts := BuildOptions{EmbedProvider: "openrouter", EmbedModel: "e1", ChunkMaxTokens: 50}
+	idx, err := BuildIndex(context.Background(), nil, dir, docs, opts)
+	if err != nil {
+		t.Fatalf("lexical build: %v", err)
+	}
+	if len(idx.Records) != 1 || idx.Records[0].Vector != nil || idx.Meta.EmbedProvider != "" {
+		t.Fatalf("unexpected lexical-only index: %+v", idx)
+	}
+	lx, err := LoadLexical(LexicalPath(dir))
+	if err != nil {
+		t.Fatalf("lexical.json not written: %v", err)
+	}
+	if lx.Fingerprint != fingerprint(idx.Records) || len(lx.Postings["err-4021"]) != 1 {
+		t.Fatalf("unexpected lexical index: %+v", lx)
+	}
+
+	// A later vector build embeds the chunks; a lexical refresh keeps the vectors.
+	emb := &fakeEmbedder{dim: 3}
+	if _, err := BuildIndex(context.Background(), emb, dir, docs, opts); err != nil {
+		t.Fatal(err)
+	}
+	if emb.calls != 1 {
+		t.Fatalf("expected the vector build to embed, got %d calls", emb.calls)
+	}
+	idx, err = BuildIndex(context.Background(), nil, dir, docs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Records[0].Vector) != 3 || idx.Meta.EmbedModel != "e1" {
+		t.Fatalf("lexical refresh dropped vectors: %+v", idx)
+	}
+
+	// A stale lexical.json is rebuilt in memory.
+	if err := os.WriteFile(LexicalPath(dir), []byte(`{"version":1,"fingerprint":"old"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits := loaded.SearchLexical(loaded.Lexical(dir), "license", 1, nil); len(hits) != 1 {
+		t.Fatalf("expected a hit from the rebuilt lexical index, got %+v", hits)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package retrieval
+
+import "os"
+
+// Platforms without mmap support read the file into memory.
+func mapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
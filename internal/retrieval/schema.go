@@ -0,0 +1,50 @@
+package retrieval
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/KaramelBytes/docloom-cli/internal/schema"
+	"github.com/KaramelBytes/docloom-cli/internal/vault"
+)
+
+// Schema holds the index.json migrations; Load upgrades older files and
+// Save writes the current version.
+var Schema = schema.NewRegistry("index.json",
+	schema.Migration{
+		From:        1,
+		Description: "backfill meta.index_version and doc_hashes",
+		Apply: func(doc map[string]any) error {
+			meta, err := schema.Object(doc, "meta")
+			if err != nil {
+				return err
+			}
+			if v, ok := meta["index_version"]; !ok || fmt.Sprint(v) == "0" {
+				meta["index_version"] = 1
+			}
+			_, err = schema.Object(doc, "doc_hashes")
+			return err
+		},
+	},
+)
+
+// CheckSchema reports the migrations pending for the project's index
+// (index.bin header, else index.json). It returns an error satisfying
+// os.IsNotExist when there is no index.
+func CheckSchema(projectRoot string) (schema.Status, error) {
+	b, err := vault.ReadFile(BinaryIndexPath(projectRoot))
+	if err == nil {
+		if b, _, err = binaryHeaderBytes(b); err != nil {
+			return schema.Status{}, err
+		}
+		return Schema.Check(b)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return schema.Status{}, err
+	}
+	if b, err = vault.ReadFile(IndexPath(projectRoot)); err != nil {
+		return schema.Status{}, err
+	}
+	return Schema.Check(b)
+}
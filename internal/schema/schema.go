@@ -0,0 +1,137 @@
+// Package schema versions docloom's JSON files and upgrades older files
+// through an ordered registry of migrations.
+//
+// A versioned file carries a top-level "schema_version" field. Files written
+// before versioning have no field and are treated as version 1. Each
+// migration upgrades a decoded document by exactly one version, so a file at
+// version N passes through every migration from N to the current version.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Field is the top-level JSON key holding a file's schema version.
+const Field = "schema_version"
+
+// Migration upgrades a decoded document from version From to From+1.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(doc map[string]any) error
+}
+
+// Registry holds the ordered migrations for one file type.
+type Registry struct {
+	// Name identifies the file in messages, e.g. "project.json".
+	Name       string
+	migrations []Migration
+}
+
+// NewRegistry builds a registry. Migrations must start at version 1 and be
+// contiguous; the current version is one past the last migration.
+func NewRegistry(name string, migrations ...Migration) *Registry {
+	for i, m := range migrations {
+		if m.From != i+1 {
+			panic(fmt.Sprintf("schema: %s migration %d upgrades from version %d, want %d", name, i, m.From, i+1))
+		}
+	}
+	return &Registry{Name: name, migrations: migrations}
+}
+
+// Current is the version written by this build.
+func (r *Registry) Current() int { return len(r.migrations) + 1 }
+
+// NewerVersionError reports a file written by a newer docloom.
+type NewerVersionError struct {
+	Name      string
+	Version   int
+	Supported int
+}
+
+func (e *NewerVersionError) Error() string {
+	return fmt.Sprintf("%s uses schema version %d, but this docloom supports up to version %d; upgrade docloom to open it",
+		e.Name, e.Version, e.Supported)
+}
+
+// ErrNewerVersion matches any *NewerVersionError with errors.Is.
+var ErrNewerVersion = errors.New("newer schema version")
+
+// Is lets errors.Is(err, ErrNewerVersion) match.
+func (e *NewerVersionError) Is(target error) bool { return target == ErrNewerVersion }
+
+// Status describes what Migrate would do to a file.
+type Status struct {
+	Name    string
+	From    int
+	To      int
+	Pending []Migration
+}
+
+// UpToDate reports whether the file needs no migration.
+func (s Status) UpToDate() bool { return len(s.Pending) == 0 }
+
+// Check reads the version of data without changing it.
+func (r *Registry) Check(data []byte) (Status, error) {
+	var head struct {
+		Version *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return Status{}, fmt.Errorf("parse %s: %w", r.Name, err)
+	}
+	v := 1
+	if head.Version != nil {
+		v = *head.Version
+	}
+	if v < 1 {
+		return Status{}, fmt.Errorf("%s has invalid schema version %d", r.Name, v)
+	}
+	if v > r.Current() {
+		return Status{}, &NewerVersionError{Name: r.Name, Version: v, Supported: r.Current()}
+	}
+	return Status{Name: r.Name, From: v, To: r.Current(), Pending: r.migrations[v-1:]}, nil
+}
+
+// Migrate upgrades data to the current version and returns the new encoding
+// with the status that was applied. Up-to-date data is returned unchanged.
+func (r *Registry) Migrate(data []byte) ([]byte, Status, error) {
+	st, err := r.Check(data)
+	if err != nil || st.UpToDate() {
+		return data, st, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // keep numbers (e.g. embedding vectors) exactly as written
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, st, fmt.Errorf("parse %s: %w", r.Name, err)
+	}
+	for _, m := range st.Pending {
+		if err := m.Apply(doc); err != nil {
+			return nil, st, fmt.Errorf("migrate %s from version %d: %w", r.Name, m.From, err)
+		}
+	}
+	doc[Field] = r.Current()
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, st, fmt.Errorf("encode %s: %w", r.Name, err)
+	}
+	return out, st, nil
+}
+
+// Object returns doc[key] as an object, creating it when missing or null.
+// Migrations use it to backfill nested structures.
+func Object(doc map[string]any, key string) (map[string]any, error) {
+	switch v := doc[key].(type) {
+	case map[string]any:
+		return v, nil
+	case nil:
+		m := map[string]any{}
+		doc[key] = m
+		return m, nil
+	default:
+		return nil, fmt.Errorf("%q is %T, want an object", key, v)
+	}
+}
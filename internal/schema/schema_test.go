@@ -0,0 +1,82 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testRegistry() *Registry {
+	return NewRegistry("test.json",
+		Migration{From: 1, Description: "rename title to name", Apply: func(doc map[string]any) error {
+			doc["name"] = doc["title"]
+			delete(doc, "title")
+			return nil
+		}},
+		Migration{From: 2, Description: "backfill meta", Apply: func(doc map[string]any) error {
+			meta, err := Object(doc, "meta")
+			if err != nil {
+				return err
+			}
+			if _, ok := meta["version"]; !ok {
+				meta["version"] = 1
+			}
+			return nil
+		}},
+	)
+}
+
+func TestMigrateRunsPendingInOrder(t *testing.T) {
+	r := testRegistry()
+	out, st, err := r.Migrate([]byte(`{"title":"x","vec":[0.1,0.2000000029802322]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.From != 1 || st.To != 3 || len(st.Pending) != 2 {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	var doc struct {
+		Version int             `json:"schema_version"`
+		Name    string          `json:"name"`
+		Meta    map[string]int  `json:"meta"`
+		Vec     json.RawMessage `json:"vec"`
+	}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != 3 || doc.Name != "x" || doc.Meta["version"] != 1 {
+		t.Fatalf("unexpected result: %s", out)
+	}
+	if string(doc.Vec) != "[0.1,0.2000000029802322]" {
+		t.Fatalf("numbers changed: %s", doc.Vec)
+	}
+
+	// A file part-way through only gets the remaining migrations.
+	_, st, err = r.Migrate([]byte(`{"schema_version":2,"name":"x"}`))
+	if err != nil || len(st.Pending) != 1 || st.Pending[0].From != 2 {
+		t.Fatalf("unexpected status %+v (%v)", st, err)
+	}
+
+	current := []byte(`{"schema_version":3,"name":"x"}`)
+	same, st, err := r.Migrate(current)
+	if err != nil || !st.UpToDate() || string(same) != string(current) {
+		t.Fatalf("current file should be untouched: %s %+v %v", same, st, err)
+	}
+}
+
+func TestMigrateRefusesNewerVersion(t *testing.T) {
+	_, _, err := testRegistry().Migrate([]byte(`{"schema_version":9}`))
+	if !errors.Is(err, ErrNewerVersion) || !strings.Contains(err.Error(), "supports up to version 3") {
+		t.Fatalf("expected newer-version error, got %v", err)
+	}
+}
+
+func TestNewRegistryRejectsGaps(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for non-contiguous migrations")
+		}
+	}()
+	NewRegistry("bad.json", Migration{From: 2})
+}
@@ -0,0 +1,182 @@
+// Package templates manages the instruction template library: built-in
+// templates embedded from docs/templates and user templates on disk.
+//
+// Templates are Markdown with {{name}} placeholders. A placeholder with a
+// default, {{name|default}}, is optional; one without is required.
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	builtin "github.com/KaramelBytes/docloom-cli/docs/templates"
+)
+
+// SourceBuiltin marks templates embedded in the binary.
+const SourceBuiltin = "built-in"
+
+// Template is a named instruction template.
+type Template struct {
+	Name string
+	// Source is SourceBuiltin or the path of the user template file.
+	Source string
+	Body   string
+}
+
+// Var describes a placeholder used by a template.
+type Var struct {
+	Name     string
+	Default  string
+	Required bool
+}
+
+var placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*(?:\|([^}]*))?\}\}`)
+
+// UserDirs returns the directories searched for user templates, in
+// precedence order: ~/.docloom/templates (next to config.yaml), then
+// ~/.docloom-cli/templates.
+func UserDirs() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{
+		filepath.Join(home, ".docloom", "templates"),
+		filepath.Join(home, ".docloom-cli", "templates"),
+	}
+}
+
+// List returns all templates sorted by name. User templates shadow built-ins
+// of the same name.
+func List() ([]Template, error) {
+	byName := map[string]Template{}
+	entries, err := fs.ReadDir(builtin.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read built-in templates: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".md" {
+			continue
+		}
+		b, err := fs.ReadFile(builtin.FS, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read built-in template %s: %w", e.Name(), err)
+		}
+		name := strings.TrimSuffix(e.Name(), ".md")
+		byName[name] = Template{Name: name, Source: SourceBuiltin, Body: string(b)}
+	}
+	dirs := UserDirs()
+	// Walk lowest precedence first so earlier directories win.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		files, err := os.ReadDir(dirs[i])
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("read templates dir: %w", err)
+		}
+		for _, f := range files {
+			if f.IsDir() || filepath.Ext(f.Name()) != ".md" {
+				continue
+			}
+			path := filepath.Join(dirs[i], f.Name())
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("read template %s: %w", path, err)
+			}
+			name := strings.TrimSuffix(f.Name(), ".md")
+			byName[name] = Template{Name: name, Source: path, Body: string(b)}
+		}
+	}
+	out := make([]Template, 0, len(byName))
+	for _, t := range byName {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Get returns the template with the given name.
+func Get(name string) (*Template, error) {
+	all, err := List()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(all))
+	for i := range all {
+		if all[i].Name == name {
+			return &all[i], nil
+		}
+		names = append(names, all[i].Name)
+	}
+	return nil, fmt.Errorf("unknown template %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// Vars lists the placeholders in body in order of first appearance.
+func (t *Template) Vars() []Var {
+	var out []Var
+	seen := map[string]bool{}
+	for _, m := range placeholderRe.FindAllStringSubmatch(t.Body, -1) {
+		if seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		hasDefault := strings.Contains(m[0], "|")
+		out = append(out, Var{Name: m[1], Default: m[2], Required: !hasDefault})
+	}
+	return out
+}
+
+// Render substitutes vars into the template. Missing required variables and
+// variables the template does not use are reported as errors.
+func (t *Template) Render(vars map[string]string) (string, error) {
+	known := map[string]bool{}
+	var missing []string
+	for _, v := range t.Vars() {
+		known[v.Name] = true
+		if _, ok := vars[v.Name]; !ok && v.Required {
+			missing = append(missing, v.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("template %s requires variables: %s (use --var name=value)", t.Name, strings.Join(missing, ", "))
+	}
+	var unknown []string
+	for k := range vars {
+		if !known[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return "", fmt.Errorf("template %s has no variables named: %s", t.Name, strings.Join(unknown, ", "))
+	}
+	out := placeholderRe.ReplaceAllStringFunc(t.Body, func(s string) string {
+		m := placeholderRe.FindStringSubmatch(s)
+		if v, ok := vars[m[1]]; ok {
+			return v
+		}
+		return m[2]
+	})
+	return out, nil
+}
+
+// ParseVars converts key=value pairs into a map.
+func ParseVars(pairs []string) (map[string]string, error) {
+	vars := make(map[string]string, len(pairs))
+	for _, kv := range pairs {
+		k, v, ok := strings.Cut(kv, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid --var %q (expected key=value)", kv)
+		}
+		vars[k] = v
+	}
+	return vars, nil
+}
@@ -0,0 +1,89 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinsEmbedded(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tpl, err := Get("concise-summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpl.Source != SourceBuiltin {
+		t.Fatalf("expected built-in source, got %s", tpl.Source)
+	}
+	out, err := tpl.Render(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "in 5–8 bullet points") {
+		t.Fatalf("default not applied: %q", out)
+	}
+	out, err = tpl.Render(map[string]string{"bullets": "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "in 3 bullet points") {
+		t.Fatalf("variable not applied: %q", out)
+	}
+}
+
+func TestRenderValidatesVariables(t *testing.T) {
+	tpl := &Template{Name: "x", Body: "Compare {{a}} with {{ b | the baseline }} and {{a}}."}
+	vars := tpl.Vars()
+	if len(vars) != 2 || !vars[0].Required || vars[1].Required || vars[1].Default != " the baseline " {
+		t.Fatalf("unexpected vars: %+v", vars)
+	}
+	if _, err := tpl.Render(nil); err == nil || !strings.Contains(err.Error(), "requires variables: a") {
+		t.Fatalf("expected missing variable error, got %v", err)
+	}
+	if _, err := tpl.Render(map[string]string{"a": "x", "c": "y"}); err == nil || !strings.Contains(err.Error(), "c") {
+		t.Fatalf("expected unknown variable error, got %v", err)
+	}
+	out, err := tpl.Render(map[string]string{"a": "v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "Compare v2 with  the baseline  and v2." {
+		t.Fatalf("unexpected render: %q", out)
+	}
+}
+
+func TestUserTemplatesOverrideBuiltins(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".docloom-cli", "templates")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "concise-summary.md"), []byte("Mine."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tpl, err := Get("concise-summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpl.Body != "Mine." || tpl.Source == SourceBuiltin {
+		t.Fatalf("user template should win: %+v", tpl)
+	}
+	if _, err := Get("does-not-exist"); err == nil {
+		t.Fatal("expected unknown template error")
+	}
+}
+
+func TestParseVars(t *testing.T) {
+	vars, err := ParseVars([]string{"a=1", "b=x=y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["a"] != "1" || vars["b"] != "x=y" {
+		t.Fatalf("unexpected vars: %v", vars)
+	}
+	if _, err := ParseVars([]string{"novalue"}); err == nil {
+		t.Fatal("expected error for missing '='")
+	}
+}
@@ -36,6 +36,7 @@ func PrettyJSON(v any) ([]byte, error) {
 }
 
 // FindProjectRoot attempts to find a directory containing a project.json by walking up.
+// A project kept in a .docloom directory counts as well; its .docloom path is returned.
 // If the input path is a file, it starts from its directory.
 func FindProjectRoot(start string) (string, error) {
 	if start == "" {
@@ -54,9 +55,10 @@ func FindProjectRoot(start string) (string, error) {
 		dir = filepath.Dir(start)
 	}
 	for {
-		candidate := filepath.Join(dir, "project.json")
-		if _, err := os.Stat(candidate); err == nil {
-			return dir, nil
+		for _, root := range []string{dir, filepath.Join(dir, ".docloom")} {
+			if _, err := os.Stat(filepath.Join(root, "project.json")); err == nil {
+				return root, nil
+			}
 		}
 		parent := filepath.Dir(dir)
 		if parent == dir { // reached filesystem root
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package utils
+
+import "os"
+
+// Platforms without file locking run unlocked.
+func tryLock(*os.File) (bool, error) { return true, nil }
+
+func unlock(*os.File) error { return nil }
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireLockTimesOutWithHolderPID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "project.json.lock")
+	l, err := AcquireLock(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = AcquireLock(path, 150*time.Millisecond)
+	var le *LockedError
+	if !errors.As(err, &le) || !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected LockedError, got %v", err)
+	}
+	if le.PID != os.Getpid() {
+		t.Fatalf("PID = %d, want %d", le.PID, os.Getpid())
+	}
+	if !strings.HasPrefix(err.Error(), "project is locked by PID") {
+		t.Fatalf("message should name the lock: %v", err)
+	}
+	if time.Since(start) < 150*time.Millisecond {
+		t.Fatal("lock attempt returned before the timeout")
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	l2, err := AcquireLock(path, 0)
+	if err != nil {
+		t.Fatalf("lock not released: %v", err)
+	}
+	l2.Release()
+}
+
+func TestLockedErrorWithoutPIDNamesKind(t *testing.T) {
+	err := &LockedError{Path: filepath.Join("p", "index.json.lock")}
+	if got := err.Error(); !strings.HasPrefix(got, "index is locked by another docloom process") {
+		t.Fatalf("unexpected message: %s", got)
+	}
+	if strings.Contains(ErrLocked.Error(), "project") {
+		t.Fatalf("ErrLocked must not name a lock kind: %v", ErrLocked)
+	}
+}
+
+// TestLockHelperProcess holds a lock for TestAcquireLockAcrossProcesses.
+func TestLockHelperProcess(t *testing.T) {
+	path := os.Getenv("DOCLOOM_LOCK_HELPER")
+	if path == "" {
+		t.Skip("helper process only")
+	}
+	if _, err := AcquireLock(path, time.Second); err != nil {
+		os.Exit(2)
+	}
+	os.Stdout.WriteString("locked\n")
+	time.Sleep(time.Minute) // killed by the parent
+}
+
+func TestAcquireLockAcrossProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json.lock")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+	cmd.Env = append(os.Environ(), "DOCLOOM_LOCK_HELPER="+path)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	if line, _ := bufio.NewReader(out).ReadString('\n'); line != "locked\n" {
+		t.Fatalf("helper did not take the lock: %q", line)
+	}
+
+	_, err = AcquireLock(path, 100*time.Millisecond)
+	var le *LockedError
+	if !errors.As(err, &le) || le.PID != cmd.Process.Pid {
+		t.Fatalf("expected lock held by PID %d, got %v", cmd.Process.Pid, err)
+	}
+	if !errors.Is(err, ErrLocked) || !strings.HasPrefix(err.Error(), "index is locked by PID") {
+		t.Fatalf("unexpected message: %v", err)
+	}
+
+	// The OS releases the lock when the holder dies.
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+	l, err := AcquireLock(path, 2*time.Second)
+	if err != nil {
+		t.Fatalf("lock not released after holder exit: %v", err)
+	}
+	l.Release()
+}
@@ -33,6 +33,19 @@ func TruncateToTokenLimit(text string, limit int) string {
     return string(runes[:charLimit])
 }
 
+// TruncateTailToTokenLimit keeps the end of text so that it roughly fits within a token limit.
+func TruncateTailToTokenLimit(text string, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	runes := []rune(text)
+	charLimit := int(float64(limit) / 1.2 * 4.0)
+	if charLimit >= len(runes) {
+		return text
+	}
+	return string(runes[len(runes)-charLimit:])
+}
+
 // TokenBreakdown returns a simple breakdown map of labeled sections to token counts.
 func TokenBreakdown(sections map[string]string) map[string]int {
 	out := make(map[string]int, len(sections))
@@ -35,3 +35,14 @@ func TestTruncateToTokenLimit(t *testing.T) {
 		t.Fatalf("expected non-empty truncation")
 	}
 }
+
+func TestTruncateTailToTokenLimit(t *testing.T) {
+	text := strings.Repeat("x", 4000) + "END"
+	tail := utils.TruncateTailToTokenLimit(text, 50)
+	if !strings.HasSuffix(tail, "END") {
+		t.Fatalf("expected tail to be kept, got %q", tail)
+	}
+	if n := utils.CountTokens(tail); n > 50 {
+		t.Fatalf("tokens=%d exceeds limit", n)
+	}
+}
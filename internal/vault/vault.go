@@ -0,0 +1,541 @@
+// Package vault encrypts project files at rest. An encrypted project has a
+// header file (HeaderFile) holding a random data key sealed with a key
+// encryption key, which is derived from a passphrase with scrypt or taken
+// from a key file. Files inside the project are sealed with AES-256-GCM
+// under the data key. ReadFile and WriteFile apply this transparently to any
+// path under an encrypted project and pass other files through unchanged.
+package vault
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/KaramelBytes/docloom-cli/internal/utils"
+	"golang.org/x/crypto/scrypt"
+)
+
+// HeaderFile marks an encrypted project directory and holds its sealed data key.
+const HeaderFile = "encryption.json"
+
+// Key derivation methods recorded in the header.
+const (
+	KDFScrypt  = "scrypt"
+	KDFKeyFile = "keyfile"
+)
+
+// magic prefixes every sealed file; it is also the AEAD additional data.
+var magic = []byte("DLVAULT1")
+
+const keySize = 32
+
+// Default scrypt cost (N=2^15, r=8, p=1), about 100ms and 32 MiB per unlock.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Upper bounds on the scrypt cost accepted from a header, so a crafted one
+// cannot make an unlock take gigabytes of memory or run for hours.
+const (
+	maxScryptN = 1 << 20
+	maxScryptR = 16
+	maxScryptP = 16
+)
+
+// ErrWrongKey is returned when a secret does not open a project's data key.
+var ErrWrongKey = errors.New("wrong passphrase or key file")
+
+// ErrUnsealed is returned when a file inside an encrypted project is stored
+// in plain text, which would let anyone who can write the directory replace
+// it undetected.
+var ErrUnsealed = errors.New("plain-text file in an encrypted project")
+
+// Secret unlocks a project: a passphrase stretched with scrypt, or the
+// contents of a key file (any file; its SHA-256 is used as the key).
+type Secret struct {
+	Passphrase string
+	KeyFile    []byte
+}
+
+// Header is the content of HeaderFile.
+type Header struct {
+	Version int    `json:"version"`
+	Cipher  string `json:"cipher"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt,omitempty"`
+	N       int    `json:"n,omitempty"`
+	R       int    `json:"r,omitempty"`
+	P       int    `json:"p,omitempty"`
+	// SealedKey is the data key sealed with the key encryption key.
+	SealedKey []byte `json:"sealed_key"`
+	// PreviousKey is set while a key rotation is in progress; files not yet
+	// rewritten are still sealed with it.
+	PreviousKey []byte `json:"previous_key,omitempty"`
+}
+
+// SecretFunc supplies the secret for the encrypted project at dir.
+type SecretFunc func(dir string, h *Header) (Secret, error)
+
+// keyring holds a project's data key and, during a rotation, the previous one.
+type keyring struct {
+	current, previous []byte
+}
+
+func (k *keyring) open(data, ad []byte) ([]byte, error) {
+	out, err := open(k.current, data, ad)
+	if err != nil && k.previous != nil {
+		return open(k.previous, data, ad)
+	}
+	return out, err
+}
+
+var (
+	mu           sync.Mutex
+	secretSource SecretFunc
+	keyrings     = map[string]*keyring{}
+	plainOK      = map[string]bool{}
+)
+
+// SetSecretSource installs the function asked for a project's secret the
+// first time one of its files is read or written. Without one, encrypted
+// projects cannot be opened.
+func SetSecretSource(fn SecretFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	secretSource = fn
+}
+
+// projectFile marks a project directory; a header elsewhere is ignored.
+const projectFile = "project.json"
+
+// IsEncrypted reports whether dir is an encrypted project.
+func IsEncrypted(dir string) bool {
+	for _, name := range []string{HeaderFile, projectFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Sealed reports whether data is a file sealed by this package.
+func Sealed(data []byte) bool { return bytes.HasPrefix(data, magic) }
+
+// ReadFile reads path and opens it when it is sealed. A plain file inside an
+// encrypted project is refused with ErrUnsealed (see AllowPlain).
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !Sealed(data) {
+		if err := CheckPlain(path); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	root, ok := root(path)
+	if !ok {
+		return nil, fmt.Errorf("%s is encrypted but no %s was found above it", path, HeaderFile)
+	}
+	kr, err := keys(root)
+	if err != nil {
+		return nil, err
+	}
+	out, err := kr.open(data, fileAD(root, path))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// CheckPlain returns ErrUnsealed when path is inside an encrypted project,
+// for callers that read plain files without ReadFile.
+func CheckPlain(path string) error {
+	root, ok := root(path)
+	if !ok {
+		return nil
+	}
+	mu.Lock()
+	allowed := plainOK[abs(root)]
+	mu.Unlock()
+	if allowed {
+		return nil
+	}
+	return fmt.Errorf("%w: %s (rerun 'project encrypt' if encrypting it was interrupted)", ErrUnsealed, path)
+}
+
+// AllowPlain lets ReadFile return plain files of the encrypted project at dir
+// until the returned function is called. Only the commands that convert a
+// project use it, to finish a run that was interrupted halfway.
+func AllowPlain(dir string) func() {
+	key := abs(dir)
+	mu.Lock()
+	plainOK[key] = true
+	mu.Unlock()
+	return func() {
+		mu.Lock()
+		delete(plainOK, key)
+		mu.Unlock()
+	}
+}
+
+// WriteFile writes data to path atomically, sealing it when path is inside
+// an encrypted project.
+func WriteFile(path string, data []byte) error {
+	if root, ok := root(path); ok {
+		kr, err := keys(root)
+		if err != nil {
+			return err
+		}
+		if data, err = seal(kr.current, data, fileAD(root, path)); err != nil {
+			return fmt.Errorf("encrypt %s: %w", path, err)
+		}
+	}
+	return utils.SafeWriteFile(path, data)
+}
+
+// Encrypt turns dir into an encrypted project protected by secret and seals
+// the given files (relative to dir; directories are walked). The header is
+// written first, so an interrupted run leaves plain files that are refused
+// until Encrypt runs again with the same secret.
+func Encrypt(dir string, secret Secret, files []string) error {
+	var kr *keyring
+	if IsEncrypted(dir) {
+		var err error
+		if kr, err = unlock(dir, secret); err != nil {
+			return err
+		}
+	} else {
+		key, err := newKey()
+		if err != nil {
+			return err
+		}
+		kr = &keyring{current: key}
+		if err := writeHeader(dir, secret, kr); err != nil {
+			return err
+		}
+	}
+	return rewrite(dir, files, kr, kr.current)
+}
+
+// Decrypt opens the given files of the encrypted project at dir in place
+// and removes its header, leaving a plain project.
+func Decrypt(dir string, secret Secret, files []string) error {
+	kr, err := unlock(dir, secret)
+	if err != nil {
+		return err
+	}
+	if err := rewrite(dir, files, kr, nil); err != nil {
+		return err
+	}
+	forget(dir)
+	return os.Remove(filepath.Join(dir, HeaderFile))
+}
+
+// Rekey protects the project at dir with next instead of current. The data
+// key is kept, so only the header changes. With rotate the files are also
+// re-encrypted under a fresh data key; the old key stays in the header until
+// every file is rewritten, so an interrupted rotation is finished by running
+// Rekey again with next as the current secret.
+func Rekey(dir string, current, next Secret, files []string, rotate bool) error {
+	kr, err := unlock(dir, current)
+	if err != nil {
+		return err
+	}
+	if !rotate && kr.previous == nil {
+		return writeHeader(dir, next, kr)
+	}
+	if kr.previous == nil {
+		key, err := newKey()
+		if err != nil {
+			return err
+		}
+		kr = &keyring{current: key, previous: kr.current}
+	}
+	if err := writeHeader(dir, next, kr); err != nil {
+		return err
+	}
+	if err := rewrite(dir, files, kr, kr.current); err != nil {
+		return err
+	}
+	return writeHeader(dir, next, &keyring{current: kr.current})
+}
+
+// Unlock checks secret against the project at dir and caches its keys for
+// later reads and writes in this process.
+func Unlock(dir string, secret Secret) error {
+	_, err := unlock(dir, secret)
+	return err
+}
+
+func unlock(dir string, secret Secret) (*keyring, error) {
+	h, err := ReadHeader(dir)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := keyEncryptionKey(h, secret)
+	if err != nil {
+		return nil, err
+	}
+	kr := &keyring{}
+	if kr.current, err = open(kek, h.SealedKey, magic); err != nil {
+		return nil, ErrWrongKey
+	}
+	if h.PreviousKey != nil {
+		if kr.previous, err = open(kek, h.PreviousKey, magic); err != nil {
+			return nil, ErrWrongKey
+		}
+	}
+	mu.Lock()
+	keyrings[abs(dir)] = kr
+	mu.Unlock()
+	return kr, nil
+}
+
+// ReadHeader loads the header of the encrypted project at dir.
+func ReadHeader(dir string) (*Header, error) {
+	b, err := os.ReadFile(filepath.Join(dir, HeaderFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s is not encrypted", dir)
+		}
+		return nil, fmt.Errorf("read %s: %w", HeaderFile, err)
+	}
+	var h Header
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", HeaderFile, err)
+	}
+	if h.Version != 1 {
+		return nil, fmt.Errorf("unsupported %s version %d", HeaderFile, h.Version)
+	}
+	if h.KDF == KDFScrypt {
+		if h.N < 2 || h.N > maxScryptN || h.N&(h.N-1) != 0 || h.R < 1 || h.R > maxScryptR || h.P < 1 || h.P > maxScryptP {
+			return nil, fmt.Errorf("%s: scrypt cost N=%d r=%d p=%d out of range (N a power of two up to %d, r up to %d, p up to %d)",
+				HeaderFile, h.N, h.R, h.P, maxScryptN, maxScryptR, maxScryptP)
+		}
+	}
+	return &h, nil
+}
+
+func newKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	_, err := rand.Read(key)
+	return key, err
+}
+
+// writeHeader seals kr with secret into dir's header and caches it.
+func writeHeader(dir string, secret Secret, kr *keyring) error {
+	h := &Header{Version: 1, Cipher: "aes-256-gcm"}
+	switch {
+	case len(secret.KeyFile) > 0:
+		h.KDF = KDFKeyFile
+	case secret.Passphrase != "":
+		h.KDF = KDFScrypt
+		h.Salt = make([]byte, 16)
+		if _, err := rand.Read(h.Salt); err != nil {
+			return err
+		}
+		h.N, h.R, h.P = scryptN, scryptR, scryptP
+	default:
+		return errors.New("a passphrase or key file is required")
+	}
+	kek, err := keyEncryptionKey(h, secret)
+	if err != nil {
+		return err
+	}
+	if h.SealedKey, err = seal(kek, kr.current, magic); err != nil {
+		return err
+	}
+	if kr.previous != nil {
+		if h.PreviousKey, err = seal(kek, kr.previous, magic); err != nil {
+			return err
+		}
+	}
+	b, err := utils.PrettyJSON(h)
+	if err != nil {
+		return err
+	}
+	if err := utils.SafeWriteFile(filepath.Join(dir, HeaderFile), b); err != nil {
+		return err
+	}
+	mu.Lock()
+	keyrings[abs(dir)] = kr
+	mu.Unlock()
+	return nil
+}
+
+func keyEncryptionKey(h *Header, secret Secret) ([]byte, error) {
+	switch h.KDF {
+	case KDFKeyFile:
+		if len(secret.KeyFile) == 0 {
+			return nil, errors.New("project is encrypted with a key file; a passphrase cannot open it")
+		}
+		sum := sha256.Sum256(secret.KeyFile)
+		return sum[:], nil
+	case KDFScrypt:
+		if secret.Passphrase == "" {
+			return nil, errors.New("project is encrypted with a passphrase; a key file cannot open it")
+		}
+		return scrypt.Key([]byte(secret.Passphrase), h.Salt, h.N, h.R, h.P, keySize)
+	}
+	return nil, fmt.Errorf("unsupported key derivation %q", h.KDF)
+}
+
+// rewrite opens sealed files with from and writes them sealed under to
+// (nil: plain). Plain files are sealed under to; missing files are skipped.
+func rewrite(dir string, files []string, from *keyring, to []byte) error {
+	for _, rel := range files {
+		err := filepath.WalkDir(filepath.Join(dir, rel), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || filepath.Ext(path) == ".tmp" || filepath.Ext(path) == ".lock" {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			ad := fileAD(dir, path)
+			if Sealed(data) {
+				if to != nil && from.previous == nil {
+					return nil // already sealed under to
+				}
+				if data, err = from.open(data, ad); err != nil {
+					return fmt.Errorf("decrypt %s: %w", path, err)
+				}
+			} else if to == nil {
+				return nil
+			}
+			if to != nil {
+				if data, err = seal(to, data, ad); err != nil {
+					return fmt.Errorf("encrypt %s: %w", path, err)
+				}
+			}
+			return utils.SafeWriteFile(path, data)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keys returns the cached keyring for root, asking the secret source the
+// first time.
+func keys(root string) (*keyring, error) {
+	mu.Lock()
+	kr, ok := keyrings[abs(root)]
+	source := secretSource
+	mu.Unlock()
+	if ok {
+		return kr, nil
+	}
+	if source == nil {
+		return nil, fmt.Errorf("%s is encrypted and no key source is configured", root)
+	}
+	h, err := ReadHeader(root)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := source(root, h)
+	if err != nil {
+		return nil, err
+	}
+	return unlock(root, secret)
+}
+
+func forget(dir string) {
+	mu.Lock()
+	delete(keyrings, abs(dir))
+	mu.Unlock()
+}
+
+// root returns the project directory at or above path's directory when that
+// project is encrypted.
+func root(path string) (string, bool) {
+	dir := filepath.Dir(abs(path))
+	for {
+		if _, err := os.Stat(filepath.Join(dir, projectFile)); err == nil {
+			return dir, IsEncrypted(dir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func abs(path string) string {
+	if a, err := filepath.Abs(path); err == nil {
+		return a
+	}
+	return path
+}
+
+// fileAD is the additional data authenticated with a project file: the magic
+// and the file's slash-separated path relative to the project root, so a
+// sealed file cannot be passed off as another file of the same project.
+func fileAD(root, path string) []byte {
+	rel, err := filepath.Rel(abs(root), abs(path))
+	if err != nil {
+		rel = path
+	}
+	return append(append([]byte{}, magic...), filepath.ToSlash(rel)...)
+}
+
+// seal encrypts plain under key, authenticating ad with it.
+func seal(key, plain, ad []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(append([]byte{}, magic...), nonce...)
+	return aead.Seal(out, nonce, plain, ad), nil
+}
+
+// open decrypts data sealed by seal under key with the same ad.
+func open(key, data, ad []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if !Sealed(data) || len(data) < len(magic)+aead.NonceSize() {
+		return nil, errors.New("not an encrypted file")
+	}
+	body := data[len(magic):]
+	nonce, ciphertext := body[:aead.NonceSize()], body[aead.NonceSize():]
+	out, err := aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, errors.New("authentication failed (file corrupt or wrong key)")
+	}
+	return out, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,208 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newProject(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "project.json"), []byte(`{"name":"p"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "blobs", "a.gz"), []byte("blob"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { forget(dir) })
+	return dir
+}
+
+var files = []string{"project.json", "blobs", "index.json"}
+
+func raw(t *testing.T, path string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	dir := newProject(t)
+	secret := Secret{Passphrase: "correct horse"}
+	if err := Encrypt(dir, secret, files); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if !IsEncrypted(dir) {
+		t.Fatal("expected project to be encrypted")
+	}
+	for _, rel := range []string{"project.json", "blobs/a.gz"} {
+		if b := raw(t, filepath.Join(dir, rel)); !Sealed(b) {
+			t.Fatalf("%s not sealed: %q", rel, b)
+		}
+	}
+	got, err := ReadFile(filepath.Join(dir, "blobs", "a.gz"))
+	if err != nil || string(got) != "blob" {
+		t.Fatalf("ReadFile = %q, %v", got, err)
+	}
+
+	// New files under an encrypted project are sealed transparently.
+	idx := filepath.Join(dir, "index.json")
+	if err := WriteFile(idx, []byte(`{"chunks":[]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !Sealed(raw(t, idx)) {
+		t.Fatal("index.json written in plain text")
+	}
+
+	if err := Decrypt(dir, secret, files); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if IsEncrypted(dir) {
+		t.Fatal("header should be removed")
+	}
+	if b := raw(t, idx); string(b) != `{"chunks":[]}` {
+		t.Fatalf("index.json after decrypt = %q", b)
+	}
+}
+
+func TestSealedFileIsBoundToItsPath(t *testing.T) {
+	dir := newProject(t)
+	if err := Encrypt(dir, Secret{Passphrase: "swap"}, files); err != nil {
+		t.Fatal(err)
+	}
+	idx := filepath.Join(dir, "index.json")
+	if err := WriteFile(idx, []byte(`{"chunks":[]}`)); err != nil {
+		t.Fatal(err)
+	}
+	// A sealed file copied over another path of the same project must not open.
+	if err := os.WriteFile(idx, raw(t, filepath.Join(dir, "blobs", "a.gz")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(idx); err == nil {
+		t.Fatal("expected a swapped sealed file to fail authentication")
+	}
+}
+
+func TestPlainFileInEncryptedProjectIsRefused(t *testing.T) {
+	dir := newProject(t)
+	secret := Secret{Passphrase: "downgrade"}
+	if err := Encrypt(dir, secret, files); err != nil {
+		t.Fatal(err)
+	}
+	pj := filepath.Join(dir, "project.json")
+	if err := os.WriteFile(pj, []byte(`{"name":"evil"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(pj); !errors.Is(err, ErrUnsealed) {
+		t.Fatalf("expected ErrUnsealed, got %v", err)
+	}
+	restore := AllowPlain(dir)
+	if b, err := ReadFile(pj); err != nil || string(b) != `{"name":"evil"}` {
+		t.Fatalf("AllowPlain read = %q, %v", b, err)
+	}
+	restore()
+	// Encrypting again seals what an interrupted run left plain.
+	if err := Encrypt(dir, secret, files); err != nil {
+		t.Fatal(err)
+	}
+	if !Sealed(raw(t, pj)) {
+		t.Fatal("project.json still plain after Encrypt")
+	}
+}
+
+func TestHeaderScryptCostIsBounded(t *testing.T) {
+	dir := newProject(t)
+	if err := Encrypt(dir, Secret{Passphrase: "cost"}, files); err != nil {
+		t.Fatal(err)
+	}
+	h, err := ReadHeader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ n, r, p int }{{1 << 30, 8, 1}, {3 << 10, 8, 1}, {1 << 15, 1 << 10, 1}, {1 << 15, 8, 0}} {
+		bad := *h
+		bad.N, bad.R, bad.P = c.n, c.r, c.p
+		b, err := json.Marshal(bad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, HeaderFile), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := Unlock(dir, Secret{Passphrase: "cost"}); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Fatalf("N=%d r=%d p=%d: expected cost error, got %v", c.n, c.r, c.p, err)
+		}
+	}
+}
+
+func TestWrongSecretIsRejected(t *testing.T) {
+	dir := newProject(t)
+	if err := Encrypt(dir, Secret{Passphrase: "right"}, files); err != nil {
+		t.Fatal(err)
+	}
+	forget(dir)
+	if err := Unlock(dir, Secret{Passphrase: "wrong"}); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey, got %v", err)
+	}
+	if err := Unlock(dir, Secret{KeyFile: []byte("k")}); err == nil {
+		t.Fatal("key file should not open a passphrase project")
+	}
+
+	// Without a cached key the secret source is consulted.
+	SetSecretSource(func(string, *Header) (Secret, error) { return Secret{Passphrase: "right"}, nil })
+	defer SetSecretSource(nil)
+	forget(dir)
+	if b, err := ReadFile(filepath.Join(dir, "project.json")); err != nil || !bytes.Contains(b, []byte(`"p"`)) {
+		t.Fatalf("ReadFile via secret source = %q, %v", b, err)
+	}
+}
+
+func TestRekeyAndRotate(t *testing.T) {
+	dir := newProject(t)
+	old := Secret{Passphrase: "old"}
+	if err := Encrypt(dir, old, files); err != nil {
+		t.Fatal(err)
+	}
+	before := raw(t, filepath.Join(dir, "project.json"))
+
+	keyFile := Secret{KeyFile: []byte("0123456789abcdef")}
+	if err := Rekey(dir, old, keyFile, files, false); err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	if !bytes.Equal(before, raw(t, filepath.Join(dir, "project.json"))) {
+		t.Fatal("rekey without rotate should leave files untouched")
+	}
+	if err := Unlock(dir, old); err == nil {
+		t.Fatal("old passphrase still opens the project")
+	}
+
+	next := Secret{Passphrase: "new"}
+	if err := Rekey(dir, keyFile, next, files, true); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if bytes.Equal(before, raw(t, filepath.Join(dir, "project.json"))) {
+		t.Fatal("rotate should re-encrypt files")
+	}
+	h, err := ReadHeader(dir)
+	if err != nil || h.PreviousKey != nil || h.KDF != KDFScrypt {
+		t.Fatalf("header after rotate = %+v, %v", h, err)
+	}
+	forget(dir)
+	if err := Unlock(dir, next); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadFile(filepath.Join(dir, "blobs", "a.gz")); err != nil || string(got) != "blob" {
+		t.Fatalf("ReadFile after rotate = %q, %v", got, err)
+	}
+}